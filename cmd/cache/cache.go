@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cachePruneOlderThan time.Duration
+)
+
+func init() {
+	CacheCmd.AddCommand(CachePruneCmd)
+
+	CachePruneCmd.Flags().DurationVar(&cachePruneOlderThan, "older-than", 30*24*time.Hour, "remove the cached responses not used since the given duration (zero for removing all)")
+}
+
+var CacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the local cache of the provider API responses",
+}
+
+var CachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Removes the stale entries of the local cache of the provider API responses",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := utils.HTTPCacheDir()
+		if err != nil {
+			return err
+		}
+		logrus.Infof("pruning cache entries not used since %s in %s", cachePruneOlderThan.String(), dir)
+		removed, err := utils.PruneHTTPCache(dir, cachePruneOlderThan)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("removed %d cache entries", removed)
+		return nil
+	},
+}
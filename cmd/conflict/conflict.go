@@ -4,12 +4,10 @@ import (
 	"fmt"
 
 	"github.com/jasondellaluce/synchro/pkg/branchdb"
+	"github.com/jasondellaluce/synchro/pkg/policy"
 	"github.com/jasondellaluce/synchro/pkg/utils"
 	"github.com/spf13/cobra"
-)
-
-const (
-	rerereCacheFilePath = "./.git/rr-cache"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -37,11 +35,14 @@ var ConflictPullCmd = &cobra.Command{
 	Use:   "pull",
 	Short: "Pulls from a branch starage the latest conflict resolution cache updates",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadPolicy(cmd.Flags()); err != nil {
+			return err
+		}
 		return branchdb.Pull(
 			utils.NewGitHelper(),
 			conflictRemote,
 			conflictStorageBranch,
-			rerereCacheFilePath,
+			utils.RerereCacheDir,
 			!conflictPreserveTempBranches,
 		)
 	},
@@ -51,12 +52,28 @@ var ConflictPushCmd = &cobra.Command{
 	Use:   "push",
 	Short: "Pushes into a branch starage the local conflict resolution cache",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadPolicy(cmd.Flags()); err != nil {
+			return err
+		}
 		return branchdb.Push(
 			utils.NewGitHelper(),
 			conflictRemote,
 			conflictStorageBranch,
-			rerereCacheFilePath,
+			utils.RerereCacheDir,
 			!conflictPreserveTempBranches,
 		)
 	},
 }
+
+// loads the sync policy and uses it for defaulting the storage flags
+// that have not been explicitly set
+func loadPolicy(flags *pflag.FlagSet) error {
+	pol, err := policy.LoadFromFlags(flags, utils.NewGitHelper())
+	if err != nil {
+		return err
+	}
+	return policy.SetFlagDefaults(flags, map[string]string{
+		"remote": pol.Rerere.Remote,
+		"branch": pol.Rerere.Branch,
+	})
+}
@@ -0,0 +1,126 @@
+package downstream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/jasondellaluce/synchro/pkg/downstream"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	batchFromFile       string
+	batchLabels         []string
+	batchCombined       bool
+	batchCombinedBranch string
+)
+
+func init() {
+	addDownstreamFlags(DownstreamBatchCmd.Flags())
+	DownstreamBatchCmd.Flags().StringVar(&searchAfter, "search-after", time.Now().AddDate(0, 0, -7).Format(time.RFC3339), "timestamp after which searching merged pull requests (RFC3339 format)")
+	DownstreamBatchCmd.Flags().StringVar(&batchFromFile, "from-file", "", "the file listing the upstream pull request numbers to be downstreamed one per line, such as the output of the suggest command, or - for reading from stdin (the suggested ones are used if not set)")
+	DownstreamBatchCmd.Flags().StringSliceVar(&batchLabels, "label", []string{}, "if set, only the upstream pull requests having at least one of these labels are downstreamed")
+	DownstreamBatchCmd.Flags().BoolVar(&batchCombined, "combined", false, "if true, all the pull requests are ported in a single branch for which a single pull request is opened")
+	DownstreamBatchCmd.Flags().StringVar(&batchCombinedBranch, "combined-branch", "", fmt.Sprintf("the fork's output branch in which all the pull requests are combined (default %s-downstream-<head>-batch)", utils.ProjectName))
+}
+
+var DownstreamBatchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Ports multiple GitHub Pull Requests from an upstream OSS repository to a downstream fork, each onto its own branch",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pol, err := loadDownstreamPolicy(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		err = checkPersistenFlags()
+		if len(repo) == 0 {
+			err = multierror.Append(fmt.Errorf("must define fork repository"), err)
+		}
+		if err != nil {
+			return err
+		}
+
+		upstreamOrg, upstreamRepoName, err := getOrgRepo(repoUpstream)
+		if err != nil {
+			return err
+		}
+
+		forkOrg, forkRepoName, err := getOrgRepo(repo)
+		if err != nil {
+			return err
+		}
+
+		req := &downstream.BatchRequest{
+			Downstream: downstream.DownstreamRequest{
+				UpstreamOrg:            upstreamOrg,
+				UpstreamRepo:           upstreamRepoName,
+				UpstreamHeadRef:        headUpstream,
+				ForkOrg:                forkOrg,
+				ForkRepo:               forkRepoName,
+				ForkHeadRef:            head,
+				PreserveTempBranches:   preserveTempBranches,
+				PushAndOpenPullRequest: !noPush,
+				Refresh:                refresh,
+				RerereRemote:           rerereRemote,
+				RerereBranch:           rerereBranch,
+			},
+			Branch: func(num int) (string, error) {
+				return downstreamBranch(pol, num)
+			},
+			Labels:         batchLabels,
+			Combined:       batchCombined,
+			CombinedBranch: batchCombinedBranch,
+		}
+		if len(req.CombinedBranch) == 0 {
+			req.CombinedBranch = fmt.Sprintf("%s-downstream-%s-batch", utils.ProjectName, head)
+		}
+
+		if len(batchFromFile) > 0 {
+			var r io.Reader = os.Stdin
+			if batchFromFile != "-" {
+				f, err := os.Open(batchFromFile)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			req.PullRequestNums, err = downstream.ReadPullRequestNums(r)
+			if err != nil {
+				return err
+			}
+			if len(req.PullRequestNums) == 0 {
+				return fmt.Errorf("no pull request numbers found in %s", batchFromFile)
+			}
+		} else {
+			searchAfterTs, err := time.Parse(time.RFC3339, searchAfter)
+			if err != nil {
+				return err
+			}
+			req.Suggest = &downstream.SuggestRequest{
+				UpstreamOrg:     upstreamOrg,
+				UpstreamRepo:    upstreamRepoName,
+				UpstreamHeadRef: headUpstream,
+				ForkHeadRef:     head,
+				SearchAfter:     searchAfterTs,
+			}
+		}
+
+		p, err := provider.NewFromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		report, err := downstream.Batch(context.Background(), utils.NewGitHelper(), p, req)
+		if report != nil {
+			report.WriteText(os.Stdout)
+		}
+		return err
+	},
+}
@@ -3,13 +3,24 @@ package downstream
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/jasondellaluce/synchro/pkg/downstream"
+	"github.com/jasondellaluce/synchro/pkg/policy"
+	"github.com/jasondellaluce/synchro/pkg/provider"
 	"github.com/jasondellaluce/synchro/pkg/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	outputText     = "text"
+	outputJSON     = "json"
+	outputCSV      = "csv"
+	outputMarkdown = "markdown"
 )
 
 var (
@@ -22,30 +33,49 @@ var (
 	searchAfter          string
 	preserveTempBranches bool
 	noPush               bool
+	refresh              bool
+	rerereRemote         string
+	rerereBranch         string
+	suggestOutput        string
+	suggestLabels        []string
+	suggestAuthors       []string
+	suggestMilestones    []string
+	suggestPaths         []string
 )
 
 func init() {
 	DownstreamCmd.Flags().UintVarP(&prNumUpstream, "pr-num", "n", 0, "the upstream GitHub Pull Request number to be downstreamed")
 	DownstreamCmd.Flags().StringVarP(&branch, "branch", "b", "", "the fork's output branch used to port the downstreamed commits")
 	DownstreamCmd.PersistentFlags().StringVarP(&head, "head", "c", "", "the head ref of the fork from which commits are scanned")
-	DownstreamCmd.Flags().StringVarP(&repo, "repo", "r", "", "the fork GitHub repository in the form <org>/<repo>")
 	DownstreamCmd.PersistentFlags().StringVarP(&headUpstream, "upstream-head", "C", "", "the head ref of the upstream repositoy on which appending the fork's scanned commits")
 	DownstreamCmd.PersistentFlags().StringVarP(&repoUpstream, "upstream-repo", "R", "", "the upstream GitHub repository in the form <org>/<repo>")
-	DownstreamCmd.Flags().BoolVar(&preserveTempBranches, "keep-branches", false, "if true, any temporary local branches will not be removed after the execution of a command")
-	DownstreamCmd.Flags().BoolVar(&noPush, "no-push", false, "if true, the downstreamed branch will not be pushed and opening a pull request will not be attempted")
+	addDownstreamFlags(DownstreamCmd.Flags())
 	DownstreamCmd.AddCommand(DownstreamSuggestCmd)
+	DownstreamCmd.AddCommand(DownstreamBatchCmd)
 
 	DownstreamSuggestCmd.Flags().StringVar(&searchAfter, "search-after", time.Now().AddDate(0, 0, -7).Format(time.RFC3339), "timestamp after which searching merged pull requests (RFC3339 format)")
+	DownstreamSuggestCmd.Flags().StringVarP(&suggestOutput, "output", "o", outputText, fmt.Sprintf("the output format of the suggestions, one of: %s, %s, %s, %s", outputText, outputJSON, outputCSV, outputMarkdown))
+	DownstreamSuggestCmd.Flags().StringSliceVar(&suggestLabels, "label", []string{}, "if set, only the upstream pull requests having at least one of these labels are suggested")
+	DownstreamSuggestCmd.Flags().StringSliceVar(&suggestAuthors, "author", []string{}, "if set, only the upstream pull requests opened by one of these users are suggested")
+	DownstreamSuggestCmd.Flags().StringSliceVar(&suggestMilestones, "milestone", []string{}, "if set, only the upstream pull requests in one of these milestones are suggested")
+	DownstreamSuggestCmd.Flags().StringSliceVar(&suggestPaths, "path", []string{}, "if set, only the upstream pull requests changing at least one file matching one of these globs are suggested (e.g. pkg/**)")
 }
 
 var DownstreamCmd = &cobra.Command{
 	Use:   "downstream",
 	Short: "Ports a GitHub Pull Request from an upstream OSS repository to a downstream fork",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		err := checkPersistenFlags()
+		pol, err := loadDownstreamPolicy(cmd.Flags())
+		if err != nil {
+			return err
+		}
 		if len(branch) == 0 {
-			branch = fmt.Sprintf("%s-downstream-%s-pr-%d", utils.ProjectName, head, prNumUpstream)
+			branch, err = downstreamBranch(pol, int(prNumUpstream))
+			if err != nil {
+				return err
+			}
 		}
+		err = checkPersistenFlags()
 		if len(repo) == 0 {
 			err = multierror.Append(fmt.Errorf("must define fork repository"), err)
 		}
@@ -69,10 +99,14 @@ var DownstreamCmd = &cobra.Command{
 			return err
 		}
 
+		p, err := provider.NewFromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
 		ctx := context.Background()
 		git := utils.NewGitHelper()
-		client := utils.GetGithubClient()
-		return downstream.Downstream(ctx, git, client, &downstream.DownstreamRequest{
+		err = downstream.Downstream(ctx, git, p, &downstream.DownstreamRequest{
 			Branch:                 branch,
 			UpstreamOrg:            upstreamOrg,
 			UpstreamRepo:           upstreamRepoName,
@@ -83,7 +117,14 @@ var DownstreamCmd = &cobra.Command{
 			ForkHeadRef:            head,
 			PreserveTempBranches:   preserveTempBranches,
 			PushAndOpenPullRequest: !noPush,
+			Refresh:                refresh,
+			RerereRemote:           rerereRemote,
+			RerereBranch:           rerereBranch,
 		})
+		if suggestion, ok := downstream.ConflictSuggestion(err); ok {
+			fmt.Fprintf(os.Stdout, "%s\n", suggestion)
+		}
+		return err
 	},
 }
 
@@ -91,10 +132,18 @@ var DownstreamSuggestCmd = &cobra.Command{
 	Use:   "suggest",
 	Short: "Suggests a list of GitHub Pull Requests to be downstreamed",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := loadPolicy(cmd.Flags()); err != nil {
+			return err
+		}
 		err := checkPersistenFlags()
 		if err != nil {
 			return err
 		}
+		switch suggestOutput {
+		case outputText, outputJSON, outputCSV, outputMarkdown:
+		default:
+			return fmt.Errorf("unsupported output format: %s", suggestOutput)
+		}
 
 		searchAfterTs, err := time.Parse(time.RFC3339, searchAfter)
 		if err != nil {
@@ -106,19 +155,88 @@ var DownstreamSuggestCmd = &cobra.Command{
 			return err
 		}
 
+		p, err := provider.NewFromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
 		ctx := context.Background()
 		git := utils.NewGitHelper()
-		client := utils.GetGithubClient()
-		return downstream.Suggest(ctx, git, client, &downstream.SuggestRequest{
+		report, err := downstream.Suggest(ctx, git, p, &downstream.SuggestRequest{
 			UpstreamOrg:     upstreamOrg,
 			UpstreamRepo:    upstreamRepoName,
 			UpstreamHeadRef: headUpstream,
 			ForkHeadRef:     head,
 			SearchAfter:     searchAfterTs,
+			Labels:          suggestLabels,
+			Authors:         suggestAuthors,
+			Milestones:      suggestMilestones,
+			Paths:           suggestPaths,
+			ListFiles:       suggestOutput != outputText,
 		})
+		if err != nil {
+			return err
+		}
+		switch suggestOutput {
+		case outputJSON:
+			return report.WriteJSON(os.Stdout)
+		case outputCSV:
+			return report.WriteCSV(os.Stdout)
+		case outputMarkdown:
+			report.WriteMarkdown(os.Stdout)
+		default:
+			report.WriteText(os.Stdout)
+		}
+		return nil
 	},
 }
 
+// adds the flags shared by the commands porting pull requests in the fork
+func addDownstreamFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&repo, "repo", "r", "", "the fork GitHub repository in the form <org>/<repo>")
+	flags.BoolVar(&preserveTempBranches, "keep-branches", false, "if true, any temporary local branches will not be removed after the execution of a command")
+	flags.BoolVar(&noPush, "no-push", false, "if true, the downstreamed branch will not be pushed and opening a pull request will not be attempted")
+	flags.BoolVar(&refresh, "refresh", false, fmt.Sprintf("if true, the branch and the pull request of a %s downstream are updated in case the upstream pull request has been merged or updated since", downstream.PreMergeLabel))
+	flags.StringVar(&rerereRemote, "rerere-remote", "origin", "the remote name of the storage branch of the conflicts cache")
+	flags.StringVar(&rerereBranch, "rerere-branch", fmt.Sprintf("%s-rerere-cache", utils.ProjectName), "the storage branch of the conflicts cache pulled before picking the commits, which is not pulled if empty")
+}
+
+// loads the sync policy and uses it for defaulting the flags that have not
+// been explicitly set, including the ones of the conflicts cache
+func loadDownstreamPolicy(flags *pflag.FlagSet) (*policy.Policy, error) {
+	pol, err := loadPolicy(flags)
+	if err != nil {
+		return nil, err
+	}
+	return pol, policy.SetFlagDefaults(flags, map[string]string{
+		"rerere-remote": pol.Rerere.Remote,
+		"rerere-branch": pol.Rerere.Branch,
+	})
+}
+
+// returns the name of the fork's output branch of the given upstream pull
+// request, rendered from the policy if defined
+func downstreamBranch(pol *policy.Policy, num int) (string, error) {
+	res, err := pol.DownstreamBranch(&policy.BranchVars{UpstreamHead: headUpstream, ForkHead: head, PullRequest: num})
+	if err != nil {
+		return "", fmt.Errorf("can't render downstream branch name from policy: %s", err.Error())
+	}
+	if len(res) == 0 {
+		res = fmt.Sprintf("%s-downstream-%s-pr-%d", utils.ProjectName, head, num)
+	}
+	return res, nil
+}
+
+// loads the sync policy and uses it for defaulting the flags that have not
+// been explicitly set
+func loadPolicy(flags *pflag.FlagSet) (*policy.Policy, error) {
+	pol, err := policy.LoadFromFlags(flags, utils.NewGitHelper())
+	if err != nil {
+		return nil, err
+	}
+	return pol, policy.SetFlagDefaults(flags, pol.RepoFlagDefaults())
+}
+
 func checkPersistenFlags() error {
 	var err error
 	if len(repoUpstream) == 0 {
@@ -14,6 +14,7 @@ import (
 func init() {
 	ExplainCmd.AddCommand(ExplainMarkersCmd)
 	ExplainCmd.AddCommand(ExplainConflictsCmd)
+	ExplainCmd.AddCommand(ExplainSkipReasonsCmd)
 }
 
 var ExplainCmd = &cobra.Command{
@@ -28,14 +29,23 @@ var ExplainMarkersCmd = &cobra.Command{
 		fmt.Fprintf(os.Stdout, "# Commit Markers\n\n")
 		fmt.Fprintf(os.Stdout, "Commit markers are keywords that can be annotated either in the body message of a commit, "+
 			"or in one or more GitHub comments relative to a commit. "+
-			"They can be used to influence the behavior of the `%s` tool when scanning a given commit during a fork sync.\n\n",
-			utils.ProjectName,
+			"They can be used to influence the behavior of the `%s` tool when scanning a given commit during a fork sync. "+
+			"Markers must be either on their own line, or the value of a `%s` git trailer such as `%s: %s`, "+
+			"and are not recognized when mentioned in prose or inside code blocks. "+
+			"Markers can be validated with the `%s markers lint` command.\n\n",
+			utils.ProjectName, sync.MarkerTrailerKey, sync.MarkerTrailerKey, sync.CommitMarkerConflictSkip.TrailerValue()+"(vendor/**)", utils.ProjectName,
+		)
+		fmt.Fprintf(os.Stdout, "Markers annotated inline with other text, such as `%s: <reason>` or `fix: something %s`, "+
+			"were recognized by previous versions and are now ignored. "+
+			"They are reported as warnings during a sync and as issues by the lint command, "+
+			"and can be migrated by moving each marker on its own line, such as `%s`, or in a trailer, such as `%s: %s`.\n\n",
+			sync.CommitMarkerIgnore, sync.CommitMarkerIgnore, sync.CommitMarkerIgnore, sync.MarkerTrailerKey, sync.CommitMarkerIgnore.TrailerValue(),
 		)
 		data := [][]string{{"Marker", "Description"}}
 		for _, m := range sync.AllCommitMarkers {
 			data = append(data, []string{"`" + m.String() + "`", m.Description()})
 		}
-		explainAsTable(data, os.Stdout)
+		AsTable(data, os.Stdout)
 	},
 }
 
@@ -53,11 +63,31 @@ var ExplainConflictsCmd = &cobra.Command{
 		for _, c := range sync.AllConflictInfos {
 			data = append(data, []string{"`" + c.String() + "`", c.Description(), c.RecoverDescription()})
 		}
-		explainAsTable(data, os.Stdout)
+		AsTable(data, os.Stdout)
+	},
+}
+
+var ExplainSkipReasonsCmd = &cobra.Command{
+	Use:   "skip-reasons",
+	Short: "Lists and describes the reasons for which fork commits can be skipped during a sync",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Fprintf(os.Stdout, "# Skip Reasons\n\n")
+		fmt.Fprintf(os.Stdout, "The `%s` tool does not pick fork commits whose changes are already part of upstream, "+
+			"or that are excluded by their markers or by the sync policy. "+
+			"The skipped commits of a sync, along with the reason and evidence of each, can be listed with the `%s sync explain-plan` command.\n\n",
+			utils.ProjectName, utils.ProjectName,
+		)
+		data := [][]string{{"Reason", "Description"}}
+		for _, r := range sync.AllSkipReasons {
+			data = append(data, []string{"`" + r.String() + "`", r.Description()})
+		}
+		AsTable(data, os.Stdout)
 	},
 }
 
-func explainAsTable(data [][]string, w io.Writer) {
+// AsTable writes the given data as a markdown table, of which the first row
+// is the header
+func AsTable(data [][]string, w io.Writer) {
 	table := tablewriter.NewWriter(w)
 	table.SetHeader(data[0])
 	table.SetAutoWrapText(false)
@@ -0,0 +1,58 @@
+package markers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/sync"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var lintRepo string
+
+func init() {
+	MarkersLintCmd.Flags().StringVarP(&lintRepo, "repo", "r", "", "if set, the markers in the comments of the commits of this repository in the form <org>/<repo> are validated too")
+	MarkersCmd.AddCommand(MarkersLintCmd)
+}
+
+var MarkersCmd = &cobra.Command{
+	Use:   "markers",
+	Short: "Manage the commit markers",
+}
+
+var MarkersLintCmd = &cobra.Command{
+	Use:   "lint <range>",
+	Short: "Validates the markers annotated in the messages and comments of the commits of a git revision range",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req := &sync.LintRequest{RevRange: args[0]}
+		var p provider.Provider
+		if len(lintRepo) > 0 {
+			tokens := strings.Split(lintRepo, "/")
+			if len(tokens) != 2 {
+				return fmt.Errorf("repository must be in the form <org>/<repo>: %s", lintRepo)
+			}
+			req.ForkOrg, req.ForkRepo = tokens[0], tokens[1]
+			var err error
+			p, err = provider.NewFromFlags(cmd.Flags())
+			if err != nil {
+				return err
+			}
+		}
+		issues, err := sync.LintMarkers(context.Background(), utils.NewGitHelper(), p, req)
+		if err != nil {
+			return err
+		}
+		for _, issue := range issues {
+			fmt.Fprintf(os.Stdout, "%s %s # %s\n", issue.SHA, issue, issue.Title)
+		}
+		if len(issues) > 0 {
+			return fmt.Errorf("found %d marker issues in %s", len(issues), args[0])
+		}
+		return nil
+	},
+}
@@ -25,5 +25,7 @@ var ReadmeCmd = &cobra.Command{
 		explain.ExplainMarkersCmd.Run(cmd, args)
 		fmt.Fprintf(os.Stdout, "\n#")
 		explain.ExplainConflictsCmd.Run(cmd, args)
+		fmt.Fprintf(os.Stdout, "\n#")
+		explain.ExplainSkipReasonsCmd.Run(cmd, args)
 	},
 }
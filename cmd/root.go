@@ -3,12 +3,16 @@ package cmd
 import (
 	"os"
 
+	"github.com/jasondellaluce/synchro/cmd/cache"
 	"github.com/jasondellaluce/synchro/cmd/conflict"
 	"github.com/jasondellaluce/synchro/cmd/downstream"
 	"github.com/jasondellaluce/synchro/cmd/explain"
 	"github.com/jasondellaluce/synchro/cmd/judge"
+	"github.com/jasondellaluce/synchro/cmd/markers"
 	"github.com/jasondellaluce/synchro/cmd/readme"
 	"github.com/jasondellaluce/synchro/cmd/sync"
+	"github.com/jasondellaluce/synchro/pkg/policy"
+	"github.com/jasondellaluce/synchro/pkg/provider"
 	"github.com/jasondellaluce/synchro/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -20,12 +24,18 @@ var (
 
 func init() {
 	rootCmd.PersistentFlags().BoolVar(&rootVerbose, "verbose", false, "if true, turns the logger into more verbose")
+	provider.AddFlags(rootCmd.PersistentFlags())
+	policy.AddFlags(rootCmd.PersistentFlags())
 	rootCmd.AddCommand(sync.SyncCmd)
 	rootCmd.AddCommand(readme.ReadmeCmd)
 	rootCmd.AddCommand(explain.ExplainCmd)
 	rootCmd.AddCommand(conflict.ConflictCmd)
 	rootCmd.AddCommand(downstream.DownstreamCmd)
 	rootCmd.AddCommand(judge.JudgeCmd)
+	rootCmd.AddCommand(cache.CacheCmd)
+	rootCmd.AddCommand(markers.MarkersCmd)
+	rootCmd.AddCommand(sync.ExportCmd)
+	rootCmd.AddCommand(sync.ImportCmd)
 }
 
 var rootCmd = &cobra.Command{
@@ -0,0 +1,126 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jasondellaluce/synchro/cmd/explain"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/sync"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	explainPlanFile string
+)
+
+func init() {
+	ExplainPlanCmd.Flags().StringVar(&explainPlanFile, "plan", "", "a sync plan file previously produced with --output json|yaml, used instead of scanning the fork")
+}
+
+var ExplainPlanCmd = &cobra.Command{
+	Use:   "explain-plan [sha...]",
+	Short: "Explains which fork commits a sync would pick or skip and why, optionally restricted to the given commits",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var plan *sync.Plan
+		if len(explainPlanFile) > 0 {
+			data, err := os.ReadFile(explainPlanFile)
+			if err != nil {
+				return err
+			}
+			// note: JSON is valid YAML, so this works with both formats
+			plan = &sync.Plan{}
+			if err := yaml.Unmarshal(data, plan); err != nil {
+				return fmt.Errorf("can't parse sync plan file %s: %s", explainPlanFile, err.Error())
+			}
+		} else {
+			req, err := newSyncRequest(cmd.Flags(), false)
+			if err != nil {
+				return err
+			}
+			p, err := provider.NewFromFlags(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			plan, err = sync.ScanPlan(context.Background(), utils.NewGitHelper(), p, req)
+			if err != nil {
+				return err
+			}
+		}
+		return explainPlan(plan, args, os.Stdout)
+	},
+}
+
+func explainPlan(plan *sync.Plan, shas []string, w io.Writer) error {
+	matches := func(c *sync.PlanCommit) bool {
+		if len(shas) == 0 {
+			return true
+		}
+		for _, sha := range shas {
+			if strings.HasPrefix(c.SHA, sha) {
+				return true
+			}
+		}
+		return false
+	}
+
+	fmt.Fprintf(w, "# Sync Plan\n\n")
+	fmt.Fprintf(w, "Fork `%s` (`%s`) on top of upstream `%s` (`%s`): %d commits picked, %d commits skipped.\n\n",
+		plan.ForkRepo, plan.ForkHeadRef, plan.UpstreamRepo, plan.UpstreamHeadRef, len(plan.Commits), len(plan.Skipped))
+
+	found := 0
+	picked := [][]string{{"Commit", "Title", "Markers", "Upstream Ref"}}
+	for _, c := range plan.Commits {
+		if !matches(c) {
+			continue
+		}
+		ref := ""
+		if c.UpstreamRef != nil {
+			ref = fmt.Sprintf("%s (%s)", c.UpstreamRef.URL, c.UpstreamRef.State)
+		}
+		picked = append(picked, []string{sync.ShortSHA(c.SHA), c.Title, strings.Join(c.Markers, ", "), ref})
+	}
+	if len(picked) > 1 {
+		found += len(picked) - 1
+		fmt.Fprintf(w, "## Picked Commits\n\n")
+		explain.AsTable(picked, w)
+		fmt.Fprintln(w)
+	}
+
+	reasons := [][]string{{"Reason", "Description"}}
+	described := make(map[sync.SkipReason]bool)
+	skipped := [][]string{{"Commit", "Title", "Reason", "Evidence"}}
+	for _, c := range plan.Skipped {
+		if !matches(c) {
+			continue
+		}
+		evidence := c.SkipEvidence
+		if len(c.SkipURL) > 0 {
+			evidence += fmt.Sprintf(" (%s)", c.SkipURL)
+		}
+		skipped = append(skipped, []string{sync.ShortSHA(c.SHA), c.Title, "`" + c.SkipReason.String() + "`", evidence})
+		if !described[c.SkipReason] {
+			described[c.SkipReason] = true
+			reasons = append(reasons, []string{"`" + c.SkipReason.String() + "`", c.SkipReason.Description()})
+		}
+	}
+	if len(skipped) > 1 {
+		found += len(skipped) - 1
+		fmt.Fprintf(w, "## Skipped Commits\n\n")
+		explain.AsTable(skipped, w)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "## Skip Reasons\n\n")
+		explain.AsTable(reasons, w)
+		fmt.Fprintln(w)
+	}
+
+	if found == 0 && len(shas) > 0 {
+		return fmt.Errorf("commits not found in sync plan, they're probably older than the scanned fork history: %s", strings.Join(shas, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package sync
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jasondellaluce/synchro/pkg/sync"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainPlan(t *testing.T) {
+	plan := &sync.Plan{
+		UpstreamRepo:    "org/upstream",
+		UpstreamHeadRef: "master",
+		ForkRepo:        "org/fork",
+		ForkHeadRef:     "main",
+		Commits: []*sync.PlanCommit{
+			{
+				SHA:         "1111111111111111111111111111111111111111",
+				Title:       "new: picked commit",
+				Markers:     []string{"SYNC_CONFLICT_SKIP(vendor/**)"},
+				UpstreamRef: &sync.PlanPullRequest{URL: "https://github.com/org/upstream/pull/1", State: "open"},
+			},
+		},
+		Skipped: []*sync.PlanCommit{
+			{
+				SHA:          "2222222222222222222222222222222222222222",
+				Title:        "chore: ignored commit",
+				SkipReason:   sync.SkipReasonIgnoreMarker,
+				SkipEvidence: "SYNC_IGNORE in commit message",
+			},
+			{
+				SHA:          "3333333333333333333333333333333333333333",
+				Title:        "fix: ported commit",
+				SkipReason:   sync.SkipReasonEquivalentPatch,
+				SkipEvidence: "patch-id matches upstream commit",
+				SkipURL:      "https://github.com/org/upstream/commit/4444",
+			},
+			{
+				SHA:          "5555555555555555555555555555555555555555",
+				Title:        "chore: from a newer plan",
+				SkipReason:   sync.SkipReason("unknown-reason"),
+				SkipEvidence: "some evidence",
+			},
+		},
+	}
+
+	t.Run("all", func(t *testing.T) {
+		b := bytes.Buffer{}
+		require.NoError(t, explainPlan(plan, nil, &b))
+		out := b.String()
+		assert.Contains(t, out, "Fork `org/fork` (`main`) on top of upstream `org/upstream` (`master`): 1 commits picked, 3 commits skipped.")
+		assert.Contains(t, out, "## Picked Commits")
+		assert.Contains(t, out, "| 11111111 | new: picked commit | SYNC_CONFLICT_SKIP(vendor/**) | https://github.com/org/upstream/pull/1 (open) |")
+		assert.Contains(t, out, "## Skipped Commits")
+		assert.Regexp(t, "\\| 33333333 \\| fix: ported commit +\\| `equivalent-patch` +\\| patch-id matches upstream commit \\(https://github.com/org/upstream/commit/4444\\) +\\|", out)
+		assert.Contains(t, out, "## Skip Reasons")
+		assert.Contains(t, out, sync.SkipReasonIgnoreMarker.Description())
+		assert.Contains(t, out, sync.SkipReasonEquivalentPatch.Description())
+		assert.Contains(t, out, sync.SkipReason("unknown-reason").Description())
+		assert.NotContains(t, out, sync.SkipReasonPolicy.Description())
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		b := bytes.Buffer{}
+		require.NoError(t, explainPlan(plan, []string{"2222"}, &b))
+		out := b.String()
+		assert.NotContains(t, out, "## Picked Commits")
+		assert.Contains(t, out, "| 22222222 | chore: ignored commit | `ignore-marker` | SYNC_IGNORE in commit message |")
+		assert.NotContains(t, out, "33333333")
+		assert.NotContains(t, out, sync.SkipReasonEquivalentPatch.Description())
+	})
+
+	t.Run("not-found", func(t *testing.T) {
+		b := bytes.Buffer{}
+		err := explainPlan(plan, []string{"6666"}, &b)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "6666")
+	})
+}
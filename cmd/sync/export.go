@@ -0,0 +1,43 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/sync"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat string
+	exportOutput string
+)
+
+func init() {
+	ExportCmd.Flags().StringVar(&exportFormat, "format", sync.ExportFormatMbox, fmt.Sprintf("the format of the exported patch series, one of: %s", strings.Join(sync.AllExportFormats, ", ")))
+	ExportCmd.Flags().StringVar(&exportOutput, "output", "-", "the output file for the mbox format (- for stdout), or the output directory for the others")
+}
+
+// ExportCmd shares the scan flags of SyncCmd, which are added to it once
+// they are registered
+var ExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports the fork's private patches as an ordered patch series",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req, err := newSyncRequest(cmd.Flags(), false)
+		if err != nil {
+			return err
+		}
+		p, err := provider.NewFromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		return sync.Export(context.Background(), utils.NewGitHelper(), p, req, &sync.ExportRequest{
+			Format: exportFormat,
+			Output: exportOutput,
+		})
+	},
+}
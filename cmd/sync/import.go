@@ -0,0 +1,42 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/sync"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFormat string
+)
+
+func init() {
+	ImportCmd.Flags().StringVar(&importFormat, "format", "", fmt.Sprintf("the format of the imported patch series, one of: %s (detected from the input if not set)", strings.Join(sync.AllExportFormats, ", ")))
+}
+
+// ImportCmd shares the scan flags of SyncCmd, which are added to it once
+// they are registered
+var ImportCmd = &cobra.Command{
+	Use:   "import <mbox|dir>",
+	Short: "Applies a patch series on top of the upstream head in the sync branch",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req, err := newSyncRequest(cmd.Flags(), true)
+		if err != nil {
+			return err
+		}
+		p, err := provider.NewFromFlags(cmd.Flags())
+		if err != nil {
+			return err
+		}
+		return sync.Import(context.Background(), utils.NewGitHelper(), p, req, &sync.ImportRequest{
+			Format: importFormat,
+			Input:  args[0],
+		})
+	},
+}
@@ -0,0 +1,52 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jasondellaluce/synchro/pkg/sync"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+const outputMarkdown = "markdown"
+
+var (
+	reportPrevious string
+	reportOutput   string
+)
+
+func init() {
+	ReportCmd.Flags().StringVar(&reportPrevious, "previous", "", "the previous sync branch against which the new one is compared")
+	ReportCmd.Flags().StringVarP(&reportOutput, "output", "o", outputText, fmt.Sprintf("the output format of the report, one of: %s, %s", outputText, outputMarkdown))
+	ReportCmd.MarkFlagRequired("previous")
+}
+
+var ReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Reports how each fork commit changed between the previous sync branch and the new one (the current branch if --branch is not set)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if reportOutput != outputText && reportOutput != outputMarkdown {
+			return fmt.Errorf("unsupported output format: %s", reportOutput)
+		}
+		git := utils.NewGitHelper()
+		branch := syncBranch
+		if len(branch) == 0 {
+			var err error
+			branch, err = git.GetCurrentBranch()
+			if err != nil {
+				return err
+			}
+		}
+		report, err := sync.RangeDiff(git, reportPrevious, branch)
+		if err != nil {
+			return err
+		}
+		if reportOutput == outputMarkdown {
+			report.WriteMarkdown(os.Stdout)
+		} else {
+			report.WriteText(os.Stdout)
+		}
+		return nil
+	},
+}
@@ -2,84 +2,251 @@ package sync
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/hashicorp/go-multierror"
+	"github.com/jasondellaluce/synchro/pkg/policy"
+	"github.com/jasondellaluce/synchro/pkg/provider"
 	"github.com/jasondellaluce/synchro/pkg/sync"
 	"github.com/jasondellaluce/synchro/pkg/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
 )
 
 var (
 	syncDryRun       bool
+	syncContinue     bool
+	syncAbort        bool
 	syncBranch       string
 	syncHead         string
 	syncRepo         string
 	syncRepoUpstream string
 	syncHeadUpstream string
+	syncLocalScan    bool
+	syncScanEnrich   bool
+	syncRemote       string
+	syncConcurrency  int
+	syncOutput       string
+	syncPredict      bool
+	syncKeepGoing    bool
+	syncPark         bool
+	syncReportFile   string
+	syncTrustedPerm  string
+	syncTrustedTeams []string
+	syncPush         bool
+	syncOpenPR       bool
+	syncPRBase       string
 )
 
 func init() {
 	SyncCmd.Flags().BoolVar(&syncDryRun, "dryrun", false, "preview the sync changes")
-	SyncCmd.Flags().StringVarP(&syncBranch, "branch", "b", "", "the fork's synched output branch")
-	SyncCmd.Flags().StringVarP(&syncHead, "head", "c", "", "the head ref of the fork from which commits are scanned")
-	SyncCmd.Flags().StringVarP(&syncRepo, "repo", "r", "", "the GitHub repository of the fork in the form <org>/<repo>")
-	SyncCmd.Flags().StringVarP(&syncHeadUpstream, "upstream-head", "C", "", "the head ref of the upstream repositoy on which appending the fork's scanned commits")
-	SyncCmd.Flags().StringVarP(&syncRepoUpstream, "upstream-repo", "R", "", "the upstream GitHub repository in the form <org>/<repo>")
+	SyncCmd.Flags().BoolVar(&syncContinue, "continue", false, "resume a sync stopped due to a merge conflict after solving it manually")
+	SyncCmd.Flags().BoolVar(&syncAbort, "abort", false, "cancel a sync stopped due to a merge conflict and restore the initial branch")
+	SyncCmd.MarkFlagsMutuallyExclusive("continue", "abort")
+	SyncCmd.AddCommand(ExplainPlanCmd)
+	SyncCmd.AddCommand(ReportCmd)
+	SyncCmd.Flags().BoolVar(&syncPredict, "predict", false, "predict the merge conflicts of the sync by simulating it, without touching the working tree")
+	SyncCmd.Flags().BoolVar(&syncKeepGoing, "keep-going", false, "skip the commits with merge conflicts that can't be solved automatically, and report all of them at the end of the sync")
+	SyncCmd.Flags().BoolVar(&syncPark, "park-conflicts", false, "like --keep-going, but the conflicting state of each skipped commit is committed in a side branch")
+	SyncCmd.Flags().StringVar(&syncReportFile, "report-file", "", "if used with --keep-going, the file in which the report of the skipped commits is written")
+	SyncCmd.Flags().BoolVar(&syncPush, "push", false, "push the sync branch into the fork once the sync succeeds")
+	SyncCmd.Flags().BoolVar(&syncOpenPR, "open-pr", false, "like --push, but also open a pull request for the sync branch, or update the one already open for it")
+	SyncCmd.Flags().StringVar(&syncPRBase, "pr-base", "", "if used with --open-pr, the base branch of the sync pull request (the fork's head ref if not set)")
+	SyncCmd.Flags().StringVarP(&syncOutput, "output", "o", outputText, fmt.Sprintf("the output format of the sync plan when used with --dryrun or --predict, one of: %s, %s, %s", outputText, outputJSON, outputYAML))
+	SyncCmd.PersistentFlags().StringVarP(&syncBranch, "branch", "b", "", "the fork's synched output branch")
+	SyncCmd.PersistentFlags().StringVarP(&syncHead, "head", "c", "", "the head ref of the fork from which commits are scanned")
+	SyncCmd.PersistentFlags().StringVarP(&syncRepo, "repo", "r", "", "the GitHub repository of the fork in the form <org>/<repo>")
+	SyncCmd.PersistentFlags().StringVarP(&syncHeadUpstream, "upstream-head", "C", "", "the head ref of the upstream repositoy on which appending the fork's scanned commits")
+	SyncCmd.PersistentFlags().StringVarP(&syncRepoUpstream, "upstream-repo", "R", "", "the upstream GitHub repository in the form <org>/<repo>")
+	SyncCmd.PersistentFlags().BoolVar(&syncLocalScan, "scan-local", false, "scan the fork's private patches from the local git history instead of using the provider APIs")
+	SyncCmd.PersistentFlags().StringVar(&syncRemote, "scan-upstream-remote", "", "if used with --scan-local, an existing git remote from which the upstream history is read without fetching it")
+	SyncCmd.PersistentFlags().IntVar(&syncConcurrency, "scan-concurrency", 4, "the max number of fork commits scanned concurrently through the provider APIs")
+	SyncCmd.PersistentFlags().StringVar(&syncTrustedPerm, "trusted-comment-permission", "", fmt.Sprintf("if set, only the markers in the commit comments of users with at least this permission on the fork are honored, one of: %s", strings.Join(provider.AllPermissions, ", ")))
+	SyncCmd.PersistentFlags().StringSliceVar(&syncTrustedTeams, "trusted-comment-team", []string{}, "if set, the markers in the commit comments of members of these teams of the fork's organization are honored, even without --trusted-comment-permission")
+	SyncCmd.PersistentFlags().BoolVar(&syncScanEnrich, "scan-enrich", false, "if used with --scan-local, enrich the scanned commits with pull requests and comments from the provider")
+	ExportCmd.Flags().AddFlagSet(SyncCmd.PersistentFlags())
+	ImportCmd.Flags().AddFlagSet(SyncCmd.PersistentFlags())
 }
 
 var SyncCmd = &cobra.Command{
 	Use:   "sync",
 	Short: "Syncs the fork to an upstream ref by appending all the custom commits",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var err error
-		if len(syncRepoUpstream) == 0 {
-			err = multierror.Append(fmt.Errorf("must define upstream repository in scan request"), err)
+		if syncContinue {
+			opts, err := provider.OptionsFromFlags(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			// note: the sync is resumed with the provider with which it
+			// started, unless another one is explicitly requested
+			if !cmd.Flags().Changed("provider") && !cmd.Flags().Changed("provider-url") {
+				opts.Kind, opts.BaseURL = "", ""
+			}
+			return sync.Continue(context.Background(), utils.NewGitHelper(), opts)
 		}
-		if len(syncRepo) == 0 {
-			err = multierror.Append(fmt.Errorf("must define fork's repository in scan request"), err)
+		if syncAbort {
+			return sync.Abort(utils.NewGitHelper())
 		}
-		if len(syncHeadUpstream) == 0 {
-			err = multierror.Append(fmt.Errorf("must define upstream head ref in scan request"), err)
-		}
-		if len(syncHead) == 0 {
-			err = multierror.Append(fmt.Errorf("must define fork's head ref in scan request"), err)
+
+		var err error
+		if syncOutput != outputText && syncOutput != outputJSON && syncOutput != outputYAML {
+			err = multierror.Append(fmt.Errorf("unsupported output format: %s", syncOutput), err)
+		} else if syncOutput != outputText && !syncDryRun && !syncPredict {
+			err = multierror.Append(fmt.Errorf("output format %s can only be used with --dryrun or --predict", syncOutput), err)
 		}
-		if len(syncBranch) == 0 {
-			err = multierror.Append(fmt.Errorf("must define name of the sync branch in fork"), err)
+		req, reqErr := newSyncRequest(cmd.Flags(), !syncPredict)
+		if reqErr != nil {
+			err = multierror.Append(reqErr, err)
 		}
 		if err != nil {
 			return err
 		}
 
-		forkOrg, syncRepoName, err := getOrgRepo(syncRepo)
+		ctx := context.Background()
+		p, err := provider.NewFromFlags(cmd.Flags())
 		if err != nil {
 			return err
 		}
-		upstreamOrg, upstreamRepoName, err := getOrgRepo(syncRepoUpstream)
+		if syncPredict {
+			plan, err := sync.PredictPlan(ctx, utils.NewGitHelper(), p, req)
+			if err != nil {
+				return err
+			}
+			if syncOutput == outputText {
+				writePrediction(plan)
+				return nil
+			}
+			return writePlan(plan, syncOutput)
+		}
+		if syncOutput != outputText {
+			plan, err := sync.ScanPlan(ctx, utils.NewGitHelper(), p, req)
+			if err != nil {
+				return err
+			}
+			return writePlan(plan, syncOutput)
+		}
+		return sync.Sync(ctx, utils.NewGitHelper(), p, req)
+	},
+}
+
+// builds a sync request from the flags of the sync command, which are
+// shared with its subcommands. The flags not explicitly set default to
+// the values of the sync policy, if any.
+func newSyncRequest(flags *pflag.FlagSet, requireBranch bool) (*sync.Request, error) {
+	pol, err := policy.LoadFromFlags(flags, utils.NewGitHelper())
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.SetFlagDefaults(flags, pol.RepoFlagDefaults()); err != nil {
+		return nil, err
+	}
+	if err := policy.SetFlagDefaults(flags, pol.MarkersFlagDefaults()); err != nil {
+		return nil, err
+	}
+	if len(syncBranch) == 0 {
+		syncBranch, err = pol.SyncBranch(&policy.BranchVars{UpstreamHead: syncHeadUpstream, ForkHead: syncHead})
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("can't render sync branch name from policy: %s", err.Error())
 		}
+	}
 
-		ctx := context.Background()
-		client := utils.GetGithubClient()
-		return sync.Sync(
-			ctx,
-			utils.NewGitHelper(),
-			client,
-			&sync.Request{
-				DryRun:          syncDryRun,
-				OutBranch:       syncBranch,
-				UpstreamOrg:     upstreamOrg,
-				UpstreamRepo:    upstreamRepoName,
-				ForkOrg:         forkOrg,
-				ForkRepo:        syncRepoName,
-				ForkHeadRef:     syncHead,
-				UpstreamHeadRef: syncHeadUpstream,
-			},
-		)
-	},
+	if len(syncRepoUpstream) == 0 {
+		err = multierror.Append(fmt.Errorf("must define upstream repository in scan request"), err)
+	}
+	if len(syncRepo) == 0 {
+		err = multierror.Append(fmt.Errorf("must define fork's repository in scan request"), err)
+	}
+	if len(syncHeadUpstream) == 0 {
+		err = multierror.Append(fmt.Errorf("must define upstream head ref in scan request"), err)
+	}
+	if len(syncHead) == 0 {
+		err = multierror.Append(fmt.Errorf("must define fork's head ref in scan request"), err)
+	}
+	if requireBranch && len(syncBranch) == 0 {
+		err = multierror.Append(fmt.Errorf("must define name of the sync branch in fork"), err)
+	}
+	if len(syncTrustedPerm) > 0 && !utils.Contains(provider.AllPermissions, syncTrustedPerm) {
+		err = multierror.Append(fmt.Errorf("trusted comment permission must be one of: %s", strings.Join(provider.AllPermissions, ", ")), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	forkOrg, syncRepoName, err := getOrgRepo(syncRepo)
+	if err != nil {
+		return nil, err
+	}
+	upstreamOrg, upstreamRepoName, err := getOrgRepo(syncRepoUpstream)
+	if err != nil {
+		return nil, err
+	}
+	providerOpts, err := provider.OptionsFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sync.Request{
+		DryRun:                   syncDryRun,
+		OutBranch:                syncBranch,
+		UpstreamOrg:              upstreamOrg,
+		UpstreamRepo:             upstreamRepoName,
+		ForkOrg:                  forkOrg,
+		ForkRepo:                 syncRepoName,
+		ForkHeadRef:              syncHead,
+		UpstreamHeadRef:          syncHeadUpstream,
+		LocalScan:                syncLocalScan,
+		LocalScanEnrich:          syncScanEnrich,
+		UpstreamRemote:           syncRemote,
+		ScanConcurrency:          syncConcurrency,
+		KeepGoing:                syncKeepGoing || syncPark,
+		ParkConflicts:            syncPark,
+		ReportFile:               syncReportFile,
+		IgnoreCommits:            pol.Ignore.Commits,
+		IgnoreAuthors:            pol.Ignore.Authors,
+		ConflictSkipGlobs:        pol.ConflictGlobs(policy.StrategySkip),
+		ConflictApplyGlobs:       pol.ConflictGlobs(policy.StrategyApply),
+		TrustedCommentPermission: syncTrustedPerm,
+		TrustedCommentTeams:      syncTrustedTeams,
+		Push:                     syncPush || syncOpenPR,
+		OpenPullRequest:          syncOpenPR,
+		PullRequestBase:          syncPRBase,
+		Provider:                 providerOpts,
+	}, nil
+}
+
+func writePlan(plan *sync.Plan, format string) error {
+	if format == outputYAML {
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		defer enc.Close()
+		return enc.Encode(plan)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(plan)
+}
+
+func writePrediction(plan *sync.Plan) {
+	for _, c := range plan.Commits {
+		approximate := ""
+		if c.Prediction.Approximate {
+			approximate = " (approximate)"
+		}
+		fmt.Fprintf(os.Stdout, "%-16s %s # %s%s\n", c.Prediction.Outcome, c.SHA, c.Title, approximate)
+		for _, conflict := range c.Prediction.Conflicts {
+			fmt.Fprintf(os.Stdout, "    %s\n", conflict)
+		}
+	}
 }
 
 func getOrgRepo(s string) (string, string, error) {
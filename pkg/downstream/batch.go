@@ -0,0 +1,384 @@
+package downstream
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/branchdb"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// batchPullRequestTitlePrefix prefixes the title of the fork pull request
+// combining all the pull requests downstreamed in a batch
+const batchPullRequestTitlePrefix = "downstream(batch): "
+
+// BatchRequest contains all the info required for downstreaming multiple
+// upstream pull requests at once
+type BatchRequest struct {
+	// Downstream is the request used for each of the pull requests, of which
+	// the branch and the upstream pull request number are overridden
+	Downstream DownstreamRequest
+	// Branch returns the name of the fork's output branch of the given
+	// upstream pull request
+	Branch func(num int) (string, error)
+	// PullRequestNums are the upstream pull requests to be downstreamed in
+	// order, which are the ones suggested for Suggest if empty
+	PullRequestNums []int
+	Suggest         *SuggestRequest
+	// Labels restricts the pull requests to the ones having at least one of
+	// them, if not empty
+	Labels []string
+	// Combined requires porting all the pull requests in CombinedBranch and
+	// opening a single pull request for them, instead of one for each
+	Combined       bool
+	CombinedBranch string
+}
+
+// BatchReport describes the outcome of downstreaming each pull request of
+// a batch, in order of application
+type BatchReport struct {
+	Entries []*BatchEntry
+	// CombinedBranch is the branch in which all the pull requests have been
+	// ported, if requested
+	CombinedBranch string
+}
+
+// BatchEntry describes the outcome of downstreaming a single pull request
+type BatchEntry struct {
+	Number int
+	URL    string
+	Title  string
+	Status DownstreamStatus
+	// Branch is the fork's output branch of the pull request
+	Branch string
+	// Error is the reason of the failure or of the merge conflicts, if any
+	Error string
+}
+
+// ReadPullRequestNums reads the numbers of the pull requests listed one per
+// record, as the first comma-separated field such as in the text and CSV
+// output of Suggest. Empty lines, the ones starting with `#`, and the CSV
+// header are ignored.
+func ReadPullRequestNums(r io.Reader) ([]int, error) {
+	var res []int
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	// note: the fields of the text output are separated by a space too, so
+	// the titles are never read as quoted fields even if starting with quotes
+	cr.LazyQuotes = true
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		token := strings.TrimSpace(record[0])
+		if (len(token) == 0 && len(record) == 1) || (len(res) == 0 && token == "number") {
+			continue
+		}
+		num, err := strconv.Atoi(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pull request number in line: %s", strings.Join(record, ","))
+		}
+		res = append(res, num)
+	}
+}
+
+// Batch downstreams each of the pull requests of the given request onto its
+// own branch, just like Downstream, and returns the outcome of each of them.
+// Unless the pull requests are combined, a pull request is opened for each
+// of them as required by the downstream request. A non-nil error is returned
+// if any pull request could not be downstreamed due to a failure.
+func Batch(ctx context.Context, git utils.GitHelper, p provider.Provider, req *BatchRequest) (*BatchReport, error) {
+	pulls, err := batchPullRequests(ctx, git, p, req)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("downstreaming %d pull requests", len(pulls))
+
+	// the conflict resolutions cache is pulled once for all
+	if len(req.Downstream.RerereBranch) > 0 {
+		logrus.Infof("pulling conflict resolutions cache from branch '%s'", req.Downstream.RerereBranch)
+		err := branchdb.Pull(git, req.Downstream.RerereRemote, req.Downstream.RerereBranch, utils.RerereCacheDir, !req.Downstream.PreserveTempBranches)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := &BatchReport{}
+	err = downstreamBatchPullRequests(ctx, git, p, req, pulls, report)
+	if req.Combined {
+		if err == nil {
+			err = combineBatch(ctx, git, p, req, report)
+		}
+		if !req.Downstream.PreserveTempBranches {
+			for _, e := range report.Entries {
+				if len(e.Branch) > 0 {
+					git.Do("branch", "-D", e.Branch)
+				}
+			}
+		}
+	}
+	if err != nil {
+		return report, err
+	}
+
+	if n := report.count(DownstreamFailed); n > 0 {
+		return report, fmt.Errorf("%d pull requests could not be downstreamed", n)
+	}
+	return report, nil
+}
+
+// downstreams each of the given pull requests and adds its outcome to the
+// report. Returns a non-nil error if the batch can't proceed, in which case
+// the report contains the pull requests processed up until the failure.
+func downstreamBatchPullRequests(ctx context.Context, git utils.GitHelper, p provider.Provider, req *BatchRequest, pulls []*github.PullRequest, report *BatchReport) error {
+	var err error
+	for _, pr := range pulls {
+		entry := &BatchEntry{Number: pr.GetNumber(), URL: pr.GetHTMLURL(), Title: pr.GetTitle(), Status: DownstreamFailed}
+		report.Entries = append(report.Entries, entry)
+		entry.Branch, err = req.Branch(pr.GetNumber())
+		if err != nil {
+			entry.Error = err.Error()
+			return err
+		}
+
+		dreq := req.Downstream
+		dreq.Branch = entry.Branch
+		dreq.UpstreamPullRequestNum = pr.GetNumber()
+		dreq.RerereBranch = ""
+		if req.Combined {
+			// each pull request is ported locally, and the branches
+			// are combined once all of them are done
+			dreq.PushAndOpenPullRequest = false
+			dreq.PreserveTempBranches = true
+			existing, err := findDownstreamPullRequest(ctx, p, &dreq)
+			if err != nil {
+				entry.Error = err.Error()
+				return err
+			}
+			if existing != nil {
+				logrus.Warnf("skipping pull request #%d due to changes being already downstreamed: %s", pr.GetNumber(), existing.GetHTMLURL())
+				entry.Status = DownstreamAlreadyPorted
+				continue
+			}
+		}
+
+		logrus.Infof("downstreaming pull request #%d: %s", pr.GetNumber(), pr.GetHTMLURL())
+		entry.Status, err = downstream(ctx, git, p, &dreq)
+		if err != nil {
+			logrus.Errorf("failure in downstreaming pull request #%d: %s", pr.GetNumber(), err.Error())
+			entry.Error = err.Error()
+		}
+		entry.Branch = dreq.Branch
+	}
+	return nil
+}
+
+// returns the upstream pull requests of the given batch request, in order
+// of application
+func batchPullRequests(ctx context.Context, git utils.GitHelper, p provider.Provider, req *BatchRequest) ([]*github.PullRequest, error) {
+	var pulls []*github.PullRequest
+	if len(req.PullRequestNums) > 0 {
+		for _, num := range req.PullRequestNums {
+			pr, err := p.GetPullRequest(ctx, req.Downstream.UpstreamOrg, req.Downstream.UpstreamRepo, num)
+			if err != nil {
+				return nil, err
+			}
+			pulls = append(pulls, pr)
+		}
+	} else {
+		suggested, err := suggestPullRequests(ctx, git, p, req.Suggest)
+		if err != nil {
+			return nil, err
+		}
+		// note: suggestions are sorted from the most recently merged, and
+		// applying the oldest first minimizes merge conflicts
+		for i := len(suggested) - 1; i >= 0; i-- {
+			pulls = append(pulls, suggested[i].pr)
+		}
+	}
+
+	if len(req.Labels) == 0 {
+		return pulls, nil
+	}
+	var res []*github.PullRequest
+	for _, pr := range pulls {
+		if hasAnyLabel(pr, req.Labels) {
+			res = append(res, pr)
+		} else {
+			logrus.Debugf("skipping pull request #%d without any of labels '%s'", pr.GetNumber(), strings.Join(req.Labels, "', '"))
+		}
+	}
+	return res, nil
+}
+
+func hasAnyLabel(pr *github.PullRequest, labels []string) bool {
+	for _, l := range pr.Labels {
+		for _, label := range labels {
+			if l.GetName() == label {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ports all the pull requests of the batch downstreamed successfully into the
+// combined branch, pushes it into the fork, and opens a pull request for it
+// or updates the one already open. The pull requests whose changes are already
+// in the fork or conflict with the other ones of the batch are left out.
+func combineBatch(ctx context.Context, git utils.GitHelper, p provider.Provider, req *BatchRequest, report *BatchReport) error {
+	dreq := &req.Downstream
+	forkHead := fmt.Sprintf("origin/%s", dreq.ForkHeadRef)
+	var combined []*BatchEntry
+	logrus.Infof("combining downstreamed pull requests in branch '%s'", req.CombinedBranch)
+	err := utils.WithTempLocalBranch(git, req.CombinedBranch, "origin", dreq.ForkHeadRef, func() (bool, error) {
+		for _, e := range report.Entries {
+			if e.Status != DownstreamSucceeded {
+				continue
+			}
+			diff, err := git.DoOutput("diff", forkHead, e.Branch)
+			if err != nil {
+				return !dreq.PreserveTempBranches, err
+			}
+			if len(diff) == 0 {
+				logrus.Warnf("changes of pull request #%d are already in the fork, skipping", e.Number)
+				e.Status = DownstreamAlreadyPorted
+				continue
+			}
+			logrus.Infof("picking commits of pull request #%d from branch '%s'", e.Number, e.Branch)
+			out, err := git.DoOutput("-c", "rerere.enabled=true", "cherry-pick", "--allow-empty", fmt.Sprintf("%s..%s", forkHead, e.Branch))
+			if err != nil {
+				logrus.Errorf("pull request #%d conflicts with the other ones of the batch, skipping", e.Number)
+				e.Status = DownstreamConflicted
+				e.Error = fmt.Sprintf("conflicts with the other pull requests of the batch: %s", out)
+				if err := git.Do("cherry-pick", "--abort"); err != nil {
+					return !dreq.PreserveTempBranches, err
+				}
+				continue
+			}
+			combined = append(combined, e)
+		}
+		if len(combined) == 0 {
+			logrus.Warnf("no pull request to be combined, skipping")
+			return true, nil
+		}
+		report.CombinedBranch = req.CombinedBranch
+		if !req.Downstream.PushAndOpenPullRequest {
+			return false, nil
+		}
+		return !dreq.PreserveTempBranches, pushAndOpenCombinedPullRequest(ctx, git, p, req, combined)
+	})
+	return err
+}
+
+// pushes the combined branch of a batch into the fork and opens a pull
+// request for it, or updates the one already open for the same branch
+func pushAndOpenCombinedPullRequest(ctx context.Context, git utils.GitHelper, p provider.Provider, req *BatchRequest, entries []*BatchEntry) error {
+	dreq := &req.Downstream
+	logrus.Infof("pushing branch '%s' into %s/%s", req.CombinedBranch, dreq.ForkOrg, dreq.ForkRepo)
+	if err := git.Do("push", "-f", "origin", req.CombinedBranch); err != nil {
+		logrus.Errorf("failure in pushing branch into fork: %s", req.CombinedBranch)
+		return err
+	}
+
+	title := fmt.Sprintf("%sport of %d upstream pull requests into %s", batchPullRequestTitlePrefix, len(entries), dreq.ForkHeadRef)
+	body := formatCombinedPullRequestBody(p.Links(), dreq, entries)
+
+	logrus.Infof("checking if a pull request has already been opened for the same branch")
+	searchRes, err := p.SearchPullRequests(ctx, dreq.ForkOrg, dreq.ForkRepo, batchPullRequestTitlePrefix)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("search found %d results", len(searchRes))
+	for _, found := range searchRes {
+		logrus.Debugf("checking search result %s", found.GetHTMLURL())
+		// note: some providers mark drafts with a prefix in the title
+		if !strings.HasPrefix(provider.TrimDraftTitlePrefix(found.GetTitle()), batchPullRequestTitlePrefix) || found.GetState() != "open" {
+			continue
+		}
+		// note: search results don't contain the head branch
+		existing, err := p.GetPullRequest(ctx, dreq.ForkOrg, dreq.ForkRepo, found.GetNumber())
+		if err != nil {
+			return err
+		}
+		if existing.GetHead().GetRef() != req.CombinedBranch {
+			continue
+		}
+		logrus.Infof("updating existing pull request for the same branch: %s", existing.GetHTMLURL())
+		_, err = p.EditPullRequest(ctx, dreq.ForkOrg, dreq.ForkRepo, existing.GetNumber(), &github.PullRequest{
+			Title: &title,
+			Body:  &body,
+		})
+		if err != nil {
+			logrus.Errorf("failure in updating pull request: %s", err.Error())
+			return err
+		}
+		logrus.Infof("pull request updated successfully: %s", existing.GetHTMLURL())
+		return nil
+	}
+
+	logrus.Infof("opening new pull request in %s/%s", dreq.ForkOrg, dreq.ForkRepo)
+	pr, err := p.CreatePullRequest(ctx, dreq.ForkOrg, dreq.ForkRepo, &github.NewPullRequest{
+		Title: &title,
+		Head:  &req.CombinedBranch,
+		Base:  &dreq.ForkHeadRef,
+		Body:  &body,
+	})
+	if err != nil {
+		logrus.Errorf("failure in opening pull request: %s", err.Error())
+		return err
+	}
+	logrus.Infof("pull request opened successfully: %s", pr.GetHTMLURL())
+	return nil
+}
+
+// formats the body of the combined pull request of a batch in markdown
+func formatCombinedPullRequestBody(links *provider.Links, req *DownstreamRequest, entries []*BatchEntry) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Downstream of %d pull requests of upstream %s/%s.\n\n", len(entries), req.UpstreamOrg, req.UpstreamRepo))
+	for _, e := range entries {
+		b.WriteString(fmt.Sprintf("* Ref: %s %s\n", links.PullRequest(req.UpstreamOrg, req.UpstreamRepo, e.Number), e.Title))
+	}
+	return b.String()
+}
+
+// counts the entries having the given status
+func (r *BatchReport) count(s DownstreamStatus) int {
+	res := 0
+	for _, e := range r.Entries {
+		if e.Status == s {
+			res++
+		}
+	}
+	return res
+}
+
+// WriteText writes a summary of the outcome of each pull request of the batch
+func (r *BatchReport) WriteText(w io.Writer) {
+	var counts []string
+	for _, s := range []DownstreamStatus{DownstreamSucceeded, DownstreamConflicted, DownstreamAlreadyPorted, DownstreamSkipped, DownstreamFailed} {
+		counts = append(counts, fmt.Sprintf("%d %s", r.count(s), s))
+	}
+	fmt.Fprintf(w, "downstream batch of %d pull requests: %s\n", len(r.Entries), strings.Join(counts, ", "))
+	if len(r.CombinedBranch) > 0 {
+		fmt.Fprintf(w, "combined branch: %s\n", r.CombinedBranch)
+	}
+	for _, e := range r.Entries {
+		fmt.Fprintf(w, "%-14s #%d %s (%s) # %s\n", e.Status, e.Number, e.URL, e.Branch, e.Title)
+		if len(e.Error) > 0 {
+			fmt.Fprintf(w, "    %s\n", strings.ReplaceAll(e.Error, "\n", "\n    "))
+		}
+	}
+}
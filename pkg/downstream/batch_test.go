@@ -0,0 +1,170 @@
+package downstream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBatchProvider struct {
+	fakeSearchProvider
+	pulls map[int]*github.PullRequest
+}
+
+func (f *fakeBatchProvider) GetPullRequest(ctx context.Context, org, repo string, num int) (*github.PullRequest, error) {
+	return f.pulls[num], nil
+}
+
+func TestBatch(t *testing.T) {
+	t.Run("read-nums", func(t *testing.T) {
+		input := "# suggested\n12, https://github.com/org/repo/pull/12, fix: one\n\n34\n56\n"
+		nums, err := ReadPullRequestNums(strings.NewReader(input))
+		require.NoError(t, err)
+		assert.Equal(t, []int{12, 34, 56}, nums)
+
+		_, err = ReadPullRequestNums(strings.NewReader("https://github.com/org/repo/pull/12\n"))
+		assert.Error(t, err)
+
+		// titles may contain quotes and, in CSV, quoted newlines
+		input = "12, https://github.com/org/repo/pull/12, \"fix\": one\n  \n34, https://github.com/org/repo/pull/34, fix: \"two\n"
+		nums, err = ReadPullRequestNums(strings.NewReader(input))
+		require.NoError(t, err)
+		assert.Equal(t, []int{12, 34}, nums)
+		input = "number,url,title\n12,https://github.com/org/repo/pull/12,\"fix: one\nmore, lines\"\n34,https://github.com/org/repo/pull/34,fix: two\n"
+		nums, err = ReadPullRequestNums(strings.NewReader(input))
+		require.NoError(t, err)
+		assert.Equal(t, []int{12, 34}, nums)
+	})
+
+	t.Run("label-filter", func(t *testing.T) {
+		p := &fakeBatchProvider{pulls: map[int]*github.PullRequest{
+			1: {Number: github.Int(1), Labels: []*github.Label{{Name: github.String("bug")}}},
+			2: {Number: github.Int(2)},
+			3: {Number: github.Int(3), Labels: []*github.Label{{Name: github.String("docs")}, {Name: github.String("bug")}}},
+			4: {Number: github.Int(4), Labels: []*github.Label{{Name: github.String("feature")}}},
+		}}
+		req := &BatchRequest{PullRequestNums: []int{4, 3, 2, 1}, Labels: []string{"bug"}}
+		pulls, err := batchPullRequests(context.Background(), nil, p, req)
+		require.NoError(t, err)
+		require.Len(t, pulls, 2)
+		assert.Equal(t, 3, pulls[0].GetNumber())
+		assert.Equal(t, 1, pulls[1].GetNumber())
+
+		req.Labels = []string{"feature", "bug"}
+		pulls, err = batchPullRequests(context.Background(), nil, p, req)
+		require.NoError(t, err)
+		require.Len(t, pulls, 3)
+		assert.Equal(t, 4, pulls[0].GetNumber())
+	})
+
+	t.Run("partial-report", func(t *testing.T) {
+		p := &fakeBatchProvider{
+			fakeSearchProvider: fakeSearchProvider{found: []*github.PullRequest{
+				{Number: github.Int(10), Title: github.String("downstream(#1): fix: one"), State: github.String("open")},
+			}},
+			pulls: map[int]*github.PullRequest{
+				1: {Number: github.Int(1), Title: github.String("fix: one")},
+				2: {Number: github.Int(2), Title: github.String("fix: two")},
+			},
+		}
+		req := &BatchRequest{
+			PullRequestNums: []int{1, 2},
+			Combined:        true,
+			Branch: func(num int) (string, error) {
+				if num == 2 {
+					return "", fmt.Errorf("can't name branch")
+				}
+				return fmt.Sprintf("b%d", num), nil
+			},
+			Downstream: DownstreamRequest{PreserveTempBranches: true},
+		}
+		r, err := Batch(context.Background(), &fakeDownstreamGit{}, p, req)
+		assert.Error(t, err)
+		require.NotNil(t, r)
+		require.Len(t, r.Entries, 2)
+		assert.Equal(t, DownstreamAlreadyPorted, r.Entries[0].Status)
+		assert.Equal(t, DownstreamFailed, r.Entries[1].Status)
+		assert.Equal(t, "can't name branch", r.Entries[1].Error)
+	})
+
+	t.Run("combined", func(t *testing.T) {
+		pick := func(branch string) string {
+			return "-c rerere.enabled=true cherry-pick --allow-empty origin/main.." + branch
+		}
+		newGit := func() *fakeDownstreamGit {
+			return &fakeDownstreamGit{
+				fakeConflictGit: fakeConflictGit{fakeMatchGit{
+					outputs: map[string]string{
+						"diff origin/main b1": "",
+						"diff origin/main b2": "some diff",
+						"diff origin/main b3": "some diff",
+						pick("b2"):            "CONFLICT (content): Merge conflict in a.txt",
+						pick("b3"):            "",
+					},
+					fails: map[string]bool{pick("b2"): true},
+				}},
+				branch: "main",
+			}
+		}
+		newReport := func() *BatchReport {
+			return &BatchReport{Entries: []*BatchEntry{
+				{Number: 1, Status: DownstreamSucceeded, Branch: "b1"},
+				{Number: 2, Status: DownstreamSucceeded, Branch: "b2"},
+				{Number: 3, Status: DownstreamSucceeded, Branch: "b3"},
+				{Number: 4, Status: DownstreamConflicted, Branch: "b4"},
+			}}
+		}
+		req := &BatchRequest{
+			Downstream:     DownstreamRequest{ForkHeadRef: "main"},
+			Combined:       true,
+			CombinedBranch: "batch",
+		}
+
+		// changes already in the fork and conflicting with the other pull
+		// requests are skipped, and the conflicting cherry-pick is aborted
+		git := newGit()
+		r := newReport()
+		require.NoError(t, combineBatch(context.Background(), git, &fakeBatchProvider{}, req, r))
+		assert.Equal(t, "batch", r.CombinedBranch)
+		assert.Equal(t, DownstreamAlreadyPorted, r.Entries[0].Status)
+		assert.Equal(t, DownstreamConflicted, r.Entries[1].Status)
+		assert.Contains(t, r.Entries[1].Error, "conflicts with the other pull requests of the batch")
+		assert.Equal(t, DownstreamSucceeded, r.Entries[2].Status)
+		assert.Equal(t, DownstreamConflicted, r.Entries[3].Status)
+		assert.Contains(t, git.commands, "cherry-pick --abort")
+
+		// a failure in aborting the cherry-pick stops the batch
+		git = newGit()
+		git.doFails = map[string]bool{"cherry-pick --abort": true}
+		r = newReport()
+		assert.Error(t, combineBatch(context.Background(), git, &fakeBatchProvider{}, req, r))
+		assert.Empty(t, r.CombinedBranch)
+		assert.Equal(t, DownstreamSucceeded, r.Entries[2].Status)
+
+		// nothing is combined if all the pull requests are skipped
+		git = newGit()
+		r = newReport()
+		r.Entries = r.Entries[:2]
+		require.NoError(t, combineBatch(context.Background(), git, &fakeBatchProvider{}, req, r))
+		assert.Empty(t, r.CombinedBranch)
+	})
+
+	t.Run("report", func(t *testing.T) {
+		r := &BatchReport{Entries: []*BatchEntry{
+			{Number: 1, URL: "https://github.com/org/repo/pull/1", Title: "fix: one", Status: DownstreamSucceeded, Branch: "b1"},
+			{Number: 2, URL: "https://github.com/org/repo/pull/2", Title: "fix: two", Status: DownstreamConflicted, Branch: "b2", Error: "merge conflict\non commit"},
+			{Number: 3, URL: "https://github.com/org/repo/pull/3", Title: "fix: three", Status: DownstreamAlreadyPorted, Branch: "b3"},
+		}}
+		var b bytes.Buffer
+		r.WriteText(&b)
+		out := b.String()
+		assert.Contains(t, out, "downstream batch of 3 pull requests: 1 succeeded, 1 conflicted, 1 already-ported, 0 skipped, 0 failed\n")
+		assert.Contains(t, out, "conflicted     #2 https://github.com/org/repo/pull/2 (b2) # fix: two\n    merge conflict\n    on commit\n")
+	})
+}
@@ -0,0 +1,214 @@
+package downstream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/sync"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// pickConflict describes an upstream commit whose merge conflicts can't be
+// recovered automatically, and that requires manual intervention
+type pickConflict struct {
+	SHA   string
+	Title string
+	// Conflicts are the merge conflicts that have not been recovered
+	Conflicts []string
+	// Picked and Remaining are the upstream commits respectively picked
+	// before and remaining after the conflicting one
+	Picked    []string
+	Remaining []string
+	// Parked is true if the conflicting state is committed on top of the
+	// downstream branch
+	Parked bool
+}
+
+// returns the sync request equivalent to the given downstream request, used
+// for recovering from the merge conflicts just like during a sync
+func newSyncRequest(req *DownstreamRequest) *sync.Request {
+	return &sync.Request{
+		UpstreamOrg:     req.UpstreamOrg,
+		UpstreamRepo:    req.UpstreamRepo,
+		UpstreamHeadRef: req.UpstreamHeadRef,
+		ForkOrg:         req.ForkOrg,
+		ForkRepo:        req.ForkRepo,
+		ForkHeadRef:     req.ForkHeadRef,
+		OutBranch:       req.Branch,
+		PicksUpstream:   true,
+	}
+}
+
+// attempts recovering from the merge conflicts of a failed cherry-pick of the
+// given upstream commit, and completes the cherry-pick if succeeding. Returns a
+// non-nil pickConflict if manual intervention is required, in which case the
+// cherry-pick is left in progress.
+// note: differently from a sync, HEAD is the fork and the picked commit is
+// the upstream one, however recovery only depends on the picked commit markers
+// and the sides are only swapped in the logs
+func recoverPickConflicts(git utils.GitHelper, links *provider.Links, req *DownstreamRequest, hash, out string) (*pickConflict, error) {
+	msg, err := git.DoOutput("log", "-1", "--format=%B", hash)
+	if err != nil {
+		return nil, fmt.Errorf("can't retrieve message of commit %s: %s", hash, msg)
+	}
+	commit := &github.RepositoryCommit{SHA: &hash, Commit: &github.Commit{Message: &msg}}
+	recoveryErr := sync.RecoverPickConflicts(git, out, newSyncRequest(req), links, commit)
+	if recoveryErr != nil {
+		conflicts, ok := sync.UnrecoveredConflicts(recoveryErr)
+		if !ok {
+			return nil, recoveryErr
+		}
+		logrus.Warnf("merge conflicts of commit %s can't be recovered automatically: %s", hash, recoveryErr.Error())
+		return &pickConflict{SHA: hash, Title: strings.Split(msg, "\n")[0], Conflicts: conflicts}, nil
+	}
+
+	logrus.Warnf("merge conflicts of commit %s recovered automatically, proceeding", hash)
+	hasChanges, err := git.HasLocalChanges()
+	if err != nil {
+		return nil, err
+	}
+	if !hasChanges {
+		logrus.Warn("cherry-pick is now empty possibly due to conflict resolution, skipping commit")
+		return nil, git.Do("cherry-pick", "--skip")
+	}
+	return nil, git.Do("cherry-pick", "--continue")
+}
+
+// commits the conflicting state of the cherry-pick in progress on top of the
+// downstream branch, so that it can be pushed and solved manually
+func parkConflict(git utils.GitHelper, links *provider.Links, req *DownstreamRequest, conflict *pickConflict) error {
+	logrus.Infof("committing conflicting state of commit %s in branch '%s'", conflict.SHA, req.Branch)
+	msg := fmt.Sprintf("%s\n\nUnsolved merge conflicts of %s (%s)\n",
+		conflict.Title, conflict.SHA, links.Commit(req.UpstreamOrg, req.UpstreamRepo, conflict.SHA))
+	if err := sync.CommitConflictState(git, msg); err != nil {
+		return err
+	}
+	conflict.Parked = true
+	return nil
+}
+
+// conflictError is returned when the merge conflicts of a downstream can't
+// be recovered automatically and the downstream is not pushed
+type conflictError struct {
+	// Suggestion is the guidance on how to solve the conflicts manually
+	Suggestion string
+	err        error
+}
+
+func (e *conflictError) Error() string {
+	return e.err.Error()
+}
+
+func (e *conflictError) Unwrap() error {
+	return e.err
+}
+
+// ConflictSuggestion returns the guidance on how to solve manually the merge
+// conflicts that caused the given downstream error, and false if the error
+// is not caused by merge conflicts
+func ConflictSuggestion(err error) (string, bool) {
+	var conflictErr *conflictError
+	if !errors.As(err, &conflictErr) {
+		return "", false
+	}
+	return conflictErr.Suggestion, true
+}
+
+type conflictSuggestionInfo struct {
+	*pickConflict
+	UpstreamPullRequestURL string
+	ConflictCommitURL      string
+	UpstreamCloneURL       string
+	UpstreamFetchRefs      string
+	ForkRepo               string
+	ForkCloneURL           string
+	ForkHeadRef            string
+	BranchName             string
+	BranchURL              string
+}
+
+func (i *conflictSuggestionInfo) ProjectRepo() string {
+	return utils.ProjectRepo
+}
+
+func (i *conflictSuggestionInfo) ProjectName() string {
+	return utils.ProjectName
+}
+
+// formats the guidance on how to solve manually the merge conflicts of
+// the given commit and complete the downstream in markdown
+func formatConflictSuggestion(links *provider.Links, req *DownstreamRequest, conflict *pickConflict) string {
+	info := &conflictSuggestionInfo{
+		pickConflict:           conflict,
+		UpstreamPullRequestURL: links.PullRequest(req.UpstreamOrg, req.UpstreamRepo, req.UpstreamPullRequestNum),
+		ConflictCommitURL:      links.Commit(req.UpstreamOrg, req.UpstreamRepo, conflict.SHA),
+		UpstreamCloneURL:       links.Repo(req.UpstreamOrg, req.UpstreamRepo),
+		UpstreamFetchRefs:      fmt.Sprintf("%s %s", req.UpstreamHeadRef, links.PullRequestHeadRef(req.UpstreamPullRequestNum)),
+		ForkRepo:               req.ForkRepo,
+		ForkCloneURL:           links.SSHClone(req.ForkOrg, req.ForkRepo),
+		ForkHeadRef:            req.ForkHeadRef,
+		BranchName:             req.Branch,
+		BranchURL:              links.Tree(req.ForkOrg, req.ForkRepo, req.Branch),
+	}
+	b := bytes.Buffer{}
+	err := conflictSuggestion.Execute(&b, info)
+	if err != nil {
+		panic("failure when executing template: " + err.Error())
+	}
+	return b.String()
+}
+
+var conflictSuggestion = template.Must(template.New("conflictSuggestion").Funcs(template.FuncMap{"join": strings.Join}).Parse(strings.TrimSpace(`
+Context:
+
+* A merge conflict occurred while downstreaming {{ .UpstreamPullRequestURL }} and can't be resolved automatically
+* Conflicting commit: {{ .ConflictCommitURL }}
+* Conflicts:
+{{- range .Conflicts }}
+  * ` + "`" + `{{ . }}` + "`" + `
+{{- end }}
+{{- if .Parked }}
+* In-progress downstream branch: {{ .BranchURL }}
+{{- end }}
+
+Action items:
+
+1. Make sure to have installed both ` + "`" + `git` + "`" + ` and ` + "`" + `{{ .ProjectName }}` + "`" + ` ({{ .ProjectRepo }}#installing).
+2. Checkout fork repo and cd into it:
+   ` + "`" + `cd /tmp && git clone {{ .ForkCloneURL }} && cd {{ .ForkRepo }}` + "`" + `
+3. Make sure ` + "`" + `git rerere` + "`" + ` is enabled in the repo and pull latest cached resolutions:
+   ` + "`" + `git config rerere.enabled true` + "`" + `
+   ` + "`" + `{{ .ProjectName }} conflict pull` + "`" + `
+4. Fetch the upstream commits:
+   ` + "`" + `git fetch {{ .UpstreamCloneURL }} {{ .UpstreamFetchRefs }}` + "`" + `
+{{- if .Parked }}
+5. Checkout the downstream branch and drop its last commit, which contains the unsolved merge conflicts:
+   ` + "`" + `git fetch origin` + "`" + `
+   ` + "`" + `git checkout {{ .BranchName }}` + "`" + `
+   ` + "`" + `git reset --hard HEAD~1` + "`" + `
+{{- else }}
+5. Create the downstream branch and apply the commits preceding the conflicting one:
+   ` + "`" + `git fetch origin` + "`" + `
+   ` + "`" + `git checkout -B {{ .BranchName }} origin/{{ .ForkHeadRef }}` + "`" + `
+{{- if .Picked }}
+   ` + "`" + `git cherry-pick {{ join .Picked " " }}` + "`" + `
+{{- end }}
+{{- end }}
+6. Apply the conflicting commit, solve the conflict manually, and commit it{{ if .Remaining }}, then apply the remaining commits{{ end }}:
+   ` + "`" + `git cherry-pick {{ .SHA }}` + "`" + `
+   ... solve conflicts manually and stage all changes...
+   ` + "`" + `git cherry-pick --continue` + "`" + `
+{{- if .Remaining }}
+   ` + "`" + `git cherry-pick {{ join .Remaining " " }}` + "`" + `
+{{- end }}
+7. Update fork's conflict resolution cache so that this won't be asked again:
+   ` + "`" + `{{ .ProjectName }} conflict push` + "`" + `
+8. Push the downstream branch:
+   ` + "`" + `git push -f origin {{ .BranchName }}` + "`" + `
+`)))
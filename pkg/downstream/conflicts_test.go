@@ -0,0 +1,69 @@
+package downstream
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConflictGit struct {
+	fakeMatchGit
+}
+
+func (f *fakeConflictGit) GetRepoRootDir() (string, error) {
+	return os.Getwd()
+}
+
+func TestPickConflicts(t *testing.T) {
+	req := &DownstreamRequest{
+		Branch:                 "downstream-1",
+		UpstreamOrg:            "org",
+		UpstreamRepo:           "repo",
+		UpstreamHeadRef:        "master",
+		UpstreamPullRequestNum: 1,
+		ForkOrg:                "fork",
+		ForkRepo:               "repo",
+		ForkHeadRef:            "main",
+	}
+	links := (&fakeLinksProvider{}).Links()
+
+	t.Run("unrecovered", func(t *testing.T) {
+		git := &fakeConflictGit{fakeMatchGit{
+			outputs: map[string]string{
+				"log -1 --format=%B u1": "fix: one\n\nSome description.",
+				"diff --check":          "a.txt:1: leftover conflict marker\na.txt:3: leftover conflict marker",
+			},
+			fails: map[string]bool{"diff --check": true},
+		}}
+		conflict, err := recoverPickConflicts(git, links, req, "u1", "CONFLICT (content): Merge conflict in a.txt")
+		require.NoError(t, err)
+		require.NotNil(t, conflict)
+		assert.Equal(t, "u1", conflict.SHA)
+		assert.Equal(t, "fix: one", conflict.Title)
+		assert.Equal(t, []string{"content: a.txt"}, conflict.Conflicts)
+	})
+
+	t.Run("suggestion", func(t *testing.T) {
+		conflict := &pickConflict{
+			SHA:       "u2",
+			Title:     "fix: two",
+			Conflicts: []string{"content: a.txt"},
+			Picked:    []string{"u1"},
+			Remaining: []string{"u3", "u4"},
+		}
+		s := formatConflictSuggestion(links, req, conflict)
+		assert.Contains(t, s, "* Conflicting commit: https://github.com/org/repo/commit/u2")
+		assert.Contains(t, s, "  * `content: a.txt`")
+		assert.Contains(t, s, "`git checkout -B downstream-1 origin/main`\n   `git cherry-pick u1`")
+		assert.Contains(t, s, "`git cherry-pick u3 u4`")
+		assert.NotContains(t, s, "In-progress downstream branch")
+
+		conflict.Parked = true
+		s = formatConflictSuggestion(links, req, conflict)
+		assert.Contains(t, s, "* In-progress downstream branch: https://github.com/fork/repo/tree/downstream-1")
+		assert.Contains(t, s, "`git reset --hard HEAD~1`")
+		assert.NotContains(t, s, "git cherry-pick u1")
+	})
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/google/go-github/v56/github"
 	"github.com/hashicorp/go-multierror"
+	"github.com/jasondellaluce/synchro/pkg/branchdb"
+	"github.com/jasondellaluce/synchro/pkg/provider"
 	"github.com/jasondellaluce/synchro/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -23,153 +26,301 @@ type DownstreamRequest struct {
 	ForkHeadRef            string
 	PreserveTempBranches   bool
 	PushAndOpenPullRequest bool
+	// Refresh requires updating the branch and the pull request of a
+	// pre-merge downstream, in case the upstream pull request has been
+	// merged or updated since
+	Refresh bool
+	// RerereRemote and RerereBranch are the storage branch from which the
+	// conflict resolutions cache is pulled before picking the commits, which
+	// is not pulled if the branch is empty
+	RerereRemote string
+	RerereBranch string
 }
 
-func Downstream(ctx context.Context, git utils.GitHelper, client *github.Client, req *DownstreamRequest) error {
+// PreMergeLabel is the label of the fork pull requests downstreaming
+// upstream pull requests that are not merged yet
+const PreMergeLabel = "pre-merge"
+
+// preMergeBodyHeader prefixes the line of the body of a pre-merge fork
+// pull request in which the downstreamed upstream head SHA is recorded
+const preMergeBodyHeader = "Pre-merge upstream head:"
+
+var rgxPreMergeHead = regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(preMergeBodyHeader) + ` ([0-9a-fA-F]+)`)
+
+// returns the upstream head SHA recorded in the body of a pre-merge fork
+// pull request, or an empty string if the pull request is not pre-merge
+func preMergeHead(body string) string {
+	if m := rgxPreMergeHead.FindStringSubmatch(body); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// returns the reason for which a pre-merge downstream recording the given
+// upstream head SHA is outdated, or an empty string if it is up to date
+func preMergeOutdatedReason(upstreamPR *github.PullRequest, merged bool, recordedHead string) string {
+	if merged {
+		return "the upstream pull request has been merged"
+	}
+	if upstreamPR.GetHead().GetSHA() != recordedHead {
+		return fmt.Sprintf("the upstream pull request has been updated or force-pushed (head %s, downstreamed %s)", upstreamPR.GetHead().GetSHA(), recordedHead)
+	}
+	return ""
+}
+
+// DownstreamStatus is the outcome of downstreaming an upstream pull request
+type DownstreamStatus string
+
+const (
+	// DownstreamSucceeded is used when all the commits have been ported
+	DownstreamSucceeded DownstreamStatus = "succeeded"
+
+	// DownstreamConflicted is used when the merge conflicts of a commit
+	// require manual intervention
+	DownstreamConflicted DownstreamStatus = "conflicted"
+
+	// DownstreamAlreadyPorted is used when the changes have already been
+	// downstreamed, or are already in the fork
+	DownstreamAlreadyPorted DownstreamStatus = "already-ported"
+
+	// DownstreamSkipped is used when the pull request has been closed
+	// without being merged
+	DownstreamSkipped DownstreamStatus = "skipped"
+
+	// DownstreamFailed is used when an error occurred
+	DownstreamFailed DownstreamStatus = "failed"
+)
+
+func (s DownstreamStatus) String() string {
+	return string(s)
+}
+
+func Downstream(ctx context.Context, git utils.GitHelper, p provider.Provider, req *DownstreamRequest) error {
+	_, err := downstream(ctx, git, p, req)
+	return err
+}
+
+// returns the fork pull request downstreaming the upstream pull request of
+// the given request, preferring the open ones, or nil if there is none
+func findDownstreamPullRequest(ctx context.Context, p provider.Provider, req *DownstreamRequest) (*github.PullRequest, error) {
+	logrus.Infof("checking if a pull request has already been opened for the same changes")
+	var res *github.PullRequest
+	titlePrefix := fmt.Sprintf("downstream(#%d): ", req.UpstreamPullRequestNum)
+	searchRes, err := p.SearchPullRequests(ctx, req.ForkOrg, req.ForkRepo, titlePrefix)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("search found %d results", len(searchRes))
+	for _, found := range searchRes {
+		logrus.Debugf("checking search result %s", found.GetHTMLURL())
+		// note: some providers mark drafts, such as the conflicted
+		// downstreams, with a prefix in the title
+		if strings.HasPrefix(provider.TrimDraftTitlePrefix(found.GetTitle()), titlePrefix) {
+			logrus.Infof("found existing pull request downstreaming same changes: %s", found.GetHTMLURL())
+			if res == nil || found.GetState() == "open" {
+				res = found
+			}
+		}
+	}
+	return res, nil
+}
+
+// downstreams the upstream pull request of the given request, and returns
+// the outcome of it
+func downstream(ctx context.Context, git utils.GitHelper, p provider.Provider, req *DownstreamRequest) (DownstreamStatus, error) {
 	// check that the current repo is the actual fork and the tool
 	// is not erroneously run from the wrong repo
 	logrus.Infof("checking that the current repo is the fork one")
 	remotes, err := git.GetRemotes()
 	if err != nil {
-		return err
+		return DownstreamFailed, err
 	}
 	if len(remotes) == 0 {
-		return fmt.Errorf("can't find any remotes in current repo")
+		return DownstreamFailed, fmt.Errorf("can't find any remotes in current repo")
 	}
 	if originRemote, ok := remotes["origin"]; !ok {
-		return fmt.Errorf("can't find `origin` remote in current repo")
+		return DownstreamFailed, fmt.Errorf("can't find `origin` remote in current repo")
 	} else if !strings.Contains(originRemote, fmt.Sprintf("%s/%s", req.ForkOrg, req.ForkRepo)) {
-		return fmt.Errorf("current repo `origin` remote does not match the fork's one: %s", originRemote)
+		return DownstreamFailed, fmt.Errorf("current repo `origin` remote does not match the fork's one: %s", originRemote)
 	}
 
 	logrus.Infof("retrieving pull request #%d from %s/%s\n", req.UpstreamPullRequestNum, req.UpstreamOrg, req.UpstreamRepo)
-	pr, _, err := client.PullRequests.Get(ctx, req.UpstreamOrg, req.UpstreamRepo, req.UpstreamPullRequestNum)
+	pr, err := p.GetPullRequest(ctx, req.UpstreamOrg, req.UpstreamRepo, req.UpstreamPullRequestNum)
 	if err != nil {
-		return err
+		return DownstreamFailed, err
 	}
 
-	if (pr.Merged == nil || !pr.GetMerged()) || (pr.MergedAt == nil) {
-		// todo: support downstreaming unmerged PRs
-		logrus.Warnf("unmerged pull requests are currently not supported for downstreaming, skipping")
-		return nil
+	merged := pr.GetMerged() && pr.MergedAt != nil
+	if !merged && pr.GetState() != "open" {
+		logrus.Warnf("pull request has been closed without being merged, skipping")
+		return DownstreamSkipped, nil
+	}
+	if !merged {
+		logrus.Infof("pull request is not merged yet, downstreaming it as %s at head %s", PreMergeLabel, pr.GetHead().GetSHA())
 	}
 
-	logrus.Infof("checking if a pull request has already been opened for the same changes")
-	pullRequestAlreadyOpen := false
-	titlePrefix := fmt.Sprintf("downstream(#%d): ", req.UpstreamPullRequestNum)
-	searchFilter := fmt.Sprintf("type:pr repo:\"%s/%s\" \"%s\"", req.ForkOrg, req.ForkRepo, titlePrefix)
-	searchRes, _, err := client.Search.Issues(ctx, searchFilter, &github.SearchOptions{})
+	var refreshPullRequest *github.PullRequest
+	pullRequestAlreadyOpen, err := findDownstreamPullRequest(ctx, p, req)
 	if err != nil {
-		return err
-	}
-	logrus.Infof("search found %d results", searchRes.GetTotal())
-	if searchRes.GetTotal() > 0 {
-		for _, issue := range searchRes.Issues {
-			logrus.Debugf("checking search result %s", issue.GetHTMLURL())
-			if issue.IsPullRequest() && strings.HasPrefix(issue.GetTitle(), titlePrefix) {
-				logrus.Infof("found existing pull request downstreaming same changes: %s", issue.GetHTMLURL())
-				pullRequestAlreadyOpen = true
-			}
-		}
+		return DownstreamFailed, err
 	}
-	if pullRequestAlreadyOpen && req.PushAndOpenPullRequest {
-		logrus.Warnf("skipping pull request due to changes being already downstreamed. Consider using the --no-push option if you wish to proceed in the local git repository")
-		return nil
+	if pullRequestAlreadyOpen != nil && req.PushAndOpenPullRequest {
+		// pre-merge downstreams can be refreshed as long as they're open
+		recordedHead := preMergeHead(pullRequestAlreadyOpen.GetBody())
+		if len(recordedHead) == 0 || pullRequestAlreadyOpen.GetState() != "open" {
+			logrus.Warnf("skipping pull request due to changes being already downstreamed. Consider using the --no-push option if you wish to proceed in the local git repository")
+			return DownstreamAlreadyPorted, nil
+		}
+		reason := preMergeOutdatedReason(pr, merged, recordedHead)
+		if len(reason) == 0 {
+			logrus.Infof("%s pull request is up to date with upstream, skipping: %s", PreMergeLabel, pullRequestAlreadyOpen.GetHTMLURL())
+			return DownstreamAlreadyPorted, nil
+		}
+		if !req.Refresh {
+			logrus.Warnf("%s pull request is outdated as %s, consider using the --refresh option for updating it: %s", PreMergeLabel, reason, pullRequestAlreadyOpen.GetHTMLURL())
+			return DownstreamAlreadyPorted, nil
+		}
+		logrus.Infof("refreshing %s pull request as %s: %s", PreMergeLabel, reason, pullRequestAlreadyOpen.GetHTMLURL())
+
+		// note: search results don't contain the head branch
+		refreshPullRequest, err = p.GetPullRequest(ctx, req.ForkOrg, req.ForkRepo, pullRequestAlreadyOpen.GetNumber())
+		if err != nil {
+			return DownstreamFailed, err
+		}
+		req.Branch = refreshPullRequest.GetHead().GetRef()
 	}
 
-	var commitTitles []string
-	commits, err := utils.CollectSequence(iteratePullRequestCommits(ctx, client, req.UpstreamOrg, req.UpstreamRepo, req.UpstreamPullRequestNum))
+	commits, err := utils.CollectSequence(p.ListPullRequestCommits(ctx, req.UpstreamOrg, req.UpstreamRepo, req.UpstreamPullRequestNum))
 	if err != nil {
-		return err
-	}
-	for _, c := range commits {
-		msgLines := strings.Split(c.GetCommit().GetMessage(), "\n")
-		if len(msgLines) == 0 {
-			return fmt.Errorf("found commit with empty body: %s", c.GetSHA())
-		}
-		logrus.Infof("found commit: %s", msgLines[0])
-		commitTitles = append(commitTitles, msgLines[0])
+		return DownstreamFailed, err
 	}
 
 	logrus.Infof("adding temporary remote for upstream %s/%s", req.UpstreamOrg, req.UpstreamRepo)
 	remoteName := fmt.Sprintf("temp-%s-upstream-%s-%s", utils.ProjectName, req.UpstreamOrg, req.UpstreamRepo)
-	remoteURL := fmt.Sprintf("https://github.com/%s/%s", req.UpstreamOrg, req.UpstreamRepo)
-	return utils.WithTempGitRemote(git, remoteName, remoteURL, func() error {
-		// search for hashes of all PR's commit
-		// note: in case a PR is merged, the commit hashes will always differ
-		// from the ones of the PR, which could report the commits from a given
-		// branch and event from another fork
-		logrus.Infof("searching for all pull request commits")
+	remoteURL := p.Links().Repo(req.UpstreamOrg, req.UpstreamRepo)
+	status := DownstreamFailed
+	err = utils.WithTempGitRemote(git, remoteName, remoteURL, func() error {
 		var commitHashes []string
-		upstreamTmpDefaultBranch := fmt.Sprintf("temp-%s-upstream-default-%s-%s", utils.ProjectName, req.UpstreamOrg, req.UpstreamRepo)
-		err := utils.WithTempLocalBranch(git, upstreamTmpDefaultBranch, remoteName, req.UpstreamHeadRef, func() (bool, error) {
-			for _, title := range commitTitles {
-				out, err := git.DoOutput("log", "--oneline", "--abbrev=64", "--fixed-strings", "--grep", title)
-				if err != nil {
-					return !req.PreserveTempBranches, err
-				}
-				if len(out) == 0 {
-					err = fmt.Errorf("could not find upstream commit with title: %s", title)
-					logrus.Error(err.Error())
-					return !req.PreserveTempBranches, err
-				}
-				// commit hash is the first space-separated token
-				tokens := strings.Split(out, " ")
-				if len(tokens) == 0 {
-					err = fmt.Errorf("found corrupted upstream commit hash: title=%s, hash=%s", title, out)
-					logrus.Error(err.Error())
-					return !req.PreserveTempBranches, err
-				}
-				logrus.Infof("found hash %s for commit: %s", tokens[0], title)
-				commitHashes = append(commitHashes, tokens[0])
-			}
-			return !req.PreserveTempBranches, nil
-		})
+		var err error
+		if merged {
+			commitHashes, err = findMergedCommitHashes(git, p, req, remoteName, pr, commits)
+		} else {
+			commitHashes, err = fetchUnmergedCommitHashes(git, p, req, remoteName, pr, commits)
+		}
 		if err != nil {
 			return err
 		}
 
+		// content merge conflicts are solved through the conflict
+		// resolutions cache whenever possible
+		if len(req.RerereBranch) > 0 {
+			logrus.Infof("pulling conflict resolutions cache from branch '%s'", req.RerereBranch)
+			err := branchdb.Pull(git, req.RerereRemote, req.RerereBranch, utils.RerereCacheDir, !req.PreserveTempBranches)
+			if err != nil {
+				return err
+			}
+		}
+
 		// now it's time to create a temporary branch starting from the fork's
 		// head ref and start cherry-picking all the commits found
 		logrus.Infof("picking for all pull request commits in temporary branch")
 		downstreamOutputBranch := req.Branch
 		return utils.WithTempLocalBranch(git, downstreamOutputBranch, "origin", req.ForkHeadRef, func() (bool, error) {
-			for _, hash := range commitHashes {
+			var conflict *pickConflict
+			for i, hash := range commitHashes {
 				logrus.Infof("picking commit %s", hash)
-				out, err := git.DoOutput("cherry-pick", "--allow-empty", hash)
+				out, err := git.DoOutput("-c", "rerere.enabled=true", "cherry-pick", "--allow-empty", hash)
+				if err == nil {
+					continue
+				}
+				conflict, err = recoverPickConflicts(git, p.Links(), req, hash, out)
 				if err != nil {
 					logrus.Error("unrecoverable merge conflict occurred, reverting patch")
-					errOut := errors.New(out)
-					return !req.PreserveTempBranches, multierror.Append(err, errOut, git.Do("reset", "--hard"))
+					return !req.PreserveTempBranches, multierror.Append(err, errors.New(out), git.Do("reset", "--hard"))
+				}
+				if conflict != nil {
+					conflict.Picked = commitHashes[:i]
+					conflict.Remaining = commitHashes[i+1:]
+					status = DownstreamConflicted
+					break
+				}
+			}
+			if conflict != nil && !req.PushAndOpenPullRequest {
+				logrus.Error("unrecoverable merge conflict occurred, reverting patch")
+				conflictErr := &conflictError{
+					Suggestion: formatConflictSuggestion(p.Links(), req, conflict),
+					err:        fmt.Errorf("merge conflict on commit: %s", conflict.SHA),
+				}
+				return !req.PreserveTempBranches, multierror.Append(conflictErr, git.Do("reset", "--hard"))
+			}
+			if conflict != nil {
+				// the partial downstream is pushed anyways, so that the
+				// conflicts can be solved manually in its pull request
+				if err := parkConflict(git, p.Links(), req, conflict); err != nil {
+					status = DownstreamFailed
+					return !req.PreserveTempBranches, multierror.Append(err, git.Do("reset", "--hard"))
 				}
 			}
 			if req.PushAndOpenPullRequest {
-				return !req.PreserveTempBranches, pushAndOpenPullRequest(ctx, git, client, req, downstreamOutputBranch, pr.GetTitle())
+				pushed, err := pushAndOpenPullRequest(ctx, git, p, req, downstreamOutputBranch, pr, merged, refreshPullRequest, conflict)
+				if err != nil {
+					status = DownstreamFailed
+				} else if !pushed {
+					status = DownstreamAlreadyPorted
+				} else if conflict == nil {
+					status = DownstreamSucceeded
+				}
+				return !req.PreserveTempBranches, err
 			}
+			status = DownstreamSucceeded
 			return !req.PreserveTempBranches, nil
 		})
 	})
+	return status, err
+}
 
+// fetches the head of an unmerged pull request from the upstream remote, and
+// returns the hashes of the pull request's own commits in order of
+// application. Merge commits, such as the ones of the base branch merged into
+// the pull request, are excluded.
+func fetchUnmergedCommitHashes(git utils.GitHelper, p provider.Provider, req *DownstreamRequest, remoteName string, pr *github.PullRequest, commits []*github.RepositoryCommit) ([]string, error) {
+	if err := fetchPullRequestHead(git, p, req, remoteName); err != nil {
+		return nil, err
+	}
+	commitHashes, err := listPullRequestCommits(git, pr.GetHead().GetSHA(), fmt.Sprintf("%s/%s", remoteName, pr.GetBase().GetRef()), commits)
+	if err != nil {
+		return nil, err
+	}
+	if len(commitHashes) == 0 {
+		return nil, fmt.Errorf("could not find any commit of pull request #%d at head %s", req.UpstreamPullRequestNum, pr.GetHead().GetSHA())
+	}
+	return commitHashes, nil
 }
 
-func pushAndOpenPullRequest(ctx context.Context, git utils.GitHelper, client *github.Client, req *DownstreamRequest, branch, prTitle string) error {
+// pushes the downstream branch into the fork and opens a pull request for
+// it, or updates the given existing pull request if not nil. The pull request
+// is pre-merge if the upstream one is not merged, and is opened as draft and
+// contains the guidance for solving the merge conflicts manually if the given
+// conflict is not nil. Returns false if there is
+// nothing to push, as the changes are already in the fork.
+func pushAndOpenPullRequest(ctx context.Context, git utils.GitHelper, p provider.Provider, req *DownstreamRequest, branch string, upstreamPR *github.PullRequest, merged bool, existing *github.PullRequest, conflict *pickConflict) (bool, error) {
 	// we expect to be in the temp branch containing all the picked commits
 	curBranch, err := git.GetCurrentBranch()
 	if err != nil {
-		return err
+		return false, err
 	}
 	if curBranch != branch {
-		return fmt.Errorf("expected to be in '%s' branch, but currently in '%s'", branch, curBranch)
+		return false, fmt.Errorf("expected to be in '%s' branch, but currently in '%s'", branch, curBranch)
 	}
 
 	// checking if there's a diff or if there are no changes
 	diff, err := git.DoOutput("diff", fmt.Sprintf("HEAD..origin/%s", req.ForkHeadRef))
 	if err != nil {
-		return err
+		return false, err
 	}
 	if len(diff) == 0 {
 		logrus.Warnf("found an empty diff, nothing to push, skipping")
-		return nil
+		return false, nil
 	}
 
 	// push branch on fork
@@ -177,24 +328,69 @@ func pushAndOpenPullRequest(ctx context.Context, git utils.GitHelper, client *gi
 	err = git.Do("push", "-f", "origin", branch)
 	if err != nil {
 		logrus.Errorf("failure in pushing branch into fork: %s", branch)
-		return err
+		return false, err
 	}
 
-	logrus.Infof("opening new pull request in %s/%s", req.ForkOrg, req.ForkRepo)
 	titlePrefix := fmt.Sprintf("downstream(#%d): ", req.UpstreamPullRequestNum)
-	pullRequestTitle := fmt.Sprintf("%s%s", titlePrefix, prTitle)
-	pullRequestBody := fmt.Sprintf("Ref: https://github.com/%s/%s/pull/%d", req.UpstreamOrg, req.UpstreamRepo, req.UpstreamPullRequestNum)
-	pr, _, err := client.PullRequests.Create(ctx, req.ForkOrg, req.ForkRepo, &github.NewPullRequest{
+	pullRequestTitle := fmt.Sprintf("%s%s", titlePrefix, upstreamPR.GetTitle())
+	pullRequestBody := fmt.Sprintf("Ref: %s", p.Links().PullRequest(req.UpstreamOrg, req.UpstreamRepo, req.UpstreamPullRequestNum))
+	if !merged {
+		pullRequestBody += fmt.Sprintf("\n\n%s %s\n\nThe upstream pull request is not merged yet, and this can be refreshed with `%s downstream --refresh` once it gets merged or updated.",
+			preMergeBodyHeader, upstreamPR.GetHead().GetSHA(), utils.ProjectName)
+	}
+	if conflict != nil {
+		logrus.Warnf("downstream is partial due to merge conflicts in commit %s, which must be solved manually in the pull request", conflict.SHA)
+		pullRequestBody += fmt.Sprintf("\n\n## Merge Conflicts\n\nThe downstream is partial and the last commit contains unsolved merge conflicts.\n\n%s\n",
+			formatConflictSuggestion(p.Links(), req, conflict))
+	}
+
+	if existing != nil {
+		logrus.Infof("updating pull request %s", existing.GetHTMLURL())
+		if conflict != nil {
+			// keep the pull request as draft for the providers marking
+			// drafts in the title
+			existingTitle := existing.GetTitle()
+			pullRequestTitle = existingTitle[:len(existingTitle)-len(provider.TrimDraftTitlePrefix(existingTitle))] + pullRequestTitle
+		}
+		_, err := p.EditPullRequest(ctx, req.ForkOrg, req.ForkRepo, existing.GetNumber(), &github.PullRequest{
+			Title: &pullRequestTitle,
+			Body:  &pullRequestBody,
+		})
+		if err != nil {
+			logrus.Errorf("failure in updating pull request: %s", err.Error())
+			return false, err
+		}
+		if merged {
+			err = p.EditPullRequestLabels(ctx, req.ForkOrg, req.ForkRepo, existing.GetNumber(), nil, []string{PreMergeLabel})
+			if err != nil {
+				logrus.Errorf("failure in removing %s label from pull request: %s", PreMergeLabel, err.Error())
+				return false, err
+			}
+		}
+		logrus.Infof("pull request updated successfully: %s", existing.GetHTMLURL())
+		return true, nil
+	}
+
+	logrus.Infof("opening new pull request in %s/%s", req.ForkOrg, req.ForkRepo)
+	pr, err := p.CreatePullRequest(ctx, req.ForkOrg, req.ForkRepo, &github.NewPullRequest{
 		Title: &pullRequestTitle,
 		Head:  &branch,
 		Base:  &req.ForkHeadRef,
 		Body:  &pullRequestBody,
+		Draft: github.Bool(conflict != nil),
 	})
 	if err != nil {
 		logrus.Errorf("failure in opening pull request: %s", err.Error())
-		return err
+		return false, err
+	}
+	if !merged {
+		err = p.EditPullRequestLabels(ctx, req.ForkOrg, req.ForkRepo, pr.GetNumber(), []string{PreMergeLabel}, nil)
+		if err != nil {
+			logrus.Errorf("failure in adding %s label to pull request: %s", PreMergeLabel, err.Error())
+			return false, err
+		}
 	}
 
 	logrus.Infof("pull request opened successfully: %s", pr.GetHTMLURL())
-	return nil
+	return true, nil
 }
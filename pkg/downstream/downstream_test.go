@@ -0,0 +1,239 @@
+package downstream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSearchProvider serves fixed pull request search results
+type fakeSearchProvider struct {
+	fakeLinksProvider
+	found []*github.PullRequest
+}
+
+func (f *fakeSearchProvider) SearchPullRequests(ctx context.Context, org, repo, text string) ([]*github.PullRequest, error) {
+	return f.found, nil
+}
+
+// fakeDownstreamGit serves the outputs of git commands like fakeConflictGit,
+// records the commands run with Do, and keeps track of the current branch.
+// Commands listed in doFails fail when run with Do.
+type fakeDownstreamGit struct {
+	fakeConflictGit
+	branch   string
+	commands []string
+	doFails  map[string]bool
+}
+
+func (f *fakeDownstreamGit) Do(args ...string) error {
+	cmd := strings.Join(args, " ")
+	f.commands = append(f.commands, cmd)
+	if f.doFails[cmd] {
+		return fmt.Errorf("exit status 1")
+	}
+	if args[0] == "checkout" {
+		f.branch = args[len(args)-1]
+		if args[1] == "-b" {
+			f.branch = args[2]
+		}
+	}
+	return nil
+}
+
+func (f *fakeDownstreamGit) GetRemotes() (map[string]string, error) {
+	return map[string]string{"origin": "git@github.com:fork/repo.git"}, nil
+}
+
+func (f *fakeDownstreamGit) GetCurrentBranch() (string, error) {
+	return f.branch, nil
+}
+
+// note: the only conflicting file is a.txt
+func (f *fakeDownstreamGit) ListUnmergedFiles() ([]string, error) {
+	return []string{"a.txt"}, nil
+}
+
+// fakeDownstreamProvider serves a single upstream pull request and records
+// the pull requests opened in the fork
+type fakeDownstreamProvider struct {
+	fakeSearchProvider
+	pr      *github.PullRequest
+	commits []*github.RepositoryCommit
+	opened  []*github.NewPullRequest
+}
+
+func (f *fakeDownstreamProvider) GetPullRequest(ctx context.Context, org, repo string, num int) (*github.PullRequest, error) {
+	return f.pr, nil
+}
+
+func (f *fakeDownstreamProvider) ListPullRequestCommits(ctx context.Context, org, repo string, num int) utils.Sequence[github.RepositoryCommit] {
+	return utils.NewGithubSequence(context.Background(), func(o *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+		if o.Page > 1 {
+			return nil, nil, nil
+		}
+		return f.commits, nil, nil
+	})
+}
+
+func (f *fakeDownstreamProvider) CreatePullRequest(ctx context.Context, org, repo string, pr *github.NewPullRequest) (*github.PullRequest, error) {
+	f.opened = append(f.opened, pr)
+	return &github.PullRequest{Number: github.Int(len(f.opened))}, nil
+}
+
+func TestDownstreamStatus(t *testing.T) {
+	conflictOut := "CONFLICT (content): Merge conflict in a.txt"
+	tests := []struct {
+		name    string
+		pick    string
+		fails   map[string]bool
+		diff    string
+		doFails map[string]bool
+		noPush  bool
+		status  DownstreamStatus
+		err     bool
+		opened  int
+	}{
+		{name: "succeeded", diff: "some diff", status: DownstreamSucceeded, opened: 1},
+		{name: "not-pushed", diff: "", status: DownstreamAlreadyPorted},
+		{
+			name:   "conflicted",
+			pick:   conflictOut,
+			fails:  map[string]bool{"-c rerere.enabled=true cherry-pick --allow-empty m1": true, "diff --check": true},
+			diff:   "some diff",
+			status: DownstreamConflicted,
+			opened: 1,
+		},
+		{
+			name:    "conflicted-push-failure",
+			pick:    conflictOut,
+			fails:   map[string]bool{"-c rerere.enabled=true cherry-pick --allow-empty m1": true, "diff --check": true},
+			diff:    "some diff",
+			doFails: map[string]bool{"push -f origin downstream-12": true},
+			status:  DownstreamFailed,
+			err:     true,
+		},
+		{
+			name:    "conflicted-park-failure",
+			pick:    conflictOut,
+			fails:   map[string]bool{"-c rerere.enabled=true cherry-pick --allow-empty m1": true, "diff --check": true},
+			doFails: map[string]bool{"add -A -- a.txt": true},
+			status:  DownstreamFailed,
+			err:     true,
+		},
+		{
+			name:   "conflicted-not-pushed",
+			pick:   conflictOut,
+			fails:  map[string]bool{"-c rerere.enabled=true cherry-pick --allow-empty m1": true, "diff --check": true},
+			noPush: true,
+			status: DownstreamConflicted,
+			err:    true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			git := &fakeDownstreamGit{
+				fakeConflictGit: fakeConflictGit{fakeMatchGit{
+					outputs: map[string]string{
+						"rev-list --parents -n 1 m1":                          "m1 p1",
+						"rev-list --reverse --no-merges h1 --not m1^1":        "c1",
+						"-c rerere.enabled=true cherry-pick --allow-empty m1": test.pick,
+						"log -1 --format=%B m1":                               "fix: something",
+						"diff --check":                                        "a.txt:1: leftover conflict marker",
+						"diff HEAD..origin/main":                              test.diff,
+					},
+					fails: test.fails,
+				}},
+				branch:  "main",
+				doFails: test.doFails,
+			}
+			p := &fakeDownstreamProvider{
+				pr: &github.PullRequest{
+					Number:         github.Int(12),
+					Title:          github.String("fix: something"),
+					State:          github.String("closed"),
+					Merged:         github.Bool(true),
+					MergedAt:       &github.Timestamp{Time: time.Now()},
+					MergeCommitSHA: github.String("m1"),
+					Head:           &github.PullRequestBranch{SHA: github.String("h1")},
+				},
+				commits: []*github.RepositoryCommit{{SHA: github.String("c1")}},
+			}
+			req := &DownstreamRequest{
+				Branch:                 "downstream-12",
+				UpstreamOrg:            "org",
+				UpstreamRepo:           "repo",
+				UpstreamHeadRef:        "master",
+				UpstreamPullRequestNum: 12,
+				ForkOrg:                "fork",
+				ForkRepo:               "repo",
+				ForkHeadRef:            "main",
+				PushAndOpenPullRequest: !test.noPush,
+			}
+			status, err := downstream(context.Background(), git, p, req)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.status, status)
+			require.Len(t, p.opened, test.opened)
+			if test.opened > 0 {
+				assert.Equal(t, test.status == DownstreamConflicted, p.opened[0].GetDraft())
+			}
+			if test.status == DownstreamConflicted {
+				// the guidance is only returned if the downstream is not pushed
+				suggestion, ok := ConflictSuggestion(err)
+				assert.Equal(t, test.noPush, ok)
+				if ok {
+					assert.Contains(t, suggestion, "git cherry-pick m1")
+				} else {
+					assert.Contains(t, git.commands, "add -A -- a.txt")
+				}
+			}
+		})
+	}
+}
+
+func TestPreMerge(t *testing.T) {
+	body := "Ref: https://github.com/org/repo/pull/1\n\n" + preMergeBodyHeader + " 0123abcd\n\nsome text"
+	assert.Equal(t, "0123abcd", preMergeHead(body))
+	assert.Empty(t, preMergeHead("Ref: https://github.com/org/repo/pull/1"))
+
+	pr := &github.PullRequest{Head: &github.PullRequestBranch{SHA: github.String("0123abcd")}}
+	assert.Empty(t, preMergeOutdatedReason(pr, false, "0123abcd"))
+	assert.Contains(t, preMergeOutdatedReason(pr, false, "ffffffff"), "force-pushed")
+	assert.Contains(t, preMergeOutdatedReason(pr, true, "0123abcd"), "merged")
+}
+
+func TestFindDownstreamPullRequest(t *testing.T) {
+	req := &DownstreamRequest{ForkOrg: "fork", ForkRepo: "repo", UpstreamPullRequestNum: 12}
+
+	// conflicted downstreams are drafts, which some providers mark in the title
+	p := &fakeSearchProvider{found: []*github.PullRequest{
+		{Number: github.Int(1), Title: github.String("downstream(#123): fix: other"), State: github.String("open")},
+		{Number: github.Int(2), Title: github.String("Draft: downstream(#12): fix: something"), State: github.String("open")},
+	}}
+	pr, err := findDownstreamPullRequest(context.Background(), p, req)
+	require.NoError(t, err)
+	require.NotNil(t, pr)
+	assert.Equal(t, 2, pr.GetNumber())
+
+	p.found[1].Title = github.String("WIP: downstream(#12): fix: something")
+	pr, err = findDownstreamPullRequest(context.Background(), p, req)
+	require.NoError(t, err)
+	require.NotNil(t, pr)
+	assert.Equal(t, 2, pr.GetNumber())
+
+	p.found = p.found[:1]
+	pr, err = findDownstreamPullRequest(context.Background(), p, req)
+	require.NoError(t, err)
+	assert.Nil(t, pr)
+}
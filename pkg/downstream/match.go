@@ -0,0 +1,240 @@
+package downstream
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// fetches the head of the upstream pull request from the upstream remote,
+// which is kept by the providers even after the pull request is merged
+func fetchPullRequestHead(git utils.GitHelper, p provider.Provider, req *DownstreamRequest, remoteName string) error {
+	headRef := p.Links().PullRequestHeadRef(req.UpstreamPullRequestNum)
+	logrus.Infof("fetching pull request head %s", headRef)
+	return git.Do("fetch", remoteName, headRef)
+}
+
+// returns the hashes of the commits reachable from head and not from base
+// that are among the given pull request commits, in order of application
+func listPullRequestCommits(git utils.GitHelper, head, base string, commits []*github.RepositoryCommit) ([]string, error) {
+	// note: the provider does not guarantee the order of the commits
+	prCommits := make(map[string]bool)
+	for _, c := range commits {
+		prCommits[c.GetSHA()] = true
+	}
+	out, err := git.DoOutput("rev-list", "--reverse", "--no-merges", head, "--not", base)
+	if err != nil {
+		return nil, fmt.Errorf("can't list commits of pull request: %s", out)
+	}
+	var res []string
+	for _, sha := range strings.Split(out, "\n") {
+		if prCommits[sha] {
+			logrus.Infof("found pull request commit %s", sha)
+			res = append(res, sha)
+		}
+	}
+	return res, nil
+}
+
+// returns the hashes of the upstream commits of a merged pull request, in
+// order of application. The commits are located through the merge commit
+// reported by the provider, which is either a true merge, the squash of all
+// the pull request commits, or the last of the rebased ones. Rebased commits
+// are matched with the original ones by patch-id. If the merge commit is not
+// available, each original commit is matched by patch-id among the upstream
+// commits having the same title.
+func findMergedCommitHashes(git utils.GitHelper, p provider.Provider, req *DownstreamRequest, remoteName string, pr *github.PullRequest, commits []*github.RepositoryCommit) ([]string, error) {
+	if err := fetchPullRequestHead(git, p, req, remoteName); err != nil {
+		return nil, err
+	}
+
+	mergeSHA := pr.GetMergeCommitSHA()
+	if len(mergeSHA) > 0 {
+		if out, err := git.DoOutput("rev-list", "--parents", "-n", "1", mergeSHA); err != nil {
+			logrus.Warnf("merge commit %s is not available in upstream, searching pull request commits by title", mergeSHA)
+		} else {
+			return findCommitHashesFromMerge(git, req, pr, mergeSHA, len(strings.Fields(out))-1, commits)
+		}
+	}
+
+	originals, err := listPullRequestCommits(git, pr.GetHead().GetSHA(), fmt.Sprintf("%s/%s", remoteName, pr.GetBase().GetRef()), commits)
+	if err != nil {
+		return nil, err
+	}
+	if len(originals) == 0 {
+		return nil, fmt.Errorf("could not find any commit of pull request #%d at head %s", req.UpstreamPullRequestNum, pr.GetHead().GetSHA())
+	}
+
+	// note: the upstream head ref is generally a branch, but can be a tag too
+	upstreamRef := req.UpstreamHeadRef
+	isBranch, err := git.BranchExistsInRemote(remoteName, req.UpstreamHeadRef)
+	if err != nil {
+		return nil, err
+	}
+	if isBranch {
+		upstreamRef = fmt.Sprintf("%s/%s", remoteName, req.UpstreamHeadRef)
+	}
+
+	var commitHashes []string
+	for _, sha := range originals {
+		hash, err := findCommitHashByTitle(git, upstreamRef, sha)
+		if err != nil {
+			logrus.Error(err.Error())
+			return nil, err
+		}
+		logrus.Infof("found hash %s for pull request commit %s", hash, sha)
+		commitHashes = append(commitHashes, hash)
+	}
+	return commitHashes, nil
+}
+
+// returns the hashes of the upstream commits of a merged pull request given
+// its merge commit and the number of parents of it
+func findCommitHashesFromMerge(git utils.GitHelper, req *DownstreamRequest, pr *github.PullRequest, mergeSHA string, numParents int, commits []*github.RepositoryCommit) ([]string, error) {
+	// a true merge brings the original commits as they are
+	if numParents > 1 {
+		logrus.Infof("pull request has been merged with merge commit %s", mergeSHA)
+		commitHashes, err := listPullRequestCommits(git, mergeSHA, mergeSHA+"^1", commits)
+		if err != nil {
+			return nil, err
+		}
+		if len(commitHashes) == 0 {
+			return nil, fmt.Errorf("could not find any commit of pull request #%d in merge commit %s", req.UpstreamPullRequestNum, mergeSHA)
+		}
+		return commitHashes, nil
+	}
+
+	originals, err := listPullRequestCommits(git, pr.GetHead().GetSHA(), mergeSHA+"^1", commits)
+	if err != nil {
+		return nil, err
+	}
+	if len(originals) <= 1 {
+		// note: a single commit is either rebased or squashed into the merge
+		// commit, and its changes may differ only due to conflict resolution
+		logrus.Infof("pull request has been merged as commit %s", mergeSHA)
+		return []string{mergeSHA}, nil
+	}
+
+	// the original commits have been either rebased on top of the upstream
+	// branch, with the merge commit being the last of them, or squashed
+	out, err := git.DoOutput("rev-list", "--reverse", "--first-parent", "-n", fmt.Sprint(len(originals)), mergeSHA)
+	if err != nil {
+		return nil, fmt.Errorf("can't list commits preceding merge commit %s: %s", mergeSHA, out)
+	}
+	candidates := strings.Fields(out)
+	matches := 0
+	if len(candidates) == len(originals) {
+		for i := range originals {
+			same, err := samePatchID(git, originals[i], candidates[i])
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				matches++
+			}
+		}
+	}
+	if matches == len(originals) {
+		logrus.Infof("pull request has been rebased and merged as commits %s", strings.Join(candidates, ", "))
+		return candidates, nil
+	}
+
+	// note: the merge commit is a squash only if it has the combined changes
+	// of all the commits, otherwise they may have all been adjusted while
+	// rebasing them
+	if matches == 0 {
+		squashed, err := sameDiffPatchID(git, originals[0]+"^", originals[len(originals)-1], mergeSHA+"^", mergeSHA)
+		if err != nil {
+			return nil, err
+		}
+		if squashed {
+			logrus.Infof("pull request has been squashed and merged as commit %s", mergeSHA)
+			return []string{mergeSHA}, nil
+		}
+	}
+	return nil, fmt.Errorf("can't tell if pull request #%d has been squashed or rebased, as only %d of its %d commits match the ones preceding merge commit %s by patch-id, and the latter does not have their combined changes:\n%s",
+		req.UpstreamPullRequestNum, matches, len(originals), mergeSHA, formatCandidates(git, candidates))
+}
+
+// returns the hash of the only commit of the given upstream ref having the
+// same title and patch-id of the given pull request commit
+func findCommitHashByTitle(git utils.GitHelper, upstreamRef, sha string) (string, error) {
+	title, err := git.DoOutput("log", "-1", "--format=%s", sha)
+	if err != nil {
+		return "", fmt.Errorf("can't retrieve title of commit %s: %s", sha, title)
+	}
+	out, err := git.DoOutput("log", "--format=%H", "--fixed-strings", "--grep", title, upstreamRef)
+	if err != nil {
+		return "", fmt.Errorf("can't search upstream commits with title '%s': %s", title, out)
+	}
+	candidates := strings.Fields(out)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("could not find upstream commit with title: %s", title)
+	}
+
+	// note: the title search also finds reverts and commits with similar
+	// titles, which are told apart by their changes
+	var matches []string
+	for _, c := range candidates {
+		same, err := samePatchID(git, sha, c)
+		if err != nil {
+			return "", err
+		}
+		if same {
+			matches = append(matches, c)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return "", fmt.Errorf("could not find upstream commit with the changes of %s (%s), none of the ones with the same title match by patch-id:\n%s", sha, title, formatCandidates(git, candidates))
+	default:
+		return "", fmt.Errorf("found %d ambiguous upstream commits with the changes of %s (%s):\n%s", len(matches), sha, title, formatCandidates(git, matches))
+	}
+}
+
+// returns true if the two given commits have the same patch-id. Commits
+// without changes never match, as their empty patch-ids are all the same.
+func samePatchID(git utils.GitHelper, a, b string) (bool, error) {
+	idA, err := git.PatchID(a)
+	if err != nil {
+		return false, err
+	}
+	idB, err := git.PatchID(b)
+	if err != nil {
+		return false, err
+	}
+	return len(idA) > 0 && idA == idB, nil
+}
+
+// returns true if the changes between the two given pairs of revs have the
+// same patch-id, which is never the case if there are no changes
+func sameDiffPatchID(git utils.GitHelper, fromA, toA, fromB, toB string) (bool, error) {
+	idA, err := git.DiffPatchID(fromA, toA)
+	if err != nil {
+		return false, err
+	}
+	idB, err := git.DiffPatchID(fromB, toB)
+	if err != nil {
+		return false, err
+	}
+	return len(idA) > 0 && idA == idB, nil
+}
+
+// formats the given candidate commits one per line, along with their title
+func formatCandidates(git utils.GitHelper, shas []string) string {
+	var lines []string
+	for _, sha := range shas {
+		title, err := git.DoOutput("log", "-1", "--format=%s", sha)
+		if err != nil {
+			title = "<unknown>"
+		}
+		lines = append(lines, fmt.Sprintf("  %s %s", sha, title))
+	}
+	return strings.Join(lines, "\n")
+}
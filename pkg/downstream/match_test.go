@@ -0,0 +1,178 @@
+package downstream
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMatchGit serves the outputs of git commands by their arguments, the
+// patch-ids of commits by their SHA, and the ones of the changes between
+// two revs by the revs separated by a space. Commands listed in fails also
+// return an error along with their output.
+type fakeMatchGit struct {
+	utils.GitHelper
+	outputs      map[string]string
+	fails        map[string]bool
+	patchIDs     map[string]string
+	diffPatchIDs map[string]string
+	remoteRef    bool
+}
+
+func (f *fakeMatchGit) Do(args ...string) error {
+	return nil
+}
+
+func (f *fakeMatchGit) DoOutput(args ...string) (string, error) {
+	cmd := strings.Join(args, " ")
+	out, ok := f.outputs[cmd]
+	if !ok {
+		return "unknown revision", fmt.Errorf("exit status 128")
+	}
+	if f.fails[cmd] {
+		return out, fmt.Errorf("exit status 1")
+	}
+	return out, nil
+}
+
+func (f *fakeMatchGit) PatchID(rev string) (string, error) {
+	return f.patchIDs[rev], nil
+}
+
+func (f *fakeMatchGit) DiffPatchID(from, to string) (string, error) {
+	return f.diffPatchIDs[from+" "+to], nil
+}
+
+func (f *fakeMatchGit) BranchExistsInRemote(remote, branch string) (bool, error) {
+	return f.remoteRef, nil
+}
+
+type fakeLinksProvider struct {
+	provider.Provider
+}
+
+func (f *fakeLinksProvider) Links() *provider.Links {
+	return &provider.Links{BaseURL: "https://github.com", SSHHost: "git@github.com", CommitPath: "commit", PullRequestPath: "pull", TreePath: "tree", PullRequestRefPrefix: "refs/pull"}
+}
+
+func TestFindMergedCommitHashes(t *testing.T) {
+	req := &DownstreamRequest{UpstreamPullRequestNum: 1, UpstreamHeadRef: "master"}
+	p := &fakeLinksProvider{}
+	commits := []*github.RepositoryCommit{{SHA: github.String("o2")}, {SHA: github.String("o1")}}
+	newPR := func(mergeSHA string) *github.PullRequest {
+		return &github.PullRequest{
+			MergeCommitSHA: github.String(mergeSHA),
+			Head:           &github.PullRequestBranch{SHA: github.String("o2")},
+			Base:           &github.PullRequestBranch{Ref: github.String("master")},
+		}
+	}
+	newGit := func() *fakeMatchGit {
+		return &fakeMatchGit{
+			outputs: map[string]string{
+				"rev-list --reverse --no-merges o2 --not m^1":               "o1\no2",
+				"rev-list --reverse --no-merges o2 --not up/master":         "o1\no2",
+				"rev-list --reverse --first-parent -n 2 m":                  "r1\nm",
+				"log -1 --format=%s o1":                                     "fix: one",
+				"log -1 --format=%s o2":                                     "fix: two",
+				"log -1 --format=%s r1":                                     "fix: one",
+				"log -1 --format=%s m":                                      "fix: two",
+				"log --format=%H --fixed-strings --grep fix: one up/master": "r1\nrv1",
+				"log --format=%H --fixed-strings --grep fix: two up/master": "m",
+			},
+			patchIDs:     map[string]string{"o1": "p1", "o2": "p2", "r1": "p1", "m": "p2", "rv1": "p3"},
+			diffPatchIDs: map[string]string{"o1^ o2": "p12", "m^ m": "p2"},
+			remoteRef:    true,
+		}
+	}
+
+	t.Run("true-merge", func(t *testing.T) {
+		git := newGit()
+		git.outputs["rev-list --parents -n 1 m"] = "m b o2"
+		git.outputs["rev-list --reverse --no-merges m --not m^1"] = "o1\no2"
+		hashes, err := findMergedCommitHashes(git, p, req, "up", newPR("m"), commits)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"o1", "o2"}, hashes)
+	})
+
+	t.Run("rebase", func(t *testing.T) {
+		git := newGit()
+		git.outputs["rev-list --parents -n 1 m"] = "m r1"
+		hashes, err := findMergedCommitHashes(git, p, req, "up", newPR("m"), commits)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"r1", "m"}, hashes)
+	})
+
+	t.Run("squash", func(t *testing.T) {
+		git := newGit()
+		git.outputs["rev-list --parents -n 1 m"] = "m b"
+		git.outputs["rev-list --reverse --first-parent -n 2 m"] = "b\nm"
+		git.patchIDs["b"] = "pb"
+		git.patchIDs["m"] = "p12"
+		git.diffPatchIDs["m^ m"] = "p12"
+		hashes, err := findMergedCommitHashes(git, p, req, "up", newPR("m"), commits)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"m"}, hashes)
+	})
+
+	t.Run("rebase-all-adjusted", func(t *testing.T) {
+		// all the commits changed while rebasing, and the merge commit
+		// only has the changes of the last one
+		git := newGit()
+		git.outputs["rev-list --parents -n 1 m"] = "m r1"
+		git.patchIDs["r1"] = "p1-adjusted"
+		git.patchIDs["m"] = "p2-adjusted"
+		git.diffPatchIDs["m^ m"] = "p2-adjusted"
+		_, err := findMergedCommitHashes(git, p, req, "up", newPR("m"), commits)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "can't tell if pull request #1 has been squashed or rebased")
+	})
+
+	t.Run("empty-commits", func(t *testing.T) {
+		git := newGit()
+		git.outputs["rev-list --parents -n 1 m"] = "m r1"
+		git.patchIDs["o1"] = ""
+		git.patchIDs["r1"] = ""
+		_, err := findMergedCommitHashes(git, p, req, "up", newPR("m"), commits)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "only 1 of its 2 commits match")
+	})
+
+	t.Run("ambiguous-merge", func(t *testing.T) {
+		git := newGit()
+		git.outputs["rev-list --parents -n 1 m"] = "m r1"
+		git.patchIDs["m"] = "pother"
+		_, err := findMergedCommitHashes(git, p, req, "up", newPR("m"), commits)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "r1 fix: one")
+		assert.Contains(t, err.Error(), "m fix: two")
+	})
+
+	t.Run("title-fallback", func(t *testing.T) {
+		// the merge commit is not available, and the title search finds a
+		// revert of the first commit which is told apart by patch-id
+		git := newGit()
+		hashes, err := findMergedCommitHashes(git, p, req, "up", newPR("m"), commits)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"r1", "m"}, hashes)
+
+		hashes, err = findMergedCommitHashes(git, p, req, "up", newPR(""), commits)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"r1", "m"}, hashes)
+	})
+
+	t.Run("title-fallback-ambiguous", func(t *testing.T) {
+		git := newGit()
+		git.patchIDs["rv1"] = "p1"
+		git.outputs["log -1 --format=%s rv1"] = "Revert \"fix: one\""
+		_, err := findMergedCommitHashes(git, p, req, "up", newPR(""), commits)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "found 2 ambiguous upstream commits")
+		assert.Contains(t, err.Error(), "rv1 Revert \"fix: one\"")
+	})
+}
@@ -2,15 +2,18 @@ package downstream
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
 	"github.com/jasondellaluce/synchro/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -21,13 +24,62 @@ type SuggestRequest struct {
 	UpstreamHeadRef string
 	ForkHeadRef     string
 	SearchAfter     time.Time
+	// Labels, Authors, and Milestones restrict the suggestions to the pull
+	// requests having at least one of them, if not empty
+	Labels     []string
+	Authors    []string
+	Milestones []string
+	// Paths restricts the suggestions to the pull requests changing at least
+	// one file matching one of these globs, if not empty
+	Paths []string
+	// ListFiles requires listing the files changed by each suggested pull
+	// request even if not restricted by Paths
+	ListFiles bool
 }
 
-func Suggest(ctx context.Context, git utils.GitHelper, client *github.Client, req *SuggestRequest) error {
+// SuggestReport lists the upstream pull requests suggested for being
+// downstreamed, from the most to the least recently merged
+type SuggestReport struct {
+	Entries []*SuggestEntry `json:"entries"`
+}
+
+// SuggestEntry describes an upstream pull request suggested for being
+// downstreamed
+type SuggestEntry struct {
+	Number    int       `json:"number"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Author    string    `json:"author"`
+	Labels    []string  `json:"labels"`
+	Milestone string    `json:"milestone,omitempty"`
+	MergedAt  time.Time `json:"mergedAt"`
+	// CommitsFound is the number of commits of the pull request that are
+	// already in the fork, out of CommitsTotal
+	CommitsFound int      `json:"commitsFound"`
+	CommitsTotal int      `json:"commitsTotal"`
+	ChangedFiles []string `json:"changedFiles"`
+
+	pr *github.PullRequest
+}
+
+// Suggest returns the merged upstream pull requests that are good candidates
+// to be downstreamed, which are the ones having less than half of their
+// commits in the fork's history
+func Suggest(ctx context.Context, git utils.GitHelper, p provider.Provider, req *SuggestRequest) (*SuggestReport, error) {
+	entries, err := suggestPullRequests(ctx, git, p, req)
+	if err != nil {
+		return nil, err
+	}
+	return &SuggestReport{Entries: entries}, nil
+}
+
+// returns the merged upstream pull requests that are good candidates to be
+// downstreamed, from the most to the least recently merged
+func suggestPullRequests(ctx context.Context, git utils.GitHelper, p provider.Provider, req *SuggestRequest) ([]*SuggestEntry, error) {
 	// get current branch
 	curBranch, err := git.GetCurrentBranch()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	logrus.Debugf("current branch is '%s'", curBranch)
 
@@ -35,13 +87,15 @@ func Suggest(ctx context.Context, git utils.GitHelper, client *github.Client, re
 	if curBranch != req.ForkHeadRef {
 		err = git.Do("checkout", req.ForkHeadRef)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		defer func() { git.Do("checkout", curBranch) }()
 	}
 
+	// an empty report is encoded with an empty list of entries, not null
+	res := []*SuggestEntry{}
 	errStop := errors.New("stop")
-	pulls := iterateMergedPullRequests(ctx, client, req.UpstreamOrg, req.UpstreamRepo, req.UpstreamHeadRef)
+	pulls := p.ListMergedPullRequests(ctx, req.UpstreamOrg, req.UpstreamRepo, req.UpstreamHeadRef)
 	err = utils.ConsumeSequence(pulls, func(v *github.PullRequest) error {
 		logrus.Debugf("checking pull request %d merged at %s: %s", v.GetNumber(), v.GetMergedAt().String(), v.GetHTMLURL())
 
@@ -52,15 +106,35 @@ func Suggest(ctx context.Context, git utils.GitHelper, client *github.Client, re
 			return errStop
 		}
 
+		entry := newSuggestEntry(v)
+		if !matchSuggestFilters(req, entry) {
+			logrus.Debugf("skipping pull request %d not matching the filters", v.GetNumber())
+			return nil
+		}
+
+		// retrieve PR's changed files, only if needed as each of them
+		// costs API requests
+		if len(req.Paths) > 0 || req.ListFiles {
+			files, err := utils.CollectSequence(p.ListPullRequestFiles(ctx, req.UpstreamOrg, req.UpstreamRepo, v.GetNumber()))
+			if err != nil {
+				return err
+			}
+			for _, f := range files {
+				entry.ChangedFiles = append(entry.ChangedFiles, f.GetFilename())
+			}
+			if !matchSuggestPaths(req, entry) {
+				logrus.Debugf("skipping pull request %d not changing any of the paths", v.GetNumber())
+				return nil
+			}
+		}
+
 		// retrieve PR's commits
-		commits, err := utils.CollectSequence(iteratePullRequestCommits(ctx, client, req.UpstreamOrg, req.UpstreamRepo, v.GetNumber()))
+		commits, err := utils.CollectSequence(p.ListPullRequestCommits(ctx, req.UpstreamOrg, req.UpstreamRepo, v.GetNumber()))
 		if err != nil {
 			return err
 		}
 
 		// search in local history for the PR commits
-		numCommits := 0
-		numFoundCommits := 0
 		for _, c := range commits {
 			msgLines := strings.Split(c.GetCommit().GetMessage(), "\n")
 			if len(msgLines) == 0 {
@@ -71,63 +145,147 @@ func Suggest(ctx context.Context, git utils.GitHelper, client *github.Client, re
 				return err
 			}
 			found := strings.Split(out, "\n")
-			hasCommit, err := hasCommit(ctx, git, client, req, found, c.GetCommit())
+			hasCommit, err := hasCommit(ctx, git, p, req, found, c)
 			if err != nil {
 				return err
 			}
 			if hasCommit {
-				numFoundCommits++
+				entry.CommitsFound++
 			}
-			numCommits++
+			entry.CommitsTotal++
 		}
 
 		// if less than the 50% of the PR's commit are present in the downstream fork
 		// history (checked from the provided head), then we can conclude
 		// that the PR is a good candidate to be downstreamed.
 		const k float64 = 0.5
-		threshold := (int)(math.Ceil(float64(numCommits) * k))
-		if numFoundCommits < threshold {
-			fmt.Fprintf(os.Stdout, "%d, %s, %s\n", v.GetNumber(), v.GetHTMLURL(), v.GetTitle())
+		threshold := (int)(math.Ceil(float64(entry.CommitsTotal) * k))
+		if entry.CommitsFound < threshold {
+			res = append(res, entry)
 		} else {
-			logrus.Warningf("skipping already ported PR %d (%d/%d commits): %s", v.GetNumber(), numFoundCommits, numCommits, v.GetHTMLURL())
+			logrus.Warningf("skipping already ported PR %d (%d/%d commits): %s", v.GetNumber(), entry.CommitsFound, entry.CommitsTotal, v.GetHTMLURL())
 		}
 
 		return nil
 	})
 
 	if err != nil && err != errStop {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return res, nil
 }
 
-func iterateMergedPullRequests(ctx context.Context, client *github.Client, org, repo, base string) utils.Sequence[github.PullRequest] {
-	it := utils.NewGithubSequence(
-		func(o *github.ListOptions) ([]*github.PullRequest, *github.Response, error) {
-			return client.PullRequests.List(ctx, org, repo, &github.PullRequestListOptions{
-				ListOptions: *o,
-				Base:        base,
-				State:       "closed",
-				Sort:        "updated",
-				Direction:   "desc",
-			})
-		})
-	return utils.NewFilteredSequence(it, func(pr *github.PullRequest) bool {
-		return (pr.Merged != nil && pr.GetMerged()) || pr.MergedAt != nil
-	})
+func newSuggestEntry(pr *github.PullRequest) *SuggestEntry {
+	res := &SuggestEntry{
+		Number:    pr.GetNumber(),
+		URL:       pr.GetHTMLURL(),
+		Title:     pr.GetTitle(),
+		Author:    pr.GetUser().GetLogin(),
+		Milestone: pr.GetMilestone().GetTitle(),
+		MergedAt:  pr.GetMergedAt().Time,
+		// note: lists are never nil, so that they're encoded as empty JSON arrays
+		Labels:       []string{},
+		ChangedFiles: []string{},
+		pr:           pr,
+	}
+	for _, l := range pr.Labels {
+		res.Labels = append(res.Labels, l.GetName())
+	}
+	return res
 }
 
-func iteratePullRequestCommits(ctx context.Context, client *github.Client, org, repo string, prNum int) utils.Sequence[github.RepositoryCommit] {
-	return utils.NewGithubSequence(
-		func(o *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
-			return client.PullRequests.ListCommits(ctx, org, repo, prNum, o)
+// returns true if the given pull request has at least one of the labels,
+// authors, and milestones required by the request
+func matchSuggestFilters(req *SuggestRequest, e *SuggestEntry) bool {
+	matchAny := func(filters, values []string) bool {
+		if len(filters) == 0 {
+			return true
+		}
+		for _, f := range filters {
+			for _, v := range values {
+				if f == v {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return matchAny(req.Labels, e.Labels) &&
+		matchAny(req.Authors, []string{e.Author}) &&
+		matchAny(req.Milestones, []string{e.Milestone})
+}
+
+// returns true if the given pull request changes at least one of the
+// paths required by the request
+func matchSuggestPaths(req *SuggestRequest, e *SuggestEntry) bool {
+	if len(req.Paths) == 0 {
+		return true
+	}
+	for _, g := range req.Paths {
+		for _, f := range e.ChangedFiles {
+			if utils.MatchPathGlob(g, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteText writes the suggestions one per line as the number, the URL, and
+// the title of the pull request separated by commas
+func (r *SuggestReport) WriteText(w io.Writer) {
+	for _, e := range r.Entries {
+		fmt.Fprintf(w, "%d, %s, %s\n", e.Number, e.URL, e.Title)
+	}
+}
+
+// WriteJSON writes the suggestions in JSON
+func (r *SuggestReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes the suggestions in CSV with a header line, in which the
+// labels and the changed files are separated by semicolons
+func (r *SuggestReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"number", "url", "title", "author", "labels", "milestone", "merged_at", "commits_found", "commits_total", "changed_files"})
+	for _, e := range r.Entries {
+		cw.Write([]string{
+			strconv.Itoa(e.Number),
+			e.URL,
+			e.Title,
+			e.Author,
+			strings.Join(e.Labels, ";"),
+			e.Milestone,
+			e.MergedAt.Format(time.RFC3339),
+			strconv.Itoa(e.CommitsFound),
+			strconv.Itoa(e.CommitsTotal),
+			strings.Join(e.ChangedFiles, ";"),
 		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteMarkdown writes the suggestions in a markdown table
+func (r *SuggestReport) WriteMarkdown(w io.Writer) {
+	escape := func(s string) string {
+		return strings.ReplaceAll(s, "|", "\\|")
+	}
+	fmt.Fprintf(w, "| Pull Request | Title | Author | Labels | Milestone | Merged At | Commits Found | Changed Files |\n")
+	fmt.Fprintf(w, "|--------------|-------|--------|--------|-----------|-----------|---------------|---------------|\n")
+	for _, e := range r.Entries {
+		fmt.Fprintf(w, "| [#%d](%s) | %s | %s | %s | %s | %s | %d/%d | %d |\n", e.Number, e.URL, escape(e.Title), e.Author,
+			escape(strings.Join(e.Labels, ", ")), escape(e.Milestone), e.MergedAt.Format(time.RFC3339), e.CommitsFound, e.CommitsTotal, len(e.ChangedFiles))
+	}
 }
 
-func hasCommit(ctx context.Context, git utils.GitHelper, client *github.Client, req *SuggestRequest, found []string, c *github.Commit) (bool, error) {
+func hasCommit(ctx context.Context, git utils.GitHelper, p provider.Provider, req *SuggestRequest, found []string, c *github.RepositoryCommit) (bool, error) {
 	for _, commit := range found {
-		has, err := compareDiff(ctx, git, client, req, commit, c.GetURL())
+		has, err := compareDiff(ctx, git, p, req, commit, c.GetSHA())
 		if err != nil {
 			return false, err
 		}
@@ -139,11 +297,11 @@ func hasCommit(ctx context.Context, git utils.GitHelper, client *github.Client,
 	return false, nil
 }
 
-func compareDiff(ctx context.Context, git utils.GitHelper, client *github.Client, req *SuggestRequest, c string, u string) (bool, error) {
+func compareDiff(ctx context.Context, git utils.GitHelper, p provider.Provider, req *SuggestRequest, c string, sha string) (bool, error) {
 	if len(c) == 0 {
 		return false, nil
 	}
-	remoteDiff, err := pullRemoteDiff(ctx, client, req, u)
+	remoteDiff, err := p.GetCommitDiff(ctx, req.UpstreamOrg, req.UpstreamRepo, sha)
 	if err != nil {
 		return false, err
 	}
@@ -170,40 +328,6 @@ func compareDiff(ctx context.Context, git utils.GitHelper, client *github.Client
 	return true, nil
 }
 
-func pullRemoteDiff(ctx context.Context, client *github.Client, req *SuggestRequest, u string) (string, error) {
-	// do some input checks
-	tokens := strings.Split(u, "/commits/")
-	if len(tokens) < 2 {
-		return "", fmt.Errorf("can't find commit hash in string: %s", u)
-	}
-
-	// retrieve commit through GitHub APIs
-	hash := tokens[1]
-	commit, _, err := client.Repositories.GetCommit(ctx, req.UpstreamOrg, req.UpstreamRepo, hash, nil)
-	if err != nil {
-		return "", err
-	}
-	if commit.HTMLURL == nil {
-		return "", fmt.Errorf("can't find HTML url for commit: %s", hash)
-	}
-
-	// in GitHub, by convention adding ".diff" to the HTML url returns the commit's diff.
-	url := commit.GetHTMLURL() + ".diff"
-
-	// perform the get request with the GitHub client to preserve authentication
-	resp, err := client.Client().Get(url)
-	if err != nil {
-		return "", err
-	}
-
-	// read commit's diff -- bound read size to 100 MB as we can't trust anyone
-	body, err := io.ReadAll(io.LimitReader(resp.Body, 100*1024*1024))
-	if err != nil {
-		return "", err
-	}
-	return string(body), nil
-}
-
 func sanitizeDiff(lines []string) []string {
 	for len(lines) > 0 && lines[len(lines)-1] == " " {
 		lines = lines[:len(lines)-1]
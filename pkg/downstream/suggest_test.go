@@ -0,0 +1,90 @@
+package downstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggest(t *testing.T) {
+	pr := &github.PullRequest{
+		Number:    github.Int(12),
+		HTMLURL:   github.String("https://github.com/org/repo/pull/12"),
+		Title:     github.String("fix: parse a, b | c"),
+		User:      &github.User{Login: github.String("user")},
+		Labels:    []*github.Label{{Name: github.String("bug")}, {Name: github.String("area/engine")}},
+		Milestone: &github.Milestone{Title: github.String("0.37.0")},
+		MergedAt:  &github.Timestamp{Time: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	entry := newSuggestEntry(pr)
+	entry.ChangedFiles = []string{"pkg/engine/a.go", "README.md"}
+	entry.CommitsFound = 1
+	entry.CommitsTotal = 3
+
+	t.Run("filters", func(t *testing.T) {
+		assert.True(t, matchSuggestFilters(&SuggestRequest{}, entry))
+		assert.True(t, matchSuggestFilters(&SuggestRequest{Labels: []string{"feature", "bug"}}, entry))
+		assert.False(t, matchSuggestFilters(&SuggestRequest{Labels: []string{"feature"}}, entry))
+		assert.True(t, matchSuggestFilters(&SuggestRequest{Authors: []string{"user"}, Milestones: []string{"0.37.0"}}, entry))
+		assert.False(t, matchSuggestFilters(&SuggestRequest{Authors: []string{"user"}, Milestones: []string{"0.38.0"}}, entry))
+		assert.False(t, matchSuggestFilters(&SuggestRequest{Authors: []string{"other"}}, entry))
+		assert.True(t, matchSuggestPaths(&SuggestRequest{}, entry))
+		assert.True(t, matchSuggestPaths(&SuggestRequest{Paths: []string{"docs/**", "pkg/**"}}, entry))
+		assert.True(t, matchSuggestPaths(&SuggestRequest{Paths: []string{"*.md"}}, entry))
+		assert.False(t, matchSuggestPaths(&SuggestRequest{Paths: []string{"*.go"}}, entry))
+	})
+
+	report := &SuggestReport{Entries: []*SuggestEntry{entry}}
+
+	t.Run("text", func(t *testing.T) {
+		b := bytes.Buffer{}
+		report.WriteText(&b)
+		assert.Equal(t, "12, https://github.com/org/repo/pull/12, fix: parse a, b | c\n", b.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		b := bytes.Buffer{}
+		require.NoError(t, report.WriteJSON(&b))
+		var decoded SuggestReport
+		require.NoError(t, json.Unmarshal(b.Bytes(), &decoded))
+		require.Len(t, decoded.Entries, 1)
+		assert.Equal(t, 12, decoded.Entries[0].Number)
+		assert.Equal(t, []string{"bug", "area/engine"}, decoded.Entries[0].Labels)
+		assert.Equal(t, 1, decoded.Entries[0].CommitsFound)
+		assert.Equal(t, 3, decoded.Entries[0].CommitsTotal)
+		assert.Equal(t, entry.ChangedFiles, decoded.Entries[0].ChangedFiles)
+		assert.True(t, entry.MergedAt.Equal(decoded.Entries[0].MergedAt))
+
+		b.Reset()
+		empty := &SuggestReport{Entries: []*SuggestEntry{newSuggestEntry(&github.PullRequest{Number: github.Int(13)})}}
+		require.NoError(t, empty.WriteJSON(&b))
+		assert.Contains(t, b.String(), `"labels": []`)
+		assert.Contains(t, b.String(), `"changedFiles": []`)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		b := bytes.Buffer{}
+		require.NoError(t, report.WriteCSV(&b))
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+		require.Len(t, lines, 2)
+		assert.Equal(t, "number,url,title,author,labels,milestone,merged_at,commits_found,commits_total,changed_files", lines[0])
+		assert.Equal(t, `12,https://github.com/org/repo/pull/12,"fix: parse a, b | c",user,bug;area/engine,0.37.0,2023-01-01T00:00:00Z,1,3,pkg/engine/a.go;README.md`, lines[1])
+
+		// the output can be fed back to a batch
+		nums, err := ReadPullRequestNums(&b)
+		require.NoError(t, err)
+		assert.Equal(t, []int{12}, nums)
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		b := bytes.Buffer{}
+		report.WriteMarkdown(&b)
+		assert.Contains(t, b.String(), "| [#12](https://github.com/org/repo/pull/12) | fix: parse a, b \\| c | user | bug, area/engine | 0.37.0 | 2023-01-01T00:00:00Z | 1/3 | 2 |\n")
+	})
+}
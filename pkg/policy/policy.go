@@ -0,0 +1,276 @@
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFileName is the name of the policy file looked up in the root
+// directory of the fork repository when not specified otherwise
+var DefaultFileName = fmt.Sprintf(".%s.yaml", utils.ProjectName)
+
+const (
+	// StrategySkip solves the merge conflicts of a path by keeping the upstream
+	// changes, like the SYNC_CONFLICT_SKIP marker
+	StrategySkip = "skip"
+
+	// StrategyApply solves the merge conflicts of a path by keeping the fork
+	// changes, like the SYNC_CONFLICT_APPLY marker
+	StrategyApply = "apply"
+)
+
+// Policy is the sync contract of a fork, versioned in the fork repository
+// itself. All its values are optional, and are used as defaults for the
+// flags of each command.
+type Policy struct {
+	// Upstream is the upstream repository and its head ref
+	Upstream Repository `yaml:"upstream"`
+	// Fork is the fork repository and its head ref
+	Fork Repository `yaml:"fork"`
+	// Branches are the templates of the names of the output branches
+	Branches Branches `yaml:"branches"`
+	// Conflicts are the default conflict resolution strategies by path,
+	// used for the commits not having a marker for a given path
+	Conflicts []*ConflictRule `yaml:"conflicts"`
+	// Ignore lists the fork commits that are never synced
+	Ignore Ignore `yaml:"ignore"`
+	// Rerere is the storage of the conflict resolutions cache
+	Rerere Rerere `yaml:"rerere"`
+	// Markers restricts the commit comments whose markers are honored
+	Markers Markers `yaml:"markers"`
+}
+
+// Repository is a repository along with the ref from which it is synced
+type Repository struct {
+	// Repo is the repository in the form <org>/<repo>
+	Repo string `yaml:"repo"`
+	// Head is the head ref of the repository
+	Head string `yaml:"head"`
+}
+
+// Branches contains Go templates for the names of the output branches, in
+// which {{ .UpstreamHead }}, {{ .ForkHead }}, {{ .Date }} (in YYYYMMDD format),
+// and {{ .PullRequest }} (for downstream only) can be used.
+type Branches struct {
+	Sync       string `yaml:"sync"`
+	Downstream string `yaml:"downstream"`
+}
+
+// BranchVars are the values available in the branch name templates
+type BranchVars struct {
+	UpstreamHead string
+	ForkHead     string
+	Date         string
+	PullRequest  int
+}
+
+// ConflictRule is the default conflict resolution strategy of some paths
+type ConflictRule struct {
+	// Path is a glob of the paths to which the rule applies
+	Path string `yaml:"path"`
+	// Strategy is one of StrategySkip or StrategyApply
+	Strategy string `yaml:"strategy"`
+}
+
+// rgxIgnoreCommit matches the SHAs, or prefixes of them, that can be
+// ignored by a policy. Short prefixes are refused, as they would likely
+// match unrelated commits.
+var rgxIgnoreCommit = regexp.MustCompile(`^[0-9a-fA-F]{7,64}$`)
+
+// Ignore describes the fork commits that are never synced
+type Ignore struct {
+	// Commits are SHAs, or unambiguous prefixes of them of at least 7
+	// hexadecimal characters
+	Commits []string `yaml:"commits"`
+	// Authors are logins, names, or emails of commit authors
+	Authors []string `yaml:"authors"`
+}
+
+// Rerere describes the storage branch of the conflict resolutions cache
+// managed through the conflict commands
+type Rerere struct {
+	// Remote is the remote name of the storage branch
+	Remote string `yaml:"remote"`
+	// Branch is the name of the storage branch
+	Branch string `yaml:"branch"`
+}
+
+// Markers restricts the commit comments whose markers are honored to the
+// ones of trusted users. All comments are trusted if nothing is defined.
+type Markers struct {
+	// TrustedPermission is the minimum permission on the fork repository
+	// of the users whose comments are trusted
+	TrustedPermission string `yaml:"trustedPermission"`
+	// TrustedTeams are the teams of the fork's organization whose
+	// members' comments are trusted
+	TrustedTeams []string `yaml:"trustedTeams"`
+}
+
+// Load reads a policy from the given file
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	res := &Policy{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(res); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("can't parse policy file %s: %s", path, err.Error())
+	}
+	if err := res.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %s", path, err.Error())
+	}
+	return res, nil
+}
+
+func (p *Policy) validate() error {
+	for _, r := range []*Repository{&p.Upstream, &p.Fork} {
+		if len(r.Repo) > 0 && len(strings.Split(r.Repo, "/")) != 2 {
+			return fmt.Errorf("repository must be in the form <org>/<repo>: %s", r.Repo)
+		}
+	}
+	for _, c := range p.Conflicts {
+		if len(c.Path) == 0 {
+			return fmt.Errorf("conflict rule must define a path")
+		}
+		if c.Strategy != StrategySkip && c.Strategy != StrategyApply {
+			return fmt.Errorf("conflict strategy of path %s must be one of: %s, %s", c.Path, StrategySkip, StrategyApply)
+		}
+	}
+	for _, c := range p.Ignore.Commits {
+		if !rgxIgnoreCommit.MatchString(c) {
+			return fmt.Errorf("ignored commit must be a SHA, or a prefix of it of at least 7 hexadecimal characters: %s", c)
+		}
+	}
+	if len(p.Markers.TrustedPermission) > 0 && !utils.Contains(provider.AllPermissions, p.Markers.TrustedPermission) {
+		return fmt.Errorf("trusted permission must be one of: %s", strings.Join(provider.AllPermissions, ", "))
+	}
+	for _, t := range []string{p.Branches.Sync, p.Branches.Downstream} {
+		if _, err := template.New("").Parse(t); err != nil {
+			return fmt.Errorf("invalid branch template '%s': %s", t, err.Error())
+		}
+	}
+	return nil
+}
+
+// SyncBranch returns the name of the sync output branch, or an empty
+// string if the policy does not define it
+func (p *Policy) SyncBranch(vars *BranchVars) (string, error) {
+	return renderBranch(p.Branches.Sync, vars)
+}
+
+// DownstreamBranch returns the name of the downstream output branch, or an
+// empty string if the policy does not define it
+func (p *Policy) DownstreamBranch(vars *BranchVars) (string, error) {
+	return renderBranch(p.Branches.Downstream, vars)
+}
+
+func renderBranch(tmpl string, vars *BranchVars) (string, error) {
+	if len(tmpl) == 0 {
+		return "", nil
+	}
+	if len(vars.Date) == 0 {
+		vars.Date = time.Now().Format("20060102")
+	}
+	t, err := template.New("branch").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// RepoFlagDefaults returns the values of the repository and ref flags shared
+// by the sync and downstream commands, to be used with SetFlagDefaults
+func (p *Policy) RepoFlagDefaults() map[string]string {
+	return map[string]string{
+		"repo":          p.Fork.Repo,
+		"head":          p.Fork.Head,
+		"upstream-repo": p.Upstream.Repo,
+		"upstream-head": p.Upstream.Head,
+	}
+}
+
+// MarkersFlagDefaults returns the values of the flags restricting the
+// trusted marker comments, to be used with SetFlagDefaults
+func (p *Policy) MarkersFlagDefaults() map[string]string {
+	return map[string]string{
+		"trusted-comment-permission": p.Markers.TrustedPermission,
+		"trusted-comment-team":       strings.Join(p.Markers.TrustedTeams, ","),
+	}
+}
+
+// ConflictGlobs returns the path globs of the conflict rules with the
+// given strategy
+func (p *Policy) ConflictGlobs(strategy string) []string {
+	var res []string
+	for _, c := range p.Conflicts {
+		if c.Strategy == strategy {
+			res = append(res, c.Path)
+		}
+	}
+	return res
+}
+
+// AddFlags registers in a flag set the flags for loading a policy
+func AddFlags(flags *pflag.FlagSet) {
+	flags.String("policy", "", fmt.Sprintf("the sync policy file, by default %s in the root directory of the repository if present", DefaultFileName))
+}
+
+// LoadFromFlags loads the policy specified with the flags registered through
+// AddFlags. If not specified, the default policy file is looked up in the
+// root directory of the current repository. Returns an empty policy if
+// no policy file is found.
+func LoadFromFlags(flags *pflag.FlagSet, git utils.GitHelper) (*Policy, error) {
+	path, err := flags.GetString("policy")
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		root, err := git.GetRepoRootDir()
+		if err != nil {
+			logrus.Debugf("not in a git repository, skipping policy file lookup: %s", err.Error())
+			return &Policy{}, nil
+		}
+		path = filepath.Join(root, DefaultFileName)
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return &Policy{}, nil
+		}
+	}
+	logrus.Infof("using sync policy file %s", path)
+	return Load(path)
+}
+
+// SetFlagDefaults sets the given values to the flags that have not been
+// explicitly set, so that the command line always takes precedence
+func SetFlagDefaults(flags *pflag.FlagSet, values map[string]string) error {
+	for name, value := range values {
+		f := flags.Lookup(name)
+		if f == nil || f.Changed || len(value) == 0 {
+			continue
+		}
+		if err := f.Value.Set(value); err != nil {
+			return fmt.Errorf("invalid policy value for flag --%s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
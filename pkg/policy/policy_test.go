@@ -0,0 +1,81 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePolicy(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		p, err := Load(writePolicy(t, `
+upstream:
+  repo: falcosecurity/falco
+  head: master
+fork:
+  repo: org/falco
+  head: main
+branches:
+  sync: sync-{{ .UpstreamHead }}-{{ .Date }}
+conflicts:
+  - path: vendor/**
+    strategy: skip
+  - path: src/**
+    strategy: apply
+ignore:
+  commits: [0123abc]
+  authors: [bot]
+`))
+		assert.Nil(t, err)
+		assert.Equal(t, "org/falco", p.Fork.Repo)
+		assert.Equal(t, []string{"vendor/**"}, p.ConflictGlobs(StrategySkip))
+		assert.Equal(t, []string{"src/**"}, p.ConflictGlobs(StrategyApply))
+		branch, err := p.SyncBranch(&BranchVars{UpstreamHead: "0.36.0", Date: "20240101"})
+		assert.Nil(t, err)
+		assert.Equal(t, "sync-0.36.0-20240101", branch)
+		branch, err = p.DownstreamBranch(&BranchVars{})
+		assert.Nil(t, err)
+		assert.Empty(t, branch)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		p, err := Load(writePolicy(t, ""))
+		assert.Nil(t, err)
+		assert.Empty(t, p.Fork.Repo)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, content := range []string{
+			"unknown: true",
+			"fork:\n  repo: falco",
+			"conflicts:\n  - path: vendor/**\n    strategy: merge",
+			"branches:\n  sync: sync-{{ .UpstreamHead",
+			"ignore:\n  commits: [\"\"]",
+			"ignore:\n  commits: [0123ab]",
+			"ignore:\n  commits: [0123abz]",
+		} {
+			_, err := Load(writePolicy(t, content))
+			assert.Error(t, err)
+		}
+	})
+}
+
+func TestSetFlagDefaults(t *testing.T) {
+	var repo, head string
+	flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+	flags.StringVar(&repo, "repo", "", "")
+	flags.StringVar(&head, "head", "", "")
+	assert.Nil(t, flags.Parse([]string{"--head", "dev"}))
+	assert.Nil(t, SetFlagDefaults(flags, map[string]string{"repo": "org/repo", "head": "main", "missing": "x"}))
+	assert.Equal(t, "org/repo", repo)
+	assert.Equal(t, "dev", head)
+}
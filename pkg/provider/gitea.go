@@ -0,0 +1,275 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+)
+
+// the default maximum page size of Gitea instances
+const giteaMaxPageSize = 50
+
+// Gitea marks draft pull requests with a prefix in the title
+const giteaDraftTitlePrefix = "WIP: "
+
+type giteaProvider struct {
+	rest  *restClient
+	links *Links
+}
+
+func newGiteaProvider(opts *Options) (Provider, error) {
+	if len(opts.BaseURL) == 0 {
+		return nil, fmt.Errorf("must define the web URL of the %s instance", KindGitea)
+	}
+	baseURL := strings.TrimSuffix(opts.BaseURL, "/")
+	rest := newRestClient(opts, baseURL+"/api/v1", "GITEA_TOKEN", "Authorization", "token ")
+	rest.pageSize = giteaMaxPageSize
+	return &giteaProvider{
+		rest: rest,
+		links: &Links{
+			BaseURL:         baseURL,
+			SSHHost:         "git@" + hostOfURL(baseURL),
+			CommitPath:      "commit",
+			PullRequestPath: "pulls",
+			// note: Gitea resolves refs of any kind in tree pages without
+			// the ref type, but commits are linked explicitly anyways
+			TreePath:             "src",
+			CommitTreePath:       "src/commit",
+			PullRequestRefPrefix: "refs/pull",
+		},
+	}, nil
+}
+
+func (g *giteaProvider) Links() *Links {
+	return g.links
+}
+
+func (g *giteaProvider) repoPath(org, repo string) string {
+	return fmt.Sprintf("/repos/%s/%s", url.PathEscape(org), url.PathEscape(repo))
+}
+
+// note: the page size is capped to the instance's default maximum, which
+// is the one of the sequences too, so that a full page is not mistaken for
+// the last one
+func giteaPageQuery(o *github.ListOptions) url.Values {
+	opts := *o
+	if opts.PerPage > giteaMaxPageSize {
+		opts.PerPage = giteaMaxPageSize
+	}
+	return pageQuery(&opts, "page", "limit")
+}
+
+func identity[T interface{}](v *T) *T {
+	return v
+}
+
+func (g *giteaProvider) ListCommits(ctx context.Context, org, repo, headRef string) utils.Sequence[github.RepositoryCommit] {
+	return newRestSequence(ctx, g.rest, g.repoPath(org, repo)+"/commits",
+		func(o *github.ListOptions) url.Values {
+			q := giteaPageQuery(o)
+			q.Set("sha", headRef)
+			return q
+		}, identity[github.RepositoryCommit])
+}
+
+func (g *giteaProvider) ListPullRequestsWithCommit(ctx context.Context, org, repo, sha string) utils.Sequence[github.PullRequest] {
+	// note: Gitea only returns the pull request that introduced the commit
+	return &lazySequence[github.PullRequest]{fetch: func() ([]*github.PullRequest, error) {
+		var pr github.PullRequest
+		err := g.rest.getJSON(ctx, g.repoPath(org, repo)+"/commits/"+sha+"/pull", nil, &pr)
+		if err == errNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []*github.PullRequest{&pr}, nil
+	}}
+}
+
+func (g *giteaProvider) ListMergedPullRequests(ctx context.Context, org, repo, base string) utils.Sequence[github.PullRequest] {
+	it := newRestSequence(ctx, g.rest, g.repoPath(org, repo)+"/pulls",
+		func(o *github.ListOptions) url.Values {
+			q := giteaPageQuery(o)
+			q.Set("state", "closed")
+			q.Set("sort", "recentupdate")
+			return q
+		}, identity[github.PullRequest])
+	return utils.NewFilteredSequence(it, func(pr *github.PullRequest) bool {
+		return pr.GetBase().GetRef() == base && (pr.GetMerged() || pr.MergedAt != nil)
+	})
+}
+
+func (g *giteaProvider) ListPullRequestCommits(ctx context.Context, org, repo string, num int) utils.Sequence[github.RepositoryCommit] {
+	return newRestSequence(ctx, g.rest, fmt.Sprintf("%s/pulls/%d/commits", g.repoPath(org, repo), num),
+		giteaPageQuery, identity[github.RepositoryCommit])
+}
+
+func (g *giteaProvider) ListPullRequestFiles(ctx context.Context, org, repo string, num int) utils.Sequence[github.CommitFile] {
+	return newRestSequence(ctx, g.rest, fmt.Sprintf("%s/pulls/%d/files", g.repoPath(org, repo), num),
+		giteaPageQuery, identity[github.CommitFile])
+}
+
+func (g *giteaProvider) ListCommitComments(ctx context.Context, org, repo, sha string) utils.Sequence[github.RepositoryComment] {
+	// note: Gitea does not support comments on commits
+	return &emptySequence[github.RepositoryComment]{}
+}
+
+func (g *giteaProvider) GetPullRequest(ctx context.Context, org, repo string, num int) (*github.PullRequest, error) {
+	var pr github.PullRequest
+	err := g.rest.getJSON(ctx, fmt.Sprintf("%s/pulls/%d", g.repoPath(org, repo), num), nil, &pr)
+	if err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (g *giteaProvider) CreatePullRequest(ctx context.Context, org, repo string, pr *github.NewPullRequest) (*github.PullRequest, error) {
+	title := pr.GetTitle()
+	if pr.GetDraft() {
+		title = giteaDraftTitlePrefix + title
+	}
+	body := map[string]interface{}{
+		"head":  pr.GetHead(),
+		"base":  pr.GetBase(),
+		"title": title,
+		"body":  pr.GetBody(),
+	}
+	var res github.PullRequest
+	err := g.rest.sendJSON(ctx, http.MethodPost, g.repoPath(org, repo)+"/pulls", nil, body, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (g *giteaProvider) EditPullRequest(ctx context.Context, org, repo string, num int, pr *github.PullRequest) (*github.PullRequest, error) {
+	body := map[string]interface{}{}
+	if pr.Title != nil {
+		body["title"] = pr.GetTitle()
+	}
+	if pr.Body != nil {
+		body["body"] = pr.GetBody()
+	}
+	if pr.GetBase().Ref != nil {
+		body["base"] = pr.GetBase().GetRef()
+	}
+	var res github.PullRequest
+	err := g.rest.sendJSON(ctx, http.MethodPatch, fmt.Sprintf("%s/pulls/%d", g.repoPath(org, repo), num), nil, body, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (g *giteaProvider) EditPullRequestLabels(ctx context.Context, org, repo string, num int, add, remove []string) error {
+	path := fmt.Sprintf("%s/issues/%d/labels", g.repoPath(org, repo), num)
+	if len(add) > 0 {
+		var res []*github.Label
+		if err := g.rest.sendJSON(ctx, http.MethodPost, path, nil, map[string]interface{}{"labels": add}, &res); err != nil {
+			return err
+		}
+	}
+	if len(remove) == 0 {
+		return nil
+	}
+
+	// note: labels can only be removed by ID
+	var labels []*github.Label
+	if err := g.rest.getJSON(ctx, path, nil, &labels); err != nil {
+		return err
+	}
+	for _, l := range labels {
+		if !utils.Contains(remove, l.GetName()) {
+			continue
+		}
+		resp, err := g.rest.do(ctx, http.MethodDelete, fmt.Sprintf("%s/%d", path, l.GetID()), nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (g *giteaProvider) SearchPullRequests(ctx context.Context, org, repo, text string) ([]*github.PullRequest, error) {
+	issues, err := utils.CollectSequence(newRestSequence(ctx, g.rest, g.repoPath(org, repo)+"/issues",
+		func(o *github.ListOptions) url.Values {
+			q := giteaPageQuery(o)
+			q.Set("state", "all")
+			q.Set("type", "pulls")
+			q.Set("q", text)
+			return q
+		}, identity[github.Issue]))
+	if err != nil {
+		return nil, err
+	}
+	var res []*github.PullRequest
+	for _, issue := range issues {
+		if strings.Contains(issue.GetTitle(), text) {
+			res = append(res, &github.PullRequest{
+				Number:  issue.Number,
+				Title:   issue.Title,
+				Body:    issue.Body,
+				State:   issue.State,
+				HTMLURL: issue.HTMLURL,
+				User:    issue.User,
+				Labels:  issue.Labels,
+			})
+		}
+	}
+	return res, nil
+}
+
+func (g *giteaProvider) GetCommitDiff(ctx context.Context, org, repo, sha string) (string, error) {
+	return g.rest.getRaw(ctx, g.repoPath(org, repo)+"/git/commits/"+sha+".diff", nil)
+}
+
+func (g *giteaProvider) GetUserPermission(ctx context.Context, org, repo, user string) (string, error) {
+	var res struct {
+		Permission string `json:"permission"`
+	}
+	err := g.rest.getJSON(ctx, fmt.Sprintf("%s/collaborators/%s/permission", g.repoPath(org, repo), url.PathEscape(user)), nil, &res)
+	if err == errNotFound {
+		return PermissionNone, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if res.Permission == "owner" {
+		return PermissionAdmin, nil
+	}
+	return res.Permission, nil
+}
+
+func (g *giteaProvider) IsTeamMember(ctx context.Context, org, team, user string) (bool, error) {
+	var teams struct {
+		Data []*struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	err := g.rest.getJSON(ctx, fmt.Sprintf("/orgs/%s/teams/search", url.PathEscape(org)), url.Values{"q": []string{team}}, &teams)
+	if err == errNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, t := range teams.Data {
+		if strings.EqualFold(t.Name, team) {
+			var member github.User
+			err := g.rest.getJSON(ctx, fmt.Sprintf("/teams/%d/members/%s", t.ID, url.PathEscape(user)), nil, &member)
+			if err == errNotFound {
+				return false, nil
+			}
+			return err == nil, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,242 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+)
+
+const githubDefaultURL = "https://github.com"
+
+type githubProvider struct {
+	client *github.Client
+	links  *Links
+}
+
+func newGitHubProvider(opts *Options) (Provider, error) {
+	client := utils.GetGithubClient(opts.NoCache)
+	baseURL := githubDefaultURL
+	if len(opts.BaseURL) > 0 && strings.TrimSuffix(opts.BaseURL, "/") != githubDefaultURL {
+		baseURL = strings.TrimSuffix(opts.BaseURL, "/")
+		var err error
+		client, err = client.WithEnterpriseURLs(baseURL+"/api/v3/", baseURL+"/api/uploads/")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &githubProvider{
+		client: client,
+		links: &Links{
+			BaseURL:              baseURL,
+			SSHHost:              "git@" + hostOfURL(baseURL),
+			CommitPath:           "commit",
+			PullRequestPath:      "pull",
+			TreePath:             "tree",
+			PullRequestRefPrefix: "refs/pull",
+		},
+	}, nil
+}
+
+func (g *githubProvider) Links() *Links {
+	return g.links
+}
+
+func (g *githubProvider) ListCommits(ctx context.Context, org, repo, headRef string) utils.Sequence[github.RepositoryCommit] {
+	return utils.NewGithubSequence(ctx,
+		func(o *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+			return g.client.Repositories.ListCommits(ctx, org, repo, &github.CommitsListOptions{
+				SHA:         headRef,
+				ListOptions: *o,
+			})
+		})
+}
+
+func (g *githubProvider) ListPullRequestsWithCommit(ctx context.Context, org, repo, sha string) utils.Sequence[github.PullRequest] {
+	return utils.NewGithubSequence(ctx,
+		func(o *github.ListOptions) ([]*github.PullRequest, *github.Response, error) {
+			return g.client.PullRequests.ListPullRequestsWithCommit(ctx, org, repo, sha, o)
+		})
+}
+
+func (g *githubProvider) ListMergedPullRequests(ctx context.Context, org, repo, base string) utils.Sequence[github.PullRequest] {
+	it := utils.NewGithubSequence(ctx,
+		func(o *github.ListOptions) ([]*github.PullRequest, *github.Response, error) {
+			return g.client.PullRequests.List(ctx, org, repo, &github.PullRequestListOptions{
+				ListOptions: *o,
+				Base:        base,
+				State:       "closed",
+				Sort:        "updated",
+				Direction:   "desc",
+			})
+		})
+	return utils.NewFilteredSequence(it, func(pr *github.PullRequest) bool {
+		return (pr.Merged != nil && pr.GetMerged()) || pr.MergedAt != nil
+	})
+}
+
+func (g *githubProvider) ListPullRequestCommits(ctx context.Context, org, repo string, num int) utils.Sequence[github.RepositoryCommit] {
+	return utils.NewGithubSequence(ctx,
+		func(o *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+			return g.client.PullRequests.ListCommits(ctx, org, repo, num, o)
+		})
+}
+
+func (g *githubProvider) ListPullRequestFiles(ctx context.Context, org, repo string, num int) utils.Sequence[github.CommitFile] {
+	return utils.NewGithubSequence(ctx,
+		func(o *github.ListOptions) ([]*github.CommitFile, *github.Response, error) {
+			return g.client.PullRequests.ListFiles(ctx, org, repo, num, o)
+		})
+}
+
+func (g *githubProvider) ListCommitComments(ctx context.Context, org, repo, sha string) utils.Sequence[github.RepositoryComment] {
+	return utils.NewGithubSequence(ctx,
+		func(o *github.ListOptions) ([]*github.RepositoryComment, *github.Response, error) {
+			return g.client.Repositories.ListCommitComments(ctx, org, repo, sha, o)
+		})
+}
+
+func (g *githubProvider) GetPullRequest(ctx context.Context, org, repo string, num int) (*github.PullRequest, error) {
+	pr, _, err := utils.RetryGithubCall(ctx, true, func() (*github.PullRequest, *github.Response, error) {
+		return g.client.PullRequests.Get(ctx, org, repo, num)
+	})
+	return pr, err
+}
+
+func (g *githubProvider) CreatePullRequest(ctx context.Context, org, repo string, pr *github.NewPullRequest) (*github.PullRequest, error) {
+	res, _, err := utils.RetryGithubCall(ctx, false, func() (*github.PullRequest, *github.Response, error) {
+		return g.client.PullRequests.Create(ctx, org, repo, pr)
+	})
+	return res, err
+}
+
+func (g *githubProvider) EditPullRequest(ctx context.Context, org, repo string, num int, pr *github.PullRequest) (*github.PullRequest, error) {
+	res, _, err := utils.RetryGithubCall(ctx, false, func() (*github.PullRequest, *github.Response, error) {
+		return g.client.PullRequests.Edit(ctx, org, repo, num, pr)
+	})
+	return res, err
+}
+
+func (g *githubProvider) EditPullRequestLabels(ctx context.Context, org, repo string, num int, add, remove []string) error {
+	if len(add) > 0 {
+		_, _, err := utils.RetryGithubCall(ctx, false, func() ([]*github.Label, *github.Response, error) {
+			return g.client.Issues.AddLabelsToIssue(ctx, org, repo, num, add)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, label := range remove {
+		_, resp, err := utils.RetryGithubCall(ctx, false, func() (interface{}, *github.Response, error) {
+			resp, err := g.client.Issues.RemoveLabelForIssue(ctx, org, repo, num, label)
+			return nil, resp, err
+		})
+		if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *githubProvider) SearchPullRequests(ctx context.Context, org, repo, text string) ([]*github.PullRequest, error) {
+	searchFilter := fmt.Sprintf("type:pr repo:\"%s/%s\" \"%s\"", org, repo, text)
+	searchRes, _, err := utils.RetryGithubCall(ctx, true, func() (*github.IssuesSearchResult, *github.Response, error) {
+		return g.client.Search.Issues(ctx, searchFilter, &github.SearchOptions{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res []*github.PullRequest
+	for _, issue := range searchRes.Issues {
+		if issue.IsPullRequest() && strings.Contains(issue.GetTitle(), text) {
+			res = append(res, &github.PullRequest{
+				Number:  issue.Number,
+				Title:   issue.Title,
+				Body:    issue.Body,
+				State:   issue.State,
+				HTMLURL: issue.HTMLURL,
+				User:    issue.User,
+				Labels:  issue.Labels,
+			})
+		}
+	}
+	return res, nil
+}
+
+func (g *githubProvider) GetCommitDiff(ctx context.Context, org, repo, sha string) (string, error) {
+	// retrieve commit through GitHub APIs
+	commit, _, err := utils.RetryGithubCall(ctx, true, func() (*github.RepositoryCommit, *github.Response, error) {
+		return g.client.Repositories.GetCommit(ctx, org, repo, sha, nil)
+	})
+	if err != nil {
+		return "", err
+	}
+	if commit.HTMLURL == nil {
+		return "", fmt.Errorf("can't find HTML url for commit: %s", sha)
+	}
+
+	// in GitHub, by convention adding ".diff" to the HTML url returns the commit's diff.
+	url := commit.GetHTMLURL() + ".diff"
+
+	// perform the get request with the GitHub client to preserve authentication
+	resp, err := g.client.Client().Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// read commit's diff -- bound read size to 100 MB as we can't trust anyone
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDiffSize))
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func (g *githubProvider) GetUserPermission(ctx context.Context, org, repo, user string) (string, error) {
+	level, resp, err := utils.RetryGithubCall(ctx, true, func() (*github.RepositoryPermissionLevel, *github.Response, error) {
+		return g.client.Repositories.GetPermissionLevel(ctx, org, repo, user)
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return PermissionNone, nil
+		}
+		return "", err
+	}
+
+	// note: the permission field only distinguishes admin, write, and read,
+	// so we use the more granular role of the user when available
+	perms := level.GetUser().GetPermissions()
+	for _, p := range []struct{ key, perm string }{
+		{"admin", PermissionAdmin},
+		{"maintain", PermissionMaintain},
+		{"push", PermissionWrite},
+		{"triage", PermissionTriage},
+		{"pull", PermissionRead},
+	} {
+		if perms[p.key] {
+			return p.perm, nil
+		}
+	}
+	if len(level.GetPermission()) == 0 {
+		return PermissionNone, nil
+	}
+	return level.GetPermission(), nil
+}
+
+func (g *githubProvider) IsTeamMember(ctx context.Context, org, team, user string) (bool, error) {
+	m, resp, err := utils.RetryGithubCall(ctx, true, func() (*github.Membership, *github.Response, error) {
+		return g.client.Teams.GetTeamMembershipBySlug(ctx, org, team, user)
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return m.GetState() == "active", nil
+}
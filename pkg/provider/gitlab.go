@@ -0,0 +1,407 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+)
+
+const gitlabDefaultURL = "https://gitlab.com"
+
+// GitLab marks draft merge requests with a prefix in the title
+const gitlabDraftTitlePrefix = "Draft: "
+
+type gitlabProvider struct {
+	rest  *restClient
+	links *Links
+}
+
+func newGitLabProvider(opts *Options) (Provider, error) {
+	baseURL := gitlabDefaultURL
+	if len(opts.BaseURL) > 0 {
+		baseURL = strings.TrimSuffix(opts.BaseURL, "/")
+	}
+	return &gitlabProvider{
+		rest: newRestClient(opts, baseURL+"/api/v4", "GITLAB_TOKEN", "PRIVATE-TOKEN", ""),
+		links: &Links{
+			BaseURL:              baseURL,
+			SSHHost:              "git@" + hostOfURL(baseURL),
+			CommitPath:           "-/commit",
+			PullRequestPath:      "-/merge_requests",
+			TreePath:             "-/tree",
+			PullRequestRefPrefix: "refs/merge-requests",
+		},
+	}, nil
+}
+
+type gitlabUser struct {
+	Username string `json:"username"`
+	WebURL   string `json:"web_url"`
+}
+
+type gitlabMember struct {
+	ID          int `json:"id"`
+	AccessLevel int `json:"access_level"`
+}
+
+type gitlabCommit struct {
+	ID          string     `json:"id"`
+	Message     string     `json:"message"`
+	AuthorName  string     `json:"author_name"`
+	AuthorEmail string     `json:"author_email"`
+	AuthoredAt  *time.Time `json:"authored_date"`
+	WebURL      string     `json:"web_url"`
+}
+
+type gitlabMergeRequest struct {
+	IID             int          `json:"iid"`
+	Title           string       `json:"title"`
+	Description     string       `json:"description"`
+	State           string       `json:"state"`
+	WebURL          string       `json:"web_url"`
+	TargetBranch    string       `json:"target_branch"`
+	SourceBranch    string       `json:"source_branch"`
+	MergedAt        *time.Time   `json:"merged_at"`
+	UpdatedAt       *time.Time   `json:"updated_at"`
+	MergeCommitSHA  string       `json:"merge_commit_sha"`
+	SquashCommitSHA string       `json:"squash_commit_sha"`
+	SHA             string       `json:"sha"`
+	Draft           bool         `json:"draft"`
+	Labels          []string     `json:"labels"`
+	Author          *gitlabUser  `json:"author"`
+	Milestone       *gitlabTitle `json:"milestone"`
+}
+
+type gitlabTitle struct {
+	Title string `json:"title"`
+}
+
+type gitlabNote struct {
+	Note   string      `json:"note"`
+	Author *gitlabUser `json:"author"`
+}
+
+type gitlabDiff struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	Diff        string `json:"diff"`
+	NewFile     bool   `json:"new_file"`
+	DeletedFile bool   `json:"deleted_file"`
+	RenamedFile bool   `json:"renamed_file"`
+}
+
+func (g *gitlabProvider) Links() *Links {
+	return g.links
+}
+
+func (g *gitlabProvider) projectPath(org, repo string) string {
+	return "/projects/" + url.PathEscape(fmt.Sprintf("%s/%s", org, repo))
+}
+
+func (g *gitlabProvider) convertCommit(c *gitlabCommit) *github.RepositoryCommit {
+	res := &github.RepositoryCommit{
+		SHA:     github.String(c.ID),
+		HTMLURL: github.String(c.WebURL),
+		Commit: &github.Commit{
+			SHA:     github.String(c.ID),
+			Message: github.String(c.Message),
+			Author: &github.CommitAuthor{
+				Name:  github.String(c.AuthorName),
+				Email: github.String(c.AuthorEmail),
+			},
+		},
+	}
+	if c.AuthoredAt != nil {
+		res.Commit.Author.Date = &github.Timestamp{Time: *c.AuthoredAt}
+	}
+	return res
+}
+
+func (g *gitlabProvider) convertMergeRequest(org, repo string, mr *gitlabMergeRequest) *github.PullRequest {
+	state := "open"
+	if mr.State != "opened" {
+		state = "closed"
+	}
+	res := &github.PullRequest{
+		Number:  github.Int(mr.IID),
+		Title:   github.String(mr.Title),
+		Body:    github.String(mr.Description),
+		State:   github.String(state),
+		Draft:   github.Bool(mr.Draft),
+		HTMLURL: github.String(mr.WebURL),
+		Merged:  github.Bool(mr.State == "merged"),
+		Base: &github.PullRequestBranch{
+			Ref:  github.String(mr.TargetBranch),
+			Repo: &github.Repository{FullName: github.String(fmt.Sprintf("%s/%s", org, repo))},
+		},
+		Head: &github.PullRequestBranch{
+			Ref: github.String(mr.SourceBranch),
+			SHA: github.String(mr.SHA),
+		},
+	}
+	if mr.MergedAt != nil {
+		res.MergedAt = &github.Timestamp{Time: *mr.MergedAt}
+	}
+	if mr.UpdatedAt != nil {
+		res.UpdatedAt = &github.Timestamp{Time: *mr.UpdatedAt}
+	}
+	if len(mr.SquashCommitSHA) > 0 {
+		res.MergeCommitSHA = github.String(mr.SquashCommitSHA)
+	} else if len(mr.MergeCommitSHA) > 0 {
+		res.MergeCommitSHA = github.String(mr.MergeCommitSHA)
+	}
+	if mr.Author != nil {
+		res.User = &github.User{Login: github.String(mr.Author.Username)}
+	}
+	if mr.Milestone != nil {
+		res.Milestone = &github.Milestone{Title: github.String(mr.Milestone.Title)}
+	}
+	for _, l := range mr.Labels {
+		res.Labels = append(res.Labels, &github.Label{Name: github.String(l)})
+	}
+	return res
+}
+
+func (g *gitlabProvider) ListCommits(ctx context.Context, org, repo, headRef string) utils.Sequence[github.RepositoryCommit] {
+	return newRestSequence(ctx, g.rest, g.projectPath(org, repo)+"/repository/commits",
+		func(o *github.ListOptions) url.Values {
+			q := pageQuery(o, "page", "per_page")
+			q.Set("ref_name", headRef)
+			return q
+		}, g.convertCommit)
+}
+
+func (g *gitlabProvider) ListPullRequestsWithCommit(ctx context.Context, org, repo, sha string) utils.Sequence[github.PullRequest] {
+	return newRestSequence(ctx, g.rest, g.projectPath(org, repo)+"/repository/commits/"+sha+"/merge_requests",
+		func(o *github.ListOptions) url.Values {
+			return pageQuery(o, "page", "per_page")
+		},
+		func(mr *gitlabMergeRequest) *github.PullRequest {
+			return g.convertMergeRequest(org, repo, mr)
+		})
+}
+
+func (g *gitlabProvider) ListMergedPullRequests(ctx context.Context, org, repo, base string) utils.Sequence[github.PullRequest] {
+	return newRestSequence(ctx, g.rest, g.projectPath(org, repo)+"/merge_requests",
+		func(o *github.ListOptions) url.Values {
+			q := pageQuery(o, "page", "per_page")
+			q.Set("state", "merged")
+			q.Set("target_branch", base)
+			q.Set("order_by", "updated_at")
+			q.Set("sort", "desc")
+			return q
+		},
+		func(mr *gitlabMergeRequest) *github.PullRequest {
+			return g.convertMergeRequest(org, repo, mr)
+		})
+}
+
+func (g *gitlabProvider) ListPullRequestCommits(ctx context.Context, org, repo string, num int) utils.Sequence[github.RepositoryCommit] {
+	return newRestSequence(ctx, g.rest, fmt.Sprintf("%s/merge_requests/%d/commits", g.projectPath(org, repo), num),
+		func(o *github.ListOptions) url.Values {
+			return pageQuery(o, "page", "per_page")
+		}, g.convertCommit)
+}
+
+func (g *gitlabProvider) ListPullRequestFiles(ctx context.Context, org, repo string, num int) utils.Sequence[github.CommitFile] {
+	return newRestSequence(ctx, g.rest, fmt.Sprintf("%s/merge_requests/%d/diffs", g.projectPath(org, repo), num),
+		func(o *github.ListOptions) url.Values {
+			return pageQuery(o, "page", "per_page")
+		},
+		func(d *gitlabDiff) *github.CommitFile {
+			res := &github.CommitFile{Filename: github.String(d.NewPath), Status: github.String("modified")}
+			switch {
+			case d.NewFile:
+				res.Status = github.String("added")
+			case d.DeletedFile:
+				res.Status = github.String("removed")
+			case d.RenamedFile:
+				res.Status = github.String("renamed")
+				res.PreviousFilename = github.String(d.OldPath)
+			}
+			return res
+		})
+}
+
+func (g *gitlabProvider) ListCommitComments(ctx context.Context, org, repo, sha string) utils.Sequence[github.RepositoryComment] {
+	return newRestSequence(ctx, g.rest, g.projectPath(org, repo)+"/repository/commits/"+sha+"/comments",
+		func(o *github.ListOptions) url.Values {
+			return pageQuery(o, "page", "per_page")
+		},
+		func(n *gitlabNote) *github.RepositoryComment {
+			res := &github.RepositoryComment{
+				Body:     github.String(n.Note),
+				CommitID: github.String(sha),
+				HTMLURL:  github.String(g.links.Commit(org, repo, sha)),
+			}
+			if n.Author != nil {
+				res.User = &github.User{Login: github.String(n.Author.Username)}
+			}
+			return res
+		})
+}
+
+func (g *gitlabProvider) GetPullRequest(ctx context.Context, org, repo string, num int) (*github.PullRequest, error) {
+	var mr gitlabMergeRequest
+	err := g.rest.getJSON(ctx, fmt.Sprintf("%s/merge_requests/%d", g.projectPath(org, repo), num), nil, &mr)
+	if err != nil {
+		return nil, err
+	}
+	return g.convertMergeRequest(org, repo, &mr), nil
+}
+
+func (g *gitlabProvider) CreatePullRequest(ctx context.Context, org, repo string, pr *github.NewPullRequest) (*github.PullRequest, error) {
+	title := pr.GetTitle()
+	if pr.GetDraft() {
+		title = gitlabDraftTitlePrefix + title
+	}
+	body := map[string]interface{}{
+		"source_branch": pr.GetHead(),
+		"target_branch": pr.GetBase(),
+		"title":         title,
+		"description":   pr.GetBody(),
+	}
+	var mr gitlabMergeRequest
+	err := g.rest.sendJSON(ctx, http.MethodPost, g.projectPath(org, repo)+"/merge_requests", nil, body, &mr)
+	if err != nil {
+		return nil, err
+	}
+	return g.convertMergeRequest(org, repo, &mr), nil
+}
+
+func (g *gitlabProvider) EditPullRequest(ctx context.Context, org, repo string, num int, pr *github.PullRequest) (*github.PullRequest, error) {
+	body := map[string]interface{}{}
+	if pr.Title != nil {
+		body["title"] = pr.GetTitle()
+	}
+	if pr.Body != nil {
+		body["description"] = pr.GetBody()
+	}
+	if pr.GetBase().Ref != nil {
+		body["target_branch"] = pr.GetBase().GetRef()
+	}
+	var mr gitlabMergeRequest
+	err := g.rest.sendJSON(ctx, http.MethodPut, fmt.Sprintf("%s/merge_requests/%d", g.projectPath(org, repo), num), nil, body, &mr)
+	if err != nil {
+		return nil, err
+	}
+	return g.convertMergeRequest(org, repo, &mr), nil
+}
+
+func (g *gitlabProvider) EditPullRequestLabels(ctx context.Context, org, repo string, num int, add, remove []string) error {
+	body := map[string]interface{}{
+		"add_labels":    strings.Join(add, ","),
+		"remove_labels": strings.Join(remove, ","),
+	}
+	var mr gitlabMergeRequest
+	return g.rest.sendJSON(ctx, http.MethodPut, fmt.Sprintf("%s/merge_requests/%d", g.projectPath(org, repo), num), nil, body, &mr)
+}
+
+func (g *gitlabProvider) SearchPullRequests(ctx context.Context, org, repo, text string) ([]*github.PullRequest, error) {
+	seq := newRestSequence(ctx, g.rest, g.projectPath(org, repo)+"/merge_requests",
+		func(o *github.ListOptions) url.Values {
+			q := pageQuery(o, "page", "per_page")
+			q.Set("state", "all")
+			q.Set("search", text)
+			q.Set("in", "title")
+			return q
+		},
+		func(mr *gitlabMergeRequest) *github.PullRequest {
+			return g.convertMergeRequest(org, repo, mr)
+		})
+	return utils.CollectSequence(utils.NewFilteredSequence(seq, func(pr *github.PullRequest) bool {
+		return strings.Contains(pr.GetTitle(), text)
+	}))
+}
+
+func (g *gitlabProvider) GetCommitDiff(ctx context.Context, org, repo, sha string) (string, error) {
+	diffs, err := utils.CollectSequence(newRestSequence(ctx, g.rest, g.projectPath(org, repo)+"/repository/commits/"+sha+"/diff",
+		func(o *github.ListOptions) url.Values {
+			return pageQuery(o, "page", "per_page")
+		},
+		func(d *gitlabDiff) *gitlabDiff {
+			return d
+		}))
+	if err != nil {
+		return "", err
+	}
+
+	// the APIs only return the hunks of each file, so we rebuild the
+	// git-style headers of the unified diff
+	var res strings.Builder
+	for _, d := range diffs {
+		oldPath, newPath := "a/"+d.OldPath, "b/"+d.NewPath
+		if d.NewFile {
+			oldPath = "/dev/null"
+		}
+		if d.DeletedFile {
+			newPath = "/dev/null"
+		}
+		res.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", d.OldPath, d.NewPath))
+		res.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldPath, newPath))
+		res.WriteString(d.Diff)
+	}
+	return res.String(), nil
+}
+
+// returns the ID of the user with the given username
+func (g *gitlabProvider) userID(ctx context.Context, user string) (int, error) {
+	var users []*gitlabMember
+	err := g.rest.getJSON(ctx, "/users", url.Values{"username": []string{user}}, &users)
+	if err != nil {
+		return 0, err
+	}
+	if len(users) == 0 {
+		return 0, errNotFound
+	}
+	return users[0].ID, nil
+}
+
+func (g *gitlabProvider) GetUserPermission(ctx context.Context, org, repo, user string) (string, error) {
+	id, err := g.userID(ctx, user)
+	if err == nil {
+		var m gitlabMember
+		err = g.rest.getJSON(ctx, fmt.Sprintf("%s/members/all/%d", g.projectPath(org, repo), id), nil, &m)
+		if err == nil {
+			// see: https://docs.gitlab.com/ee/api/members.html#roles
+			// note: guests can't read the repository's code, so
+			// they have no permission in the sense of the other
+			// providers, and reporters are the closest to read
+			switch {
+			case m.AccessLevel >= 50:
+				return PermissionAdmin, nil
+			case m.AccessLevel >= 40:
+				return PermissionMaintain, nil
+			case m.AccessLevel >= 30:
+				return PermissionWrite, nil
+			case m.AccessLevel >= 20:
+				return PermissionRead, nil
+			}
+			return PermissionNone, nil
+		}
+	}
+	if err == errNotFound {
+		return PermissionNone, nil
+	}
+	return "", err
+}
+
+// note: teams are represented by subgroups of the organization's group
+func (g *gitlabProvider) IsTeamMember(ctx context.Context, org, team, user string) (bool, error) {
+	id, err := g.userID(ctx, user)
+	if err == nil {
+		var m gitlabMember
+		group := url.PathEscape(fmt.Sprintf("%s/%s", org, team))
+		err = g.rest.getJSON(ctx, fmt.Sprintf("/groups/%s/members/all/%d", group, id), nil, &m)
+	}
+	if err == errNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
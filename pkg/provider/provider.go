@@ -0,0 +1,260 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// KindGitHub is the provider kind for GitHub and GitHub Enterprise
+	KindGitHub = "github"
+
+	// KindGitLab is the provider kind for GitLab
+	KindGitLab = "gitlab"
+
+	// KindGitea is the provider kind for Gitea and Forgejo
+	KindGitea = "gitea"
+)
+
+// AllKinds is a collection of all the provider kinds supported
+var AllKinds = []string{KindGitHub, KindGitLab, KindGitea}
+
+// Provider is an abstraction over a git hosting service on which both
+// the upstream and the fork repositories are hosted. Regardless of the actual
+// hosting service, all the resources are represented with the types of the
+// GitHub client library. Sequences are iterated from the most to the
+// least recent element.
+type Provider interface {
+	//
+	// Links returns the builder for the web URLs of the provider
+	Links() *Links
+	//
+	// ListCommits returns all commits of a repository starting from the given
+	// head ref and proceeding from the most to the least recent.
+	ListCommits(ctx context.Context, org, repo, headRef string) utils.Sequence[github.RepositoryCommit]
+	//
+	// ListPullRequestsWithCommit returns all the pull requests of a
+	// repository that contain the given commit SHA.
+	ListPullRequestsWithCommit(ctx context.Context, org, repo, sha string) utils.Sequence[github.PullRequest]
+	//
+	// ListMergedPullRequests returns all the merged pull requests of a
+	// repository having the given base branch, sorted by last update.
+	ListMergedPullRequests(ctx context.Context, org, repo, base string) utils.Sequence[github.PullRequest]
+	//
+	// ListPullRequestCommits returns all the commits of a pull request.
+	ListPullRequestCommits(ctx context.Context, org, repo string, num int) utils.Sequence[github.RepositoryCommit]
+	//
+	// ListPullRequestFiles returns all the files changed by a pull request.
+	ListPullRequestFiles(ctx context.Context, org, repo string, num int) utils.Sequence[github.CommitFile]
+	//
+	// ListCommitComments returns all the comments of a commit.
+	ListCommitComments(ctx context.Context, org, repo, sha string) utils.Sequence[github.RepositoryComment]
+	//
+	// GetPullRequest returns a pull request given its number.
+	GetPullRequest(ctx context.Context, org, repo string, num int) (*github.PullRequest, error)
+	//
+	// CreatePullRequest opens a new pull request.
+	CreatePullRequest(ctx context.Context, org, repo string, pr *github.NewPullRequest) (*github.PullRequest, error)
+	//
+	// EditPullRequest updates the title, body, and base branch of a pull
+	// request, leaving the ones not set unchanged.
+	EditPullRequest(ctx context.Context, org, repo string, num int, pr *github.PullRequest) (*github.PullRequest, error)
+	//
+	// EditPullRequestLabels adds and removes the given labels of a pull
+	// request. Removing a label not set on the pull request is not an error.
+	EditPullRequestLabels(ctx context.Context, org, repo string, num int, add, remove []string) error
+	//
+	// SearchPullRequests returns all the pull requests of a repository,
+	// in any state, having a title containing the given text.
+	SearchPullRequests(ctx context.Context, org, repo, text string) ([]*github.PullRequest, error)
+	//
+	// GetCommitDiff returns the diff of a commit in the unified format.
+	GetCommitDiff(ctx context.Context, org, repo, sha string) (string, error)
+	//
+	// GetUserPermission returns the permission of a user on a repository,
+	// which is one of AllPermissions.
+	GetUserPermission(ctx context.Context, org, repo, user string) (string, error)
+	//
+	// IsTeamMember returns true if a user is a member of a team (or group)
+	// of an organization.
+	IsTeamMember(ctx context.Context, org, team, user string) (bool, error)
+}
+
+const (
+	PermissionNone     = "none"
+	PermissionRead     = "read"
+	PermissionTriage   = "triage"
+	PermissionWrite    = "write"
+	PermissionMaintain = "maintain"
+	PermissionAdmin    = "admin"
+)
+
+// AllPermissions is a collection of all the permissions of a user on a
+// repository, from the least to the most privileged
+var AllPermissions = []string{
+	PermissionNone,
+	PermissionRead,
+	PermissionTriage,
+	PermissionWrite,
+	PermissionMaintain,
+	PermissionAdmin,
+}
+
+// PermissionAtLeast returns true if a permission is equal or more
+// privileged than the given minimum one
+func PermissionAtLeast(perm, min string) bool {
+	rank := func(p string) int {
+		for i, v := range AllPermissions {
+			if v == p {
+				return i
+			}
+		}
+		return -1
+	}
+	return rank(perm) >= 0 && rank(perm) >= rank(min)
+}
+
+// draftTitlePrefixes are the prefixes added to the title of draft pull
+// requests by the providers that mark them this way
+var draftTitlePrefixes = []string{gitlabDraftTitlePrefix, giteaDraftTitlePrefix}
+
+// TrimDraftTitlePrefix returns the title of a pull request without the
+// prefix with which the provider marks drafts, if any
+func TrimDraftTitlePrefix(title string) string {
+	for _, p := range draftTitlePrefixes {
+		if strings.HasPrefix(title, p) {
+			return strings.TrimPrefix(title, p)
+		}
+	}
+	return title
+}
+
+// Links builds the web URLs of the resources hosted by a provider
+type Links struct {
+	// BaseURL is the web URL of the hosting service (e.g. https://github.com)
+	BaseURL string `json:"baseURL"`
+	// SSHHost is the user and host used for cloning through SSH (e.g. git@github.com)
+	SSHHost string `json:"sshHost"`
+	// CommitPath is the path segment of commit pages (e.g. commit)
+	CommitPath string `json:"commitPath"`
+	// PullRequestPath is the path segment of pull request pages (e.g. pull)
+	PullRequestPath string `json:"pullRequestPath"`
+	// TreePath is the path segment of tree pages (e.g. tree)
+	TreePath string `json:"treePath"`
+	// CommitTreePath is the path segment of tree pages of commit SHAs, if
+	// different from TreePath (e.g. src/commit)
+	CommitTreePath string `json:"commitTreePath,omitempty"`
+	// PullRequestRefPrefix is the prefix of the git refs of the pull
+	// requests (e.g. refs/pull)
+	PullRequestRefPrefix string `json:"pullRequestRefPrefix"`
+}
+
+func (l *Links) Repo(org, repo string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(l.BaseURL, "/"), org, repo)
+}
+
+func (l *Links) Commit(org, repo, sha string) string {
+	return fmt.Sprintf("%s/%s/%s", l.Repo(org, repo), l.CommitPath, sha)
+}
+
+func (l *Links) PullRequest(org, repo string, num int) string {
+	return fmt.Sprintf("%s%d", l.PullRequestPrefix(org, repo), num)
+}
+
+// PullRequestPrefix returns the URL of a pull request without its number
+func (l *Links) PullRequestPrefix(org, repo string) string {
+	return fmt.Sprintf("%s/%s/", l.Repo(org, repo), l.PullRequestPath)
+}
+
+// PullRequestHeadRef returns the git ref of the head of a pull request,
+// which can be fetched from the repository even if the pull request is
+// opened from another fork
+func (l *Links) PullRequestHeadRef(num int) string {
+	return fmt.Sprintf("%s/%d/head", l.PullRequestRefPrefix, num)
+}
+
+var rgxFullSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+func (l *Links) Tree(org, repo, ref string) string {
+	path := l.TreePath
+	if len(l.CommitTreePath) > 0 && rgxFullSHA.MatchString(ref) {
+		path = l.CommitTreePath
+	}
+	return fmt.Sprintf("%s/%s/%s", l.Repo(org, repo), path, ref)
+}
+
+func (l *Links) SSHClone(org, repo string) string {
+	return fmt.Sprintf("%s:%s/%s.git", l.SSHHost, org, repo)
+}
+
+// Options contains the configuration used for creating a provider
+type Options struct {
+	// Kind is the kind of the provider, one of AllKinds
+	Kind string `json:"kind"`
+	// BaseURL is the web URL of the hosting service. If empty, the public
+	// instance of the given kind of provider is used.
+	BaseURL string `json:"baseURL,omitempty"`
+	// NoCache disables the persistent cache of the API responses
+	NoCache bool `json:"noCache,omitempty"`
+}
+
+// New creates a new provider with the given options
+func New(opts *Options) (Provider, error) {
+	switch opts.Kind {
+	case KindGitHub:
+		return newGitHubProvider(opts)
+	case KindGitLab:
+		return newGitLabProvider(opts)
+	case KindGitea:
+		return newGiteaProvider(opts)
+	default:
+		return nil, fmt.Errorf("unsupported provider '%s', must be one of: %s", opts.Kind, strings.Join(AllKinds, ", "))
+	}
+}
+
+// AddFlags registers in a flag set the flags for configuring a provider
+func AddFlags(flags *pflag.FlagSet) {
+	flags.String("provider", KindGitHub, fmt.Sprintf("the hosting service of the repositories, one of: %s", strings.Join(AllKinds, ", ")))
+	flags.String("provider-url", "", "the web URL of the hosting service, if not the public instance of the provider")
+	flags.Bool("no-cache", false, "if true, the responses of the provider APIs are not cached on disk")
+}
+
+// NewFromFlags creates a new provider configured with the flags
+// registered through AddFlags
+func NewFromFlags(flags *pflag.FlagSet) (Provider, error) {
+	opts, err := OptionsFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+	return New(opts)
+}
+
+// OptionsFromFlags returns the provider options configured with the flags
+// registered by AddFlags
+func OptionsFromFlags(flags *pflag.FlagSet) (*Options, error) {
+	kind, err := flags.GetString("provider")
+	if err != nil {
+		return nil, err
+	}
+	baseURL, err := flags.GetString("provider-url")
+	if err != nil {
+		return nil, err
+	}
+	noCache, err := flags.GetBool("no-cache")
+	if err != nil {
+		return nil, err
+	}
+	return &Options{Kind: kind, BaseURL: baseURL, NoCache: noCache}, nil
+}
+
+// hostOfURL returns the host part of a web URL
+func hostOfURL(u string) string {
+	u = strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://")
+	return strings.Split(u, "/")[0]
+}
@@ -0,0 +1,178 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// bound read size to 100 MB as we can't trust anyone
+const maxDiffSize = 100 * 1024 * 1024
+
+// restClient is a minimal client for the JSON REST APIs of the providers
+// for which no dedicated client library is used
+type restClient struct {
+	client     *http.Client
+	apiURL     string
+	authHeader string
+	authValue  string
+	// pageSize is the number of elements requested for each page of the
+	// list endpoints, which must not exceed the maximum of the API
+	pageSize int
+}
+
+// creates a new REST client authenticated with the token read from the
+// given env variable, if set
+func newRestClient(opts *Options, apiURL, tokenEnv, authHeader, authPrefix string) *restClient {
+	res := &restClient{client: utils.NewHTTPClient(opts.NoCache), apiURL: apiURL, authHeader: authHeader, pageSize: 100}
+	token := os.Getenv(tokenEnv)
+	if len(token) > 0 {
+		res.authValue = authPrefix + token
+	} else {
+		logrus.Warnf("the %s env variable is not set, you may encounter authentication or rate limiting issues", tokenEnv)
+	}
+	return res
+}
+
+// errNotFound is returned when the API responds with a 404 status code
+var errNotFound = fmt.Errorf("resource not found")
+
+func (r *restClient) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	u := r.apiURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(r.authValue) > 0 {
+		req.Header.Set(r.authHeader, r.authValue)
+	}
+	logrus.Debugf("%s %s", method, u)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, errNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s %s: %d %s", method, u, resp.StatusCode, string(msg))
+	}
+	return resp, nil
+}
+
+func (r *restClient) getJSON(ctx context.Context, path string, query url.Values, out interface{}) error {
+	return r.sendJSON(ctx, http.MethodGet, path, query, nil, out)
+}
+
+func (r *restClient) sendJSON(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	resp, err := r.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (r *restClient) getRaw(ctx context.Context, path string, query url.Values) (string, error) {
+	resp, err := r.do(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDiffSize))
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// newRestSequence creates a sequence iterating over the pages of a REST
+// list endpoint, in which the query of each page is built by the given
+// function and each element is converted from the API's type.
+func newRestSequence[T interface{}, R interface{}](ctx context.Context, r *restClient, path string, query func(*github.ListOptions) url.Values, convert func(*R) *T) utils.Sequence[T] {
+	return utils.NewGithubSequenceWithPageSize(ctx, r.pageSize,
+		func(o *github.ListOptions) ([]*T, *github.Response, error) {
+			var page []*R
+			err := r.getJSON(ctx, path, query(o), &page)
+			if err != nil {
+				return nil, nil, err
+			}
+			var res []*T
+			for _, v := range page {
+				res = append(res, convert(v))
+			}
+			return res, nil, nil
+		})
+}
+
+// emptySequence is a sequence with no elements
+type emptySequence[T interface{}] struct{}
+
+func (e *emptySequence[T]) Next() *T {
+	return nil
+}
+
+func (e *emptySequence[T]) Error() error {
+	return nil
+}
+
+// lazySequence is a sequence iterating over the elements retrieved all at
+// once by the given function, which is invoked only once the sequence is
+// consumed
+type lazySequence[T interface{}] struct {
+	fetch   func() ([]*T, error)
+	fetched bool
+	values  []*T
+	err     error
+}
+
+func (s *lazySequence[T]) Next() *T {
+	if !s.fetched {
+		s.values, s.err = s.fetch()
+		s.fetched = true
+	}
+	if s.err != nil || len(s.values) == 0 {
+		return nil
+	}
+	res := s.values[0]
+	s.values = s.values[1:]
+	return res
+}
+
+func (s *lazySequence[T]) Error() error {
+	return s.err
+}
+
+func pageQuery(o *github.ListOptions, pageParam, sizeParam string) url.Values {
+	q := url.Values{}
+	q.Set(pageParam, strconv.Itoa(o.Page))
+	q.Set(sizeParam, strconv.Itoa(o.PerPage))
+	return q
+}
@@ -0,0 +1,181 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitLabProvider(t *testing.T) {
+	const numCommits = 150
+	handlers := map[string]http.HandlerFunc{}
+	handlers["/api/v4/projects/org%2Frepo/repository/commits"] = func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "main", r.URL.Query().Get("ref_name"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		var res []map[string]interface{}
+		for i := (page - 1) * perPage; i < page*perPage && i < numCommits; i++ {
+			res = append(res, map[string]interface{}{
+				"id":      fmt.Sprintf("sha%d", i),
+				"message": fmt.Sprintf("commit %d", i),
+			})
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+	handlers["/api/v4/projects/org%2Frepo/merge_requests/7"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"iid": 7, "title": "fix", "state": "merged", "merged_at": "2023-01-01T00:00:00Z",
+			"target_branch": "main", "squash_commit_sha": "abc", "labels": ["bug"], "author": {"username": "user"}}`))
+	}
+	handlers["/api/v4/projects/org%2Frepo/merge_requests/7/diffs"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"old_path": "a.go", "new_path": "a.go"}, {"old_path": "b.go", "new_path": "b.go", "new_file": true},
+			{"old_path": "c.go", "new_path": "d.go", "renamed_file": true}]`))
+	}
+	handlers["/api/v4/users"] = func(w http.ResponseWriter, r *http.Request) {
+		ids := map[string]int{"guest": 10, "reporter": 20, "developer": 30}
+		id, ok := ids[r.URL.Query().Get("username")]
+		if !ok {
+			w.Write([]byte(`[]`))
+			return
+		}
+		fmt.Fprintf(w, `[{"id": %d}]`, id)
+	}
+	for _, level := range []int{10, 20, 30} {
+		level := level
+		handlers[fmt.Sprintf("/api/v4/projects/org%%2Frepo/members/all/%d", level)] = func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"id": %d, "access_level": %d}`, level, level)
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, ok := handlers[r.URL.EscapedPath()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		h(w, r)
+	}))
+	defer server.Close()
+
+	p, err := New(&Options{Kind: KindGitLab, BaseURL: server.URL})
+	require.NoError(t, err)
+
+	t.Run("list-commits", func(t *testing.T) {
+		commits, err := utils.CollectSequence(p.ListCommits(context.Background(), "org", "repo", "main"))
+		require.NoError(t, err)
+		require.Len(t, commits, numCommits)
+		assert.Equal(t, "sha0", commits[0].GetSHA())
+		assert.Equal(t, "commit 149", commits[numCommits-1].GetCommit().GetMessage())
+	})
+
+	t.Run("get-pull-request", func(t *testing.T) {
+		pr, err := p.GetPullRequest(context.Background(), "org", "repo", 7)
+		require.NoError(t, err)
+		assert.Equal(t, 7, pr.GetNumber())
+		assert.Equal(t, "closed", pr.GetState())
+		assert.True(t, pr.GetMerged())
+		assert.NotNil(t, pr.MergedAt)
+		assert.Equal(t, "abc", pr.GetMergeCommitSHA())
+		assert.Equal(t, "org/repo", pr.GetBase().GetRepo().GetFullName())
+		assert.Equal(t, "user", pr.GetUser().GetLogin())
+		require.Len(t, pr.Labels, 1)
+		assert.Equal(t, "bug", pr.Labels[0].GetName())
+	})
+
+	t.Run("list-pull-request-files", func(t *testing.T) {
+		files, err := utils.CollectSequence(p.ListPullRequestFiles(context.Background(), "org", "repo", 7))
+		require.NoError(t, err)
+		require.Len(t, files, 3)
+		assert.Equal(t, "modified", files[0].GetStatus())
+		assert.Equal(t, "added", files[1].GetStatus())
+		assert.Equal(t, "d.go", files[2].GetFilename())
+		assert.Equal(t, "c.go", files[2].GetPreviousFilename())
+		assert.Equal(t, "renamed", files[2].GetStatus())
+	})
+
+	t.Run("user-permission", func(t *testing.T) {
+		expected := map[string]string{
+			"guest":     PermissionNone,
+			"reporter":  PermissionRead,
+			"developer": PermissionWrite,
+			"unknown":   PermissionNone,
+		}
+		for user, perm := range expected {
+			res, err := p.GetUserPermission(context.Background(), "org", "repo", user)
+			require.NoError(t, err)
+			assert.Equal(t, perm, res, user)
+		}
+	})
+
+	t.Run("links", func(t *testing.T) {
+		assert.Equal(t, server.URL+"/org/repo/-/merge_requests/7", p.Links().PullRequest("org", "repo", 7))
+		assert.Equal(t, server.URL+"/org/repo/-/commit/abc", p.Links().Commit("org", "repo", "abc"))
+	})
+}
+
+func TestGiteaProvider(t *testing.T) {
+	const numCommits = 120
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/org/repo/commits", func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		assert.Equal(t, giteaMaxPageSize, limit)
+		var res []map[string]interface{}
+		for i := (page - 1) * limit; i < page*limit && i < numCommits; i++ {
+			res = append(res, map[string]interface{}{"sha": fmt.Sprintf("sha%d", i)})
+		}
+		json.NewEncoder(w).Encode(res)
+	})
+	mux.HandleFunc("/api/v1/repos/org/repo/commits/abc/pull", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"number": 3, "merged_at": "2023-01-01T00:00:00Z", "base": {"repo": {"full_name": "org/repo"}}}`))
+	})
+	mux.HandleFunc("/api/v1/repos/org/repo/commits/def/pull", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	_, err := New(&Options{Kind: KindGitea})
+	assert.Error(t, err)
+
+	p, err := New(&Options{Kind: KindGitea, BaseURL: server.URL})
+	require.NoError(t, err)
+
+	// the pull request is requested only once the sequence is consumed
+	seq := p.ListPullRequestsWithCommit(context.Background(), "org", "repo", "abc")
+	assert.Equal(t, 0, requests)
+	pulls, err := utils.CollectSequence(seq)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+	require.Len(t, pulls, 1)
+	assert.Equal(t, 3, pulls[0].GetNumber())
+	assert.Equal(t, "org/repo", pulls[0].GetBase().GetRepo().GetFullName())
+
+	pulls, err = utils.CollectSequence(p.ListPullRequestsWithCommit(context.Background(), "org", "repo", "def"))
+	require.NoError(t, err)
+	assert.Len(t, pulls, 0)
+
+	commits, err := utils.CollectSequence(p.ListCommits(context.Background(), "org", "repo", "main"))
+	require.NoError(t, err)
+	require.Len(t, commits, numCommits)
+	assert.Equal(t, "sha119", commits[numCommits-1].GetSHA())
+
+	// the caller's options are not modified
+	o := &github.ListOptions{Page: 2, PerPage: 100}
+	assert.Equal(t, "50", giteaPageQuery(o).Get("limit"))
+	assert.Equal(t, 100, o.PerPage)
+
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	assert.Equal(t, server.URL+"/org/repo/src/main", p.Links().Tree("org", "repo", "main"))
+	assert.Equal(t, server.URL+"/org/repo/src/v0.37.0", p.Links().Tree("org", "repo", "v0.37.0"))
+	assert.Equal(t, server.URL+"/org/repo/src/commit/"+sha, p.Links().Tree("org", "repo", sha))
+}
@@ -13,6 +13,8 @@ type ConflictInfo interface {
 	String() string
 	Description() string
 	RecoverDescription() string
+	// Files returns the paths of the files involved in the conflict
+	Files() []string
 	Recover(git utils.GitHelper, r *Request, c *commitInfo) error
 }
 
@@ -36,6 +38,10 @@ func (info *contentConflictInfo) String() string {
 	return "content"
 }
 
+func (info *contentConflictInfo) Files() []string {
+	return []string{info.Modified}
+}
+
 func (info *contentConflictInfo) Description() string {
 	return "A file has been modified both in upstream and downstream in similar locations but with different changes"
 }
@@ -47,15 +53,17 @@ func (info *contentConflictInfo) RecoverDescription() string {
 }
 
 func (info *contentConflictInfo) Recover(git utils.GitHelper, r *Request, c *commitInfo) error {
+	base, picked := r.conflictSides()
+
 	// with CommitMarkerConflictSkip, we keep the upstream version of the conflicting files
-	if c.HasMarker(CommitMarkerConflictSkip) {
-		logrus.Warnf("merge conflict auto-recovery (%s): content conflict in file %s, keeping upstream changes", CommitMarkerConflictSkip, info.Modified)
+	if c.hasConflictMarker(CommitMarkerConflictSkip, info.Modified) {
+		logrus.Warnf("merge conflict auto-recovery (%s): content conflict in file %s, keeping %s changes", CommitMarkerConflictSkip, info.Modified, base)
 		return recoverErr("content", git.Do("checkout", "--ours", info.Modified))
 	}
 
 	// with CommitMarkerConflictApply, we keep the downstream version of the conflicting files
-	if c.HasMarker(CommitMarkerConflictApply) {
-		logrus.Warnf("merge conflict auto-recovery (%s): content conflict in file %s, keeping downstream changes", CommitMarkerConflictApply, info.Modified)
+	if c.hasConflictMarker(CommitMarkerConflictApply, info.Modified) {
+		logrus.Warnf("merge conflict auto-recovery (%s): content conflict in file %s, keeping %s changes", CommitMarkerConflictApply, info.Modified, picked)
 		return recoverErr("content", git.Do("checkout", "--theirs", info.Modified))
 	}
 
@@ -72,6 +80,10 @@ func (info *deleteModifyConflictInfo) String() string {
 	return "delete-modify"
 }
 
+func (info *deleteModifyConflictInfo) Files() []string {
+	return []string{info.UpstreamDeleted}
+}
+
 func (info *deleteModifyConflictInfo) Description() string {
 	return "A file has both been deleted upstream and modified downstream"
 }
@@ -85,7 +97,7 @@ func (info *deleteModifyConflictInfo) RecoverDescription() string {
 // to build or test failures, which should be dealt with manually.
 func (info *deleteModifyConflictInfo) Recover(git utils.GitHelper, r *Request, c *commitInfo) error {
 	// with CommitMarkerConflictApply, we preserve the file and apply the edits
-	if c.HasMarker(CommitMarkerConflictApply) {
+	if c.hasConflictMarker(CommitMarkerConflictApply, info.UpstreamDeleted) {
 		logrus.Warnf("merge conflict auto-recovery (%s): delete/modify detected for file %s, preserving and modifying it", CommitMarkerConflictApply, info.UpstreamDeleted)
 		// note: here we assume that git left in tree the modified version
 		return recoverErr("delete/modify", git.Do("add", info.UpstreamDeleted))
@@ -113,6 +125,10 @@ func (info *deleteRenameConflictInfo) String() string {
 	return "delete-rename"
 }
 
+func (info *deleteRenameConflictInfo) Files() []string {
+	return []string{info.UpstreamDeleted, info.DownstreamRenamed}
+}
+
 func (info *deleteRenameConflictInfo) Description() string {
 	return "A file has both been deleted upstream and renamed downstream"
 }
@@ -126,7 +142,7 @@ func (info *deleteRenameConflictInfo) RecoverDescription() string {
 // to build or test failures, which should be dealt with manually.
 func (info *deleteRenameConflictInfo) Recover(git utils.GitHelper, r *Request, c *commitInfo) error {
 	// with CommitMarkerConflictApply, we preserve the file and rename it
-	if c.HasMarker(CommitMarkerConflictApply) {
+	if c.hasConflictMarker(CommitMarkerConflictApply, info.UpstreamDeleted) {
 		logrus.Warnf("merge conflict auto-recovery (%s): delete/rename detected for file %s, preserving and modifying it", CommitMarkerConflictApply, info.UpstreamDeleted)
 		// note: here we assume that git left in tree the renamed version
 		return recoverErr("delete/rename", git.Do("add", info.DownstreamRenamed))
@@ -155,6 +171,10 @@ func (info *renameRenameConflictInfo) String() string {
 	return "rename-rename"
 }
 
+func (info *renameRenameConflictInfo) Files() []string {
+	return []string{info.UpstreamOriginal, info.UpstreamRenamed, info.DownstreamRenamed}
+}
+
 func (info *renameRenameConflictInfo) Description() string {
 	return "A file has been renamed both upstream and downstream, but with different names"
 }
@@ -165,9 +185,11 @@ func (info *renameRenameConflictInfo) RecoverDescription() string {
 
 // a file has been renamed both upstream and downstream
 func (info *renameRenameConflictInfo) Recover(git utils.GitHelper, r *Request, c *commitInfo) error {
+	base, picked := r.conflictSides()
+
 	// with CommitMarkerConflictSkip, we keep the file with the upstream name
-	if c.HasMarker(CommitMarkerConflictSkip) {
-		logrus.Warnf("merge conflict auto-recovery (%s): rename/rename detected for file %s, keeping upstream name", CommitMarkerConflictSkip, info.UpstreamOriginal)
+	if c.hasConflictMarker(CommitMarkerConflictSkip, info.UpstreamOriginal) {
+		logrus.Warnf("merge conflict auto-recovery (%s): rename/rename detected for file %s, keeping %s name", CommitMarkerConflictSkip, info.UpstreamOriginal, base)
 		err := git.Do("rm", "-f", info.DownstreamRenamed)
 		if err != nil {
 			logrus.Error(err.Error())
@@ -176,7 +198,7 @@ func (info *renameRenameConflictInfo) Recover(git utils.GitHelper, r *Request, c
 	}
 
 	// with CommitMarkerConflictApply (default), we keep the file with the downstream name
-	logrus.Warnf("merge conflict auto-recovery (%s): rename/rename detected for file %s, keeping downstream name %s", CommitMarkerConflictApply, info.UpstreamOriginal, info.DownstreamRenamed)
+	logrus.Warnf("merge conflict auto-recovery (%s): rename/rename detected for file %s, keeping %s name %s", CommitMarkerConflictApply, info.UpstreamOriginal, picked, info.DownstreamRenamed)
 	err := git.Do("rm", "-f", info.DownstreamRenamed)
 	if err != nil {
 		logrus.Error(err.Error())
@@ -195,6 +217,10 @@ func (info *renameDeleteConflictInfo) String() string {
 	return "rename-delete"
 }
 
+func (info *renameDeleteConflictInfo) Files() []string {
+	return []string{info.UpstreamOriginal, info.UpstreamRenamed}
+}
+
 func (info *renameDeleteConflictInfo) Description() string {
 	return "A file has both been renamed upstream and deleted downstream"
 }
@@ -206,8 +232,9 @@ func (info *renameDeleteConflictInfo) RecoverDescription() string {
 // a file has been renamed upstream, but deleted downstream
 func (info *renameDeleteConflictInfo) Recover(git utils.GitHelper, r *Request, c *commitInfo) error {
 	// with CommitMarkerConflictSkip, we keep the renamed file
-	if c.HasMarker(CommitMarkerConflictSkip) {
-		logrus.Warnf("merge conflict auto-recovery (%s): rename/delete detected for file %s, keeping with upstream name", CommitMarkerConflictSkip, info.UpstreamOriginal)
+	if c.hasConflictMarker(CommitMarkerConflictSkip, info.UpstreamOriginal) {
+		base, _ := r.conflictSides()
+		logrus.Warnf("merge conflict auto-recovery (%s): rename/delete detected for file %s, keeping with %s name", CommitMarkerConflictSkip, info.UpstreamOriginal, base)
 		// note: here we assume that git left in tree the renamed version
 		return recoverErr("rename/delete", git.Do("add", info.UpstreamRenamed))
 	}
@@ -233,6 +260,10 @@ func (info *modifyDeleteConflictInfo) String() string {
 	return "modify-delete"
 }
 
+func (info *modifyDeleteConflictInfo) Files() []string {
+	return []string{info.UpstreamModified}
+}
+
 func (info *modifyDeleteConflictInfo) Description() string {
 	return "A file has both been modified upstream and deleted downstream"
 }
@@ -244,7 +275,7 @@ func (info *modifyDeleteConflictInfo) RecoverDescription() string {
 // a file has been modified upstream, but deleted downstream
 func (info *modifyDeleteConflictInfo) Recover(git utils.GitHelper, r *Request, c *commitInfo) error {
 	// with CommitMarkerConflictSkip, we keep the renamed file
-	if c.HasMarker(CommitMarkerConflictSkip) {
+	if c.hasConflictMarker(CommitMarkerConflictSkip, info.UpstreamModified) {
 		logrus.Warnf("merge conflict auto-recovery (%s): modify/delete detected for file %s, keeping with modified", CommitMarkerConflictSkip, info.UpstreamModified)
 		// note: here we assume that git left in tree the modified version
 		return recoverErr("modify/delete", git.Do("add", info.UpstreamModified))
@@ -0,0 +1,117 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// conflictReport describes a commit that has not been applied during a
+// sync due to merge conflicts that could not be recovered automatically
+type conflictReport struct {
+	SHA   string `json:"sha"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	// Conflicts are the known merge conflicts caused by the commit
+	Conflicts []*conflictReportEntry `json:"conflicts,omitempty"`
+	// Unknown are the messages of the merge conflicts of unknown kind
+	Unknown []string `json:"unknown,omitempty"`
+	// Suggestion is the guidance on how to solve the conflicts manually
+	Suggestion string `json:"suggestion"`
+	// ParkedBranch is the branch in which the conflicting state is
+	// committed, if requested
+	ParkedBranch string `json:"parkedBranch,omitempty"`
+}
+
+type conflictReportEntry struct {
+	Kind  string   `json:"kind"`
+	Files []string `json:"files"`
+}
+
+func newConflictReport(req *Request, links *provider.Links, c *commitInfo, err *conflictError) *conflictReport {
+	res := &conflictReport{
+		SHA:        c.SHA(),
+		Title:      c.Title(),
+		URL:        links.Commit(req.ForkOrg, req.ForkRepo, c.SHA()),
+		Unknown:    err.Unknown,
+		Suggestion: err.Suggestion,
+	}
+	for _, conflict := range err.Conflicts {
+		res.Conflicts = append(res.Conflicts, &conflictReportEntry{Kind: conflict.String(), Files: conflict.Files()})
+	}
+	return res
+}
+
+// formats the reports of all the commits not applied during a sync in markdown
+func formatConflictReports(req *Request, reports []*conflictReport) string {
+	var b strings.Builder
+	b.WriteString("# Sync Conflict Report\n\n")
+	b.WriteString(fmt.Sprintf("Syncing fork %s/%s on top of upstream %s/%s (%s) in branch `%s`, %d commits could not be applied due to merge conflicts.\n",
+		req.ForkOrg, req.ForkRepo, req.UpstreamOrg, req.UpstreamRepo, req.UpstreamHeadRef, req.OutBranch, len(reports)))
+	for _, r := range reports {
+		b.WriteString(fmt.Sprintf("\n## %s %s\n\n", ShortSHA(r.SHA), r.Title))
+		b.WriteString(fmt.Sprintf("* Commit: %s\n", r.URL))
+		if len(r.ParkedBranch) > 0 {
+			b.WriteString(fmt.Sprintf("* Conflicting state committed in branch: `%s`\n", r.ParkedBranch))
+		}
+		b.WriteString("* Conflicts:\n")
+		for _, c := range r.Conflicts {
+			b.WriteString(fmt.Sprintf("  * `%s`: %s\n", c.Kind, strings.Join(c.Files, ", ")))
+		}
+		for _, u := range r.Unknown {
+			b.WriteString(fmt.Sprintf("  * `unknown`: %s\n", u))
+		}
+		b.WriteString("\n" + r.Suggestion + "\n")
+	}
+	return b.String()
+}
+
+// prints the report of all the commits not applied during a sync, and
+// writes it in the report file if required
+func writeConflictReports(req *Request, reports []*conflictReport) error {
+	report := formatConflictReports(req, reports)
+	fmt.Fprintf(os.Stdout, "%s", report)
+	if len(req.ReportFile) > 0 {
+		logrus.Infof("writing conflict report in file %s", req.ReportFile)
+		return os.WriteFile(req.ReportFile, []byte(report), 0644)
+	}
+	return nil
+}
+
+// CommitConflictState commits the conflicting state of the cherry-pick in
+// progress with the given message. Only the files with merge conflicts are
+// staged on top of the changes already staged by the cherry-pick, so that
+// no other untracked or modified file ends up in the commit.
+func CommitConflictState(git utils.GitHelper, msg string) error {
+	unmerged, err := git.ListUnmergedFiles()
+	if err != nil {
+		return err
+	}
+	if len(unmerged) > 0 {
+		if err := git.Do(append([]string{"add", "-A", "--"}, unmerged...)...); err != nil {
+			return err
+		}
+	}
+	return git.Do("commit", "--no-verify", "--allow-empty", "-m", msg)
+}
+
+// commits the conflicting state of the current cherry-pick in a side
+// branch, and restores the previous state of the current branch.
+// Returns the name of the side branch.
+func parkConflict(git utils.GitHelper, req *Request, links *provider.Links, c *commitInfo) (string, error) {
+	branch := fmt.Sprintf("%s-conflict-%s", req.OutBranch, c.ShortSHA())
+	logrus.Infof("committing conflicting state in branch '%s'", branch)
+	msg := fmt.Sprintf("%s\n\n%s: unsolved merge conflicts of %s (%s)\n",
+		c.Title(), SyncCommitBodyHeader, c.ShortSHA(), links.Commit(req.ForkOrg, req.ForkRepo, c.SHA()))
+	if err := CommitConflictState(git, msg); err != nil {
+		return "", err
+	}
+	if err := git.Do("branch", "-f", branch, "HEAD"); err != nil {
+		return "", err
+	}
+	return branch, git.Do("reset", "--hard", "HEAD~1")
+}
@@ -0,0 +1,65 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConflictReports(t *testing.T) {
+	req := &Request{
+		UpstreamOrg: "upstream", UpstreamRepo: "repo", UpstreamHeadRef: "0.37.0",
+		ForkOrg: "fork", ForkRepo: "repo", OutBranch: "sync",
+	}
+	links := (&fakeScanProvider{}).Links()
+
+	t.Run("format", func(t *testing.T) {
+		reports := []*conflictReport{
+			{
+				SHA:          "0123456789abcdef0123456789abcdef01234567",
+				Title:        "fix: something",
+				URL:          "https://github.com/fork/repo/commit/0123456789abcdef0123456789abcdef01234567",
+				Conflicts:    []*conflictReportEntry{{Kind: "content", Files: []string{"a.txt", "b.txt"}}},
+				Suggestion:   "solve it manually",
+				ParkedBranch: "sync-conflict-01234567",
+			},
+			// note: SHAs shorter than the abbreviated ones are reported as is
+			{SHA: "abc", Title: "fix: other", Unknown: []string{"CONFLICT (unknown): x"}},
+		}
+		out := formatConflictReports(req, reports)
+		assert.Contains(t, out, "in branch `sync`, 2 commits could not be applied due to merge conflicts.\n")
+		assert.Contains(t, out, "\n## 01234567 fix: something\n\n")
+		assert.Contains(t, out, "* Conflicting state committed in branch: `sync-conflict-01234567`\n")
+		assert.Contains(t, out, "* Conflicts:\n  * `content`: a.txt, b.txt\n\nsolve it manually\n")
+		assert.Contains(t, out, "\n## abc fix: other\n\n")
+		assert.Contains(t, out, "  * `unknown`: CONFLICT (unknown): x\n")
+
+		req := *req
+		req.ReportFile = filepath.Join(t.TempDir(), "report.md")
+		require.NoError(t, writeConflictReports(&req, reports))
+		written, err := os.ReadFile(req.ReportFile)
+		require.NoError(t, err)
+		assert.Equal(t, out, string(written))
+	})
+
+	t.Run("park", func(t *testing.T) {
+		git := &fakeResumeGit{unmerged: []string{"a.txt", "b.txt"}}
+		c := &commitInfo{Commit: &github.RepositoryCommit{
+			SHA:    github.String("0123456789abcdef0123456789abcdef01234567"),
+			Commit: &github.Commit{Message: github.String("fix: something")},
+		}}
+		branch, err := parkConflict(git, req, links, c)
+		require.NoError(t, err)
+		assert.Equal(t, "sync-conflict-01234567", branch)
+		require.Len(t, git.commands, 4)
+		assert.Equal(t, "add -A -- a.txt b.txt", git.commands[0])
+		assert.Contains(t, git.commands[1], "commit --no-verify --allow-empty -m fix: something\n\n")
+		assert.Contains(t, git.commands[1], "unsolved merge conflicts of 01234567 (https://github.com/fork/repo/commit/0123456789abcdef0123456789abcdef01234567)")
+		assert.Equal(t, "branch -f sync-conflict-01234567 HEAD", git.commands[2])
+		assert.Equal(t, "reset --hard HEAD~1", git.commands[3])
+	})
+}
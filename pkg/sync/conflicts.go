@@ -2,11 +2,14 @@ package sync
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
 	"strings"
 
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
 	"github.com/jasondellaluce/synchro/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -26,17 +29,83 @@ var rgxConflictRenameDelete = regexp.MustCompile(
 var rgxConflictModifyDelete = regexp.MustCompile(
 	`CONFLICT \(modify/delete\): ([a-zA-Z0-9\-_\.\\\/]+) deleted in [a-fA-F0-9]+ \(.*\) and modified in HEAD`)
 
+var rgxConflictContent = regexp.MustCompile(`CONFLICT \(content\): Merge conflict in (.+)`)
+
+// conflictError is returned when the merge conflicts caused by picking
+// a commit can't be recovered automatically
+type conflictError struct {
+	// Conflicts are the known merge conflicts caused by the commit
+	Conflicts []ConflictInfo
+	// Unknown are the messages of the merge conflicts of unknown kind
+	Unknown []string
+	// Suggestion is the guidance on how to solve the conflicts manually
+	Suggestion string
+	err        error
+}
+
+func (e *conflictError) Error() string {
+	return e.err.Error()
+}
+
+func (e *conflictError) Unwrap() error {
+	return e.err
+}
+
+func newConflictError(out string, nonContentConflicts []ConflictInfo, req *Request, links *provider.Links, commit *commitInfo, err error) *conflictError {
+	var conflicts []ConflictInfo
+	for _, m := range rgxConflictContent.FindAllStringSubmatch(out, -1) {
+		conflicts = append(conflicts, &contentConflictInfo{Modified: m[1]})
+	}
+	return &conflictError{
+		Conflicts:  append(conflicts, nonContentConflicts...),
+		Unknown:    getUnknownConflictMessages(out),
+		Suggestion: formatConflictSuggestion(contentConflictSuggestion, newConflictSuggestionInfo(req, links, commit)),
+		err:        err,
+	}
+}
+
+// RecoverPickConflicts attempts recovering from the merge conflicts of a
+// `git cherry-pick` of the given commit that failed with the given output,
+// exactly like during a sync. The markers of the commit are read from its
+// message. A non-nil error is returned in case the recover attempt fails, for
+// which UnrecoveredConflicts reports the merge conflicts that require manual
+// intervention.
+func RecoverPickConflicts(git utils.GitHelper, out string, req *Request, links *provider.Links, commit *github.RepositoryCommit) error {
+	c := &commitInfo{
+		Commit:         commit,
+		Markers:        parseCommitMarkers(commit.GetCommit().GetMessage()),
+		DefaultMarkers: requestDefaultMarkers(req),
+	}
+	return attemptMergeConflictRecovery(git, out, req, links, c)
+}
+
+// UnrecoveredConflicts returns the merge conflicts that require manual
+// intervention in the form `<kind>: <files>`, and true if the given error
+// has been returned by RecoverPickConflicts due to them
+func UnrecoveredConflicts(err error) ([]string, bool) {
+	var conflictErr *conflictError
+	if !errors.As(err, &conflictErr) {
+		return nil, false
+	}
+	var res []string
+	for _, c := range conflictErr.Conflicts {
+		res = append(res, fmt.Sprintf("%s: %s", c.String(), strings.Join(c.Files(), ", ")))
+	}
+	for _, u := range conflictErr.Unknown {
+		res = append(res, "unknown: "+u)
+	}
+	return res, true
+}
+
 // this is invoked when a `git cherry-pick` fails with a non-zero status code,
 // and the goal is to identify all the merge conflicts and attempt resolving
-// them manually. A non-nil error is returned in case the recover attempt fails.
-func attemptMergeConflictRecovery(git utils.GitHelper, out string, req *Request, commit *commitInfo) error {
+// them manually. A non-nil error is returned in case the recover attempt fails,
+// which is a *conflictError if manual intervention is required.
+func attemptMergeConflictRecovery(git utils.GitHelper, out string, req *Request, links *provider.Links, commit *commitInfo) error {
 	if err := requireWorkInRepoRootDir(git); err != nil {
 		return err
 	}
 
-	// collect all non-content conflict info
-	var nonContentConfilicts []ConflictInfo
-
 	// count number of conflicts and use it later
 	numConflicts := countMergeConflicts(out)
 
@@ -44,47 +113,24 @@ func attemptMergeConflictRecovery(git utils.GitHelper, out string, req *Request,
 	// take this count in account later for defining the right action items
 	numContentConflicts := countMergeContentConflicts(out)
 
-	md, err := getModifyDeleteConflictInfos(out)
-	if err != nil {
-		return fmt.Errorf("could not check for modify/delete conflicts: %s", err.Error())
-	}
-	nonContentConfilicts = append(nonContentConfilicts, md...)
-
-	rr, err := getRenameRenameConflictInfos(out)
-	if err != nil {
-		return fmt.Errorf("could not check for rename/rename conflicts: %s", err.Error())
-	}
-	nonContentConfilicts = append(nonContentConfilicts, rr...)
-
-	rd, err := getRenameDeleteConflictInfos(out)
-	if err != nil {
-		return fmt.Errorf("could not check for rename/delete conflicts: %s", err.Error())
-	}
-	nonContentConfilicts = append(nonContentConfilicts, rd...)
-
-	dm, err := getDeleteModifyConflictInfos(out)
-	if err != nil {
-		return fmt.Errorf("could not check for delete/modify conflicts: %s", err.Error())
-	}
-	nonContentConfilicts = append(nonContentConfilicts, dm...)
-
-	dr, err := getDeleteRenameConflictInfos(out)
+	// collect all non-content conflict info
+	nonContentConfilicts, err := getNonContentConflictInfos(out)
 	if err != nil {
-		return fmt.Errorf("could not check for delete/rename conflicts: %s", err.Error())
+		return err
 	}
-	nonContentConfilicts = append(nonContentConfilicts, dr...)
 
 	// check if the remaining merge conflicts are all content ones
 	// or if there are some unknown from which we can't possibly recover
 	unknownConflicts := numConflicts - (len(nonContentConfilicts) + numContentConflicts)
 	if len(nonContentConfilicts) > numConflicts || unknownConflicts > 0 {
-		return fmt.Errorf("unknown conflicts encountered (%d content, %d non-content, %d total), can't recover: %s", numContentConflicts, len(nonContentConfilicts), numConflicts, out)
+		err := fmt.Errorf("unknown conflicts encountered (%d content, %d non-content, %d total), can't recover: %s", numContentConflicts, len(nonContentConfilicts), numConflicts, out)
+		return newConflictError(out, nonContentConfilicts, req, links, commit, err)
 	}
 
 	// attempt recovering from all the non-content conflicts, one by one
 	for _, conflict := range nonContentConfilicts {
 		if err := conflict.Recover(git, req, commit); err != nil {
-			return err
+			return newConflictError(out, nonContentConfilicts, req, links, commit, err)
 		}
 	}
 
@@ -93,39 +139,29 @@ func attemptMergeConflictRecovery(git utils.GitHelper, out string, req *Request,
 	// return an error and provide guidance on how to solve the conflict
 	// through manual intervention
 	if numContentConflicts > 0 {
-		out, err := git.DoOutput("diff", "--check")
+		checkOut, err := git.DoOutput("diff", "--check")
 		if err != nil {
 			// the only error we can ignore is the exist status one, which is
 			// used by the --check option for indicating issues (reported in output)
 			// see: https://git-scm.com/docs/git-diff#Documentation/git-diff.txt---check
-			if !(strings.Contains(err.Error(), "exit status") && len(out) > 0) {
+			if !(strings.Contains(err.Error(), "exit status") && len(checkOut) > 0) {
 				return fmt.Errorf("could not check for content conflicts: %s", err.Error())
 			}
 		}
 
 		// the output will not be empty if there are remaining content conflicts.
 		// In that case we attempt to extract them and recovery from them
-		if len(out) > 0 {
-			cc, err := getContentConflictInfos(out)
+		if len(checkOut) > 0 {
+			cc, err := getContentConflictInfos(checkOut)
 			if err != nil {
 				return fmt.Errorf("could not parse content conflicts: %s", err.Error())
 			}
 
 			for _, conflict := range cc {
 				if err := conflict.Recover(git, req, commit); err != nil {
-					// in case recovery is impossible, we write to stdout some guidance
+					// in case recovery is impossible, we provide some guidance
 					// on how users can proceed manually
-					suggestion := formatConflictSuggestion(contentConflictSuggestion, &conflictSuggestionInfo{
-						UpstreamOrg:       req.UpstreamOrg,
-						UpstreamRepo:      req.UpstreamRepo,
-						UpstreamRef:       req.UpstreamHeadRef,
-						ForkOrg:           req.ForkOrg,
-						ForkRepo:          req.ForkRepo,
-						ConflictCommitSHA: commit.SHA(),
-						BranchName:        req.OutBranch,
-					})
-					fmt.Fprintf(os.Stdout, "%s\n", suggestion)
-					return err
+					return newConflictError(out, nonContentConfilicts, req, links, commit, err)
 				}
 			}
 		}
@@ -150,6 +186,74 @@ func attemptMergeConflictRecovery(git utils.GitHelper, out string, req *Request,
 	return nil
 }
 
+// returns the info of all the non-content merge conflicts reported in the
+// output of a git merge operation
+func getNonContentConflictInfos(out string) ([]ConflictInfo, error) {
+	var res []ConflictInfo
+	md, err := getModifyDeleteConflictInfos(out)
+	if err != nil {
+		return nil, fmt.Errorf("could not check for modify/delete conflicts: %s", err.Error())
+	}
+	res = append(res, md...)
+
+	rr, err := getRenameRenameConflictInfos(out)
+	if err != nil {
+		return nil, fmt.Errorf("could not check for rename/rename conflicts: %s", err.Error())
+	}
+	res = append(res, rr...)
+
+	rd, err := getRenameDeleteConflictInfos(out)
+	if err != nil {
+		return nil, fmt.Errorf("could not check for rename/delete conflicts: %s", err.Error())
+	}
+	res = append(res, rd...)
+
+	dm, err := getDeleteModifyConflictInfos(out)
+	if err != nil {
+		return nil, fmt.Errorf("could not check for delete/modify conflicts: %s", err.Error())
+	}
+	res = append(res, dm...)
+
+	dr, err := getDeleteRenameConflictInfos(out)
+	if err != nil {
+		return nil, fmt.Errorf("could not check for delete/rename conflicts: %s", err.Error())
+	}
+	res = append(res, dr...)
+	return res, nil
+}
+
+// returns the messages of all the merge conflicts of unknown kind reported
+// in the output of a git merge operation
+func getUnknownConflictMessages(out string) []string {
+	known := []*regexp.Regexp{
+		rgxConflictContent,
+		rgxConflictDeleteModify,
+		rgxConflictDeleteRename,
+		rgxConflictRenameRename,
+		rgxConflictRenameDelete,
+		rgxConflictModifyDelete,
+	}
+	var res []string
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		l := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(l, "CONFLICT (") {
+			continue
+		}
+		isKnown := false
+		for _, r := range known {
+			if r.MatchString(l) {
+				isKnown = true
+				break
+			}
+		}
+		if !isKnown {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
 func requireWorkInRepoRootDir(git utils.GitHelper) error {
 	// note: merge conflicts will give relative paths of conflicting files,
 	// so if automatic recovery is needed we have to make sure that we
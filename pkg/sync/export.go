@@ -0,0 +1,175 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ExportFormatMbox writes all the patches in a single mbox file
+	ExportFormatMbox = "mbox"
+
+	// ExportFormatQuilt writes the patches in a directory along with a quilt
+	// series file listing them in order of application
+	ExportFormatQuilt = "quilt"
+
+	// ExportFormatPatchDir writes the patches in a directory, with file
+	// names prefixed by their order of application
+	ExportFormatPatchDir = "patch-dir"
+)
+
+// AllExportFormats is a collection of all the patch series formats supported
+var AllExportFormats = []string{ExportFormatMbox, ExportFormatQuilt, ExportFormatPatchDir}
+
+// quiltSeriesFileName is the name of the file listing the patches of a
+// quilt series in order of application
+const quiltSeriesFileName = "series"
+
+// PatchHeaderPrefix is the prefix of the headers added to the exported
+// patches for carrying the metadata of the sync
+var PatchHeaderPrefix = "X-" + strings.ToUpper(utils.ProjectName[:1]) + utils.ProjectName[1:] + "-"
+
+var (
+	// PatchHeaderCommit is the header containing the URL of the fork commit
+	PatchHeaderCommit = PatchHeaderPrefix + "Commit"
+	// PatchHeaderPullRequest is the header containing the URL of a fork pull
+	// request of the commit, repeated for each of them
+	PatchHeaderPullRequest = PatchHeaderPrefix + "Pull-Request"
+	// PatchHeaderUpstreamRef is the header containing the URL of the
+	// upstream pull request referenced by the commit
+	PatchHeaderUpstreamRef = PatchHeaderPrefix + "Upstream-Ref"
+	// PatchHeaderMarker is the header containing a marker of the commit,
+	// repeated for each of them
+	PatchHeaderMarker = PatchHeaderPrefix + "Marker"
+	// PatchHeaderSquashInto is the header containing the SHA of the commit
+	// into which the commit is folded
+	PatchHeaderSquashInto = PatchHeaderPrefix + "Squash-Into"
+)
+
+// ExportRequest contains all the info required for exporting the
+// fork's private patches as a series
+type ExportRequest struct {
+	// Format is one of AllExportFormats
+	Format string
+	// Output is the file (for mbox, in which "-" means stdout) or the
+	// directory (for the others) in which the series is written
+	Output string
+}
+
+var rgxPatchNameUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// returns the file name of the n-th patch of a series, in the style of
+// `git format-patch`
+func patchFileName(n int, title string) string {
+	slug := strings.Trim(rgxPatchNameUnsafe.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(slug) > 52 {
+		slug = strings.Trim(slug[:52], "-")
+	}
+	return fmt.Sprintf("%04d-%s.patch", n, slug)
+}
+
+// Export scans the fork as specified by the given request, and writes the
+// picked commits as an ordered series of patches in the requested format.
+// The commits must be available in the local repository. Each patch carries
+// the metadata of the sync in additional email headers.
+func Export(ctx context.Context, git utils.GitHelper, p provider.Provider, req *Request, exportReq *ExportRequest) error {
+	if !utils.Contains(AllExportFormats, exportReq.Format) {
+		return fmt.Errorf("unsupported export format '%s', must be one of: %s", exportReq.Format, strings.Join(AllExportFormats, ", "))
+	}
+	scanRes, err := runScan(ctx, git, p, req)
+	if err != nil {
+		return err
+	}
+
+	var patches []string
+	for _, c := range scanRes.Picked {
+		patch, err := formatPatch(git, p.Links(), req, c)
+		if err != nil {
+			return err
+		}
+		patches = append(patches, patch)
+	}
+
+	if exportReq.Format == ExportFormatMbox {
+		var w io.Writer = os.Stdout
+		if len(exportReq.Output) > 0 && exportReq.Output != "-" {
+			f, err := os.Create(exportReq.Output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		for _, patch := range patches {
+			if _, err := io.WriteString(w, patch); err != nil {
+				return err
+			}
+		}
+		logrus.Infof("exported %d patches in mbox format", len(patches))
+		return nil
+	}
+
+	if len(exportReq.Output) == 0 || exportReq.Output == "-" {
+		return fmt.Errorf("export format '%s' requires an output directory", exportReq.Format)
+	}
+	if err := os.MkdirAll(exportReq.Output, 0755); err != nil {
+		return err
+	}
+	var series strings.Builder
+	for i, c := range scanRes.Picked {
+		name := patchFileName(i+1, c.Title())
+		if err := os.WriteFile(filepath.Join(exportReq.Output, name), []byte(patches[i]), 0644); err != nil {
+			return err
+		}
+		series.WriteString(name + "\n")
+	}
+	if exportReq.Format == ExportFormatQuilt {
+		if err := os.WriteFile(filepath.Join(exportReq.Output, quiltSeriesFileName), []byte(series.String()), 0644); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("exported %d patches in %s format in directory %s", len(patches), exportReq.Format, exportReq.Output)
+	return nil
+}
+
+// returns the given commit as an email patch, as produced by
+// `git format-patch`, with the metadata of the sync in additional headers
+func formatPatch(git utils.GitHelper, links *provider.Links, req *Request, c *commitInfo) (string, error) {
+	// note: the output is not trimmed, as the trailing whitespace can be
+	// part of the diff
+	out, err := git.DoRawOutput("format-patch", "-1", "--stdout", "--signature="+utils.ProjectName, c.SHA())
+	if err != nil {
+		return "", fmt.Errorf("can't format patch of commit %s, make sure it's available locally: %s", c.SHA(), err.Error())
+	}
+
+	var headers strings.Builder
+	headers.WriteString(fmt.Sprintf("%s: %s\n", PatchHeaderCommit, links.Commit(req.ForkOrg, req.ForkRepo, c.SHA())))
+	for _, pr := range c.pullRequestsOfRepo(req.ForkOrg, req.ForkRepo) {
+		headers.WriteString(fmt.Sprintf("%s: %s\n", PatchHeaderPullRequest, pullRequestURL(links, req.ForkOrg, req.ForkRepo, pr)))
+	}
+	if c.UpstreamRef != nil {
+		headers.WriteString(fmt.Sprintf("%s: %s\n", PatchHeaderUpstreamRef, pullRequestURL(links, req.UpstreamOrg, req.UpstreamRepo, c.UpstreamRef)))
+	}
+	for _, m := range formatCommitMarkers(c.Markers) {
+		headers.WriteString(fmt.Sprintf("%s: %s\n", PatchHeaderMarker, m))
+	}
+	if len(c.SquashInto) > 0 {
+		headers.WriteString(fmt.Sprintf("%s: %s\n", PatchHeaderSquashInto, c.SquashInto))
+	}
+
+	// the headers end at the first empty line
+	head, body, ok := strings.Cut(out, "\n\n")
+	if !ok {
+		return "", fmt.Errorf("can't parse patch of commit %s", c.SHA())
+	}
+	return head + "\n" + headers.String() + "\n" + body, nil
+}
@@ -0,0 +1,92 @@
+package sync
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOutputGit returns a fixed output and error for all the git commands
+type fakeOutputGit struct {
+	utils.GitHelper
+	out string
+	err error
+}
+
+func (f *fakeOutputGit) DoOutput(commands ...string) (string, error) {
+	return f.out, f.err
+}
+
+func (f *fakeOutputGit) DoRawOutput(commands ...string) (string, error) {
+	return f.out, f.err
+}
+
+const samplePatch = `From 0123456789abcdef0123456789abcdef01234567 Mon Sep 17 00:00:00 2001
+From: John Doe <jdoe@example.com>
+Date: Mon, 1 Jan 2024 00:00:00 +0000
+Subject: [PATCH] fix: something
+
+Some description.
+
+SYNC_CONFLICT_SKIP(vendor/**)
+---
+ a.txt | 2 +-
+ 1 file changed, 1 insertion(+), 1 deletion(-)
+
+diff --git a/a.txt b/a.txt
+index 0000000..1111111 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+-a
++b
+ 
+-- 
+synchro
+
+`
+
+func TestExport(t *testing.T) {
+	t.Run("file-name", func(t *testing.T) {
+		assert.Equal(t, "0001-fix-something-in-the-parser.patch", patchFileName(1, "fix: something in the parser!"))
+		assert.Equal(t, "0012-a.patch", patchFileName(12, "A"))
+		assert.LessOrEqual(t, len(patchFileName(1, strings.Repeat("long title ", 20))), 63)
+	})
+
+	t.Run("format-patch", func(t *testing.T) {
+		msg := "fix: something\n\nSome description.\n\nSYNC_CONFLICT_SKIP(vendor/**)"
+		c := &commitInfo{
+			Commit: &github.RepositoryCommit{
+				SHA:    github.String("0123456789abcdef0123456789abcdef01234567"),
+				Commit: &github.Commit{Message: github.String(msg)},
+			},
+			Markers: parseCommitMarkers(msg),
+			PullRequests: []*github.PullRequest{{
+				Number: github.Int(3),
+				Base:   &github.PullRequestBranch{Repo: &github.Repository{FullName: github.String("fork/repo")}},
+			}},
+		}
+		links := &provider.Links{BaseURL: "https://github.com", PullRequestPath: "pull", CommitPath: "commit"}
+		req := &Request{ForkOrg: "fork", ForkRepo: "repo", UpstreamOrg: "upstream", UpstreamRepo: "repo"}
+		patch, err := formatPatch(&fakeOutputGit{out: samplePatch}, links, req, c)
+		require.NoError(t, err)
+		assert.Contains(t, patch, "Subject: [PATCH] fix: something\n"+
+			"X-Synchro-Commit: https://github.com/fork/repo/commit/0123456789abcdef0123456789abcdef01234567\n"+
+			"X-Synchro-Pull-Request: https://github.com/fork/repo/pull/3\n"+
+			"X-Synchro-Marker: SYNC_CONFLICT_SKIP(vendor/**)\n\nSome description.")
+		assert.True(t, strings.HasSuffix(patch, "+b\n \n-- \nsynchro\n\n"))
+	})
+
+	t.Run("format-patch-failure", func(t *testing.T) {
+		c := &commitInfo{Commit: &github.RepositoryCommit{SHA: github.String("0123456789abcdef0123456789abcdef01234567")}}
+		git := &fakeOutputGit{err: errors.New("exit status 128: fatal: bad object 0123456789abcdef0123456789abcdef01234567")}
+		_, err := formatPatch(git, &provider.Links{}, &Request{}, c)
+		assert.ErrorContains(t, err, "fatal: bad object")
+	})
+}
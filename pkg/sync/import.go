@@ -0,0 +1,334 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/hashicorp/go-multierror"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// ImportRequest contains all the info required for importing a patch
+// series into the sync branch
+type ImportRequest struct {
+	// Format is one of AllExportFormats, or empty for detecting it
+	// from the input
+	Format string
+	// Input is the mbox file, the quilt series file or directory, or the
+	// directory of patches from which the series is read
+	Input string
+}
+
+// importPatch is a single patch of an imported series
+type importPatch struct {
+	// Name identifies the patch in the series
+	Name string
+	// Content is the patch in email format
+	Content string
+	// Commit is the info of the commit from which the patch is produced
+	Commit *commitInfo
+}
+
+// matches the first line of each message of an mbox, in which
+// `git format-patch` reports the SHA of the commit
+var rgxMboxFromLine = regexp.MustCompile(`(?m)^From (\S+) \w{3} \w{3} [ \d]\d \d{2}:\d{2}:\d{2} \d{4}$`)
+
+var rgxCommitSHA = regexp.MustCompile(`^[0-9a-fA-F]{40,64}$`)
+
+var rgxPatchSubjectPrefix = regexp.MustCompile(`^\[[^\]]*\]\s*`)
+
+// Import reads a patch series in one of the formats written by Export, and
+// applies it on top of the upstream head in the sync branch just like a sync.
+// Merge conflicts are recovered automatically according to the markers of
+// each patch, read from the metadata headers written by Export if any, or
+// from the commit message otherwise. Each patch must be in email format
+// and carry the SHA of its original commit, as done by `git format-patch`.
+func Import(ctx context.Context, git utils.GitHelper, p provider.Provider, req *Request, importReq *ImportRequest) error {
+	if err := requireNoLocalChanges(git); err != nil {
+		return err
+	}
+	if err := requireNoSyncInProgress(git); err != nil {
+		return err
+	}
+
+	patches, err := readPatchSeries(importReq)
+	if err != nil {
+		return err
+	}
+	defaultMarkers := requestDefaultMarkers(req)
+	for _, patch := range patches {
+		patch.Commit.DefaultMarkers = defaultMarkers
+	}
+
+	if err := requireForkRepo(git, req); err != nil {
+		return err
+	}
+
+	// the patches are applied from files, which must be out of the repository
+	// as the working tree changes during the import
+	tempDir, err := os.MkdirTemp("", utils.ProjectName+"-import-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	remoteName, remoteURL := upstreamRemote(p.Links(), req)
+	logrus.Infof("importing %d patches in repository %s/%s on top of upstream %s/%s", len(patches), req.ForkOrg, req.ForkRepo, req.UpstreamOrg, req.UpstreamRepo)
+	return utils.WithTempGitRemote(git, remoteName, remoteURL, func() error {
+		return utils.WithTempLocalBranch(git, req.OutBranch, remoteName, req.UpstreamHeadRef, func() (bool, error) {
+			return false, applyPatchSeries(git, p.Links(), req, patches, tempDir)
+		})
+	})
+}
+
+// applies all the patches of a series one by one with `git am`, with the
+// same conflict recovery and sync metadata of the commits picked during a sync
+func applyPatchSeries(git utils.GitHelper, links *provider.Links, req *Request, patches []*importPatch, tempDir string) error {
+	for i, patch := range patches {
+		c := patch.Commit
+		if c.HasMarker(CommitMarkerIgnore) {
+			logrus.Infof("skipping patch %s marked with %s", patch.Name, CommitMarkerIgnore)
+			continue
+		}
+		logrus.Infof("applying (%s) %s", c.ShortSHA(), c.Title())
+
+		path := filepath.Join(tempDir, patchFileName(i+1, c.Title()))
+		if err := os.WriteFile(path, []byte(patch.Content), 0644); err != nil {
+			return err
+		}
+
+		recovered := false
+		out, err := git.DoOutput("am", "-3", path)
+		if err != nil {
+			err = fmt.Errorf("merge conflict on patch: %s", patch.Name)
+			var recoveryErr error
+			if countMergeConflicts(out) == 0 {
+				recoveryErr = fmt.Errorf("patch can't be applied nor merged, make sure the base commits of the patch are available locally: %s", out)
+			} else {
+				recoveryErr = attemptMergeConflictRecovery(git, amConflictOutput(out, c), req, links, c)
+			}
+			if recoveryErr != nil {
+				logrus.Errorf("unrecoverable merge conflict occurred, stopping the import (consider annotating the patch with %s headers)", PatchHeaderMarker)
+				return multierror.Append(err, recoveryErr, git.Do("am", "--abort"))
+			}
+			recovered = true
+			if hasChanges, changesErr := git.HasLocalChanges(); changesErr != nil {
+				logrus.Error("failed checking for remaining changes, reverting patch")
+				return multierror.Append(err, changesErr, git.Do("am", "--abort"))
+			} else if !hasChanges {
+				logrus.Warn("patch is now empty possibly due to conflict resolution, skipping it")
+				if err := git.Do("am", "--skip"); err != nil {
+					return err
+				}
+				continue
+			}
+			if continueErr := git.Do("am", "--continue"); continueErr != nil {
+				logrus.Error("failed continuing patch application, reverting patch")
+				return multierror.Append(err, continueErr, git.Do("am", "--abort"))
+			}
+		}
+
+		if err := finalizePatch(git, req, links, c, recovered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the three-way merge of `git am` labels the changes of the patch with its
+// subject, whereas `git cherry-pick` uses the commit SHA followed by its
+// title. This makes the merge conflicts look like the ones of a cherry-pick,
+// so that they are parsed and recovered exactly like during a sync.
+func amConflictOutput(out string, c *commitInfo) string {
+	return strings.ReplaceAll(out, " in "+c.Title(), fmt.Sprintf(" in %s (%s)", c.ShortSHA(), c.Title()))
+}
+
+// returns the format of the series read from the given input, which is
+// mbox for files, quilt for directories containing a series file, and
+// patch-dir for the other directories
+func detectSeriesFormat(input string) (string, error) {
+	info, err := os.Stat(input)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		if filepath.Base(input) == quiltSeriesFileName {
+			return ExportFormatQuilt, nil
+		}
+		return ExportFormatMbox, nil
+	}
+	if _, err := os.Stat(filepath.Join(input, quiltSeriesFileName)); err == nil {
+		return ExportFormatQuilt, nil
+	}
+	return ExportFormatPatchDir, nil
+}
+
+// reads all the patches of the series of the given request, in order
+// of application
+func readPatchSeries(importReq *ImportRequest) ([]*importPatch, error) {
+	format := importReq.Format
+	if len(format) == 0 {
+		var err error
+		format, err = detectSeriesFormat(importReq.Input)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var res []*importPatch
+	addPatch := func(name, content string) error {
+		patch, err := parseImportPatch(name, content)
+		if err != nil {
+			return err
+		}
+		res = append(res, patch)
+		return nil
+	}
+
+	switch format {
+	case ExportFormatMbox:
+		content, err := os.ReadFile(importReq.Input)
+		if err != nil {
+			return nil, err
+		}
+		locs := rgxMboxFromLine.FindAllStringIndex(string(content), -1)
+		if len(locs) == 0 || len(strings.TrimSpace(string(content[:locs[0][0]]))) > 0 {
+			return nil, fmt.Errorf("file %s is not an mbox of patches", importReq.Input)
+		}
+		for i, loc := range locs {
+			end := len(content)
+			if i+1 < len(locs) {
+				end = locs[i+1][0]
+			}
+			if err := addPatch(fmt.Sprintf("%s#%d", importReq.Input, i+1), string(content[loc[0]:end])); err != nil {
+				return nil, err
+			}
+		}
+	case ExportFormatQuilt:
+		dir, seriesFile := importReq.Input, filepath.Join(importReq.Input, quiltSeriesFileName)
+		if filepath.Base(importReq.Input) == quiltSeriesFileName {
+			dir, seriesFile = filepath.Dir(importReq.Input), importReq.Input
+		}
+		series, err := os.ReadFile(seriesFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(series), "\n") {
+			// note: quilt allows comments and patch options, such as `-p1`
+			fields := strings.Fields(line)
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(dir, fields[0]))
+			if err != nil {
+				return nil, err
+			}
+			if err := addPatch(fields[0], string(content)); err != nil {
+				return nil, err
+			}
+		}
+	case ExportFormatPatchDir:
+		// note: entries are sorted by file name, which are prefixed
+		// by the order of application of the patches
+		entries, err := os.ReadDir(importReq.Input)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".patch") {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(importReq.Input, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			if err := addPatch(e.Name(), string(content)); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported import format '%s', must be one of: %s", format, strings.Join(AllExportFormats, ", "))
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no patches found in %s", importReq.Input)
+	}
+	return res, nil
+}
+
+// parses a patch in email format, as produced by `git format-patch` and
+// Export, and returns it along with the info of its original commit
+func parseImportPatch(name, content string) (*importPatch, error) {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	match := rgxMboxFromLine.FindStringSubmatch(lines[0])
+	if match == nil || !rgxCommitSHA.MatchString(match[1]) {
+		return nil, fmt.Errorf("patch %s does not carry the SHA of its original commit, make sure it's produced by `git format-patch`", name)
+	}
+
+	// collect the email headers, which end at the first empty line and
+	// may be folded on multiple lines
+	var headers [][2]string
+	i := 1
+	for ; i < len(lines) && len(lines[i]) > 0; i++ {
+		if (lines[i][0] == ' ' || lines[i][0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1][1] += " " + strings.TrimSpace(lines[i])
+			continue
+		}
+		if key, value, ok := strings.Cut(lines[i], ":"); ok {
+			headers = append(headers, [2]string{key, strings.TrimSpace(value)})
+		}
+	}
+
+	// the commit message body ends where the diff stats begin
+	var body []string
+	for i++; i < len(lines) && lines[i] != "---"; i++ {
+		body = append(body, lines[i])
+	}
+
+	var subject, squashInto string
+	var markers []string
+	for _, h := range headers {
+		switch {
+		case strings.EqualFold(h[0], "Subject"):
+			subject = rgxPatchSubjectPrefix.ReplaceAllString(h[1], "")
+		case strings.EqualFold(h[0], PatchHeaderMarker):
+			markers = append(markers, h[1])
+		case strings.EqualFold(h[0], PatchHeaderSquashInto):
+			squashInto = strings.ToLower(h[1])
+		}
+	}
+	if len(subject) == 0 {
+		return nil, fmt.Errorf("patch %s has no subject", name)
+	}
+	if len(squashInto) > 0 && !rgxCommitSHA.MatchString(squashInto) {
+		return nil, fmt.Errorf("patch %s has header %s which is not a full commit SHA: %s", name, PatchHeaderSquashInto, squashInto)
+	}
+
+	message := subject
+	if text := strings.TrimSpace(strings.Join(body, "\n")); len(text) > 0 {
+		message += "\n\n" + text
+	}
+
+	// the metadata headers written by Export take precedence over the
+	// commit message, as they also contain the markers of the commit comments
+	c := &commitInfo{
+		Commit: &github.RepositoryCommit{
+			SHA:    github.String(match[1]),
+			Commit: &github.Commit{Message: github.String(message)},
+		},
+		SquashInto: squashInto,
+	}
+	if len(markers) > 0 {
+		c.Markers = parseCommitMarkers(strings.Join(markers, "\n"))
+	} else {
+		c.Markers = parseCommitMarkers(message)
+	}
+	return &importPatch{Name: name, Content: content, Commit: c}, nil
+}
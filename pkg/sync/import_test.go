@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFinalizeGit records all the git commands, and returns a fixed
+// output for all the ones with output
+type fakeFinalizeGit struct {
+	fakeRecordingGit
+	out string
+}
+
+func (f *fakeFinalizeGit) DoOutput(commands ...string) (string, error) {
+	return f.out, nil
+}
+
+func TestImport(t *testing.T) {
+	exported := strings.Replace(samplePatch, "Subject: [PATCH] fix: something\n",
+		"Subject: [PATCH] fix: something\nX-Synchro-Marker: SYNC_CONFLICT_APPLY(src/**)\nX-Synchro-Squash-Into: FEDCBA9876543210FEDCBA9876543210FEDCBA98\n", 1)
+
+	t.Run("parse-patch", func(t *testing.T) {
+		patch, err := parseImportPatch("p", samplePatch)
+		require.NoError(t, err)
+		assert.Equal(t, "0123456789abcdef0123456789abcdef01234567", patch.Commit.SHA())
+		assert.Equal(t, "fix: something\n\nSome description.\n\nSYNC_CONFLICT_SKIP(vendor/**)", patch.Commit.Message())
+		assert.Equal(t, map[string][]string{CommitMarkerConflictSkip.String(): {"vendor/**"}}, patch.Commit.Markers)
+
+		patch, err = parseImportPatch("p", exported)
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{CommitMarkerConflictApply.String(): {"src/**"}}, patch.Commit.Markers)
+		assert.Equal(t, "fedcba9876543210fedcba9876543210fedcba98", patch.Commit.SquashInto)
+
+		_, err = parseImportPatch("p", "Subject: no sha\n\n---\n")
+		assert.Error(t, err)
+
+		_, err = parseImportPatch("p", strings.Replace(exported, "FEDCBA9876543210FEDCBA9876543210FEDCBA98", "abc", 1))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not a full commit SHA")
+	})
+
+	t.Run("finalize-short-squash-target", func(t *testing.T) {
+		// a target shorter than an abbreviated SHA can't be the previous
+		// patch, and the commit is kept as is
+		git := &fakeFinalizeGit{out: "fix: other\n\nSYNCHRO: porting of fedcba98 (url)\n"}
+		c := &commitInfo{
+			Commit: &github.RepositoryCommit{
+				SHA:    github.String("0123456789abcdef0123456789abcdef01234567"),
+				Commit: &github.Commit{Message: github.String("fix: something")},
+			},
+			SquashInto: "abc",
+		}
+		links := &provider.Links{BaseURL: "https://github.com", CommitPath: "commit"}
+		require.NoError(t, finalizePatch(git, &Request{ForkOrg: "fork", ForkRepo: "repo"}, links, c, false))
+		require.Len(t, git.commands, 1)
+		assert.True(t, strings.HasPrefix(git.commands[0], "commit --amend -m fix: other"))
+	})
+
+	t.Run("mbox", func(t *testing.T) {
+		second := strings.ReplaceAll(strings.ReplaceAll(samplePatch, "0123456789", "9876543210"), "fix: something", "fix: other")
+		input := filepath.Join(t.TempDir(), "series.mbox")
+		require.NoError(t, os.WriteFile(input, []byte(samplePatch+"\n"+second+"\n"), 0644))
+		patches, err := readPatchSeries(&ImportRequest{Input: input})
+		require.NoError(t, err)
+		require.Len(t, patches, 2)
+		assert.Equal(t, "fix: something", patches[0].Commit.Title())
+		assert.Equal(t, "fix: other", patches[1].Commit.Title())
+		assert.Equal(t, samplePatch+"\n", patches[0].Content)
+	})
+
+	t.Run("quilt", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "b.patch"), []byte(samplePatch), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.patch"), []byte(exported), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, quiltSeriesFileName), []byte("# comment\nb.patch -p1\n\na.patch\n"), 0644))
+		patches, err := readPatchSeries(&ImportRequest{Input: dir})
+		require.NoError(t, err)
+		require.Len(t, patches, 2)
+		assert.Equal(t, "b.patch", patches[0].Name)
+		assert.Equal(t, "a.patch", patches[1].Name)
+
+		// without a series file, patches are applied in order of file name
+		require.NoError(t, os.Remove(filepath.Join(dir, quiltSeriesFileName)))
+		format, err := detectSeriesFormat(dir)
+		require.NoError(t, err)
+		assert.Equal(t, ExportFormatPatchDir, format)
+		patches, err = readPatchSeries(&ImportRequest{Input: dir})
+		require.NoError(t, err)
+		require.Len(t, patches, 2)
+		assert.Equal(t, "a.patch", patches[0].Name)
+	})
+
+	t.Run("conflict-output", func(t *testing.T) {
+		c := &commitInfo{Commit: &github.RepositoryCommit{
+			SHA:    github.String("0123456789abcdef0123456789abcdef01234567"),
+			Commit: &github.Commit{Message: github.String("fix: something")},
+		}}
+		out := amConflictOutput("CONFLICT (modify/delete): d.txt deleted in HEAD and modified in fix: something. Version fix: something of d.txt left in tree.", c)
+		infos, err := getNonContentConflictInfos(out)
+		require.NoError(t, err)
+		assert.Len(t, infos, 1)
+	})
+}
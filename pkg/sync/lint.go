@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+)
+
+// LintRequest contains all the info required for validating the markers
+// annotated on a range of commits
+type LintRequest struct {
+	// RevRange is the git revision range of the commits to be validated
+	RevRange string
+	// ForkOrg and ForkRepo are the repository whose commit comments are
+	// validated too through the provider, which are ignored if empty
+	ForkOrg  string
+	ForkRepo string
+}
+
+// LintMarkers validates the markers annotated in the message of each commit
+// of the given git revision range, and in its comments if the request
+// specifies the repository of them, and returns all the issues found in
+// chronological order. Returns a non-nil error in case of failure.
+func LintMarkers(ctx context.Context, git utils.GitHelper, p provider.Provider, req *LintRequest) ([]*MarkerIssue, error) {
+	out, err := git.DoOutput("rev-list", "--reverse", req.RevRange)
+	if err != nil {
+		return nil, err
+	}
+	var res []*MarkerIssue
+	addIssues := func(info *commitInfo, url string, issues []*MarkerIssue) {
+		for _, issue := range issues {
+			issue.SHA = info.SHA()
+			issue.Title = info.Title()
+			issue.URL = url
+			res = append(res, issue)
+		}
+	}
+	for _, sha := range strings.Fields(out) {
+		c, err := getLocalCommit(git, sha)
+		if err != nil {
+			return nil, err
+		}
+		info := &commitInfo{Commit: c}
+		_, issues := lintCommitMarkers(info.Message())
+		addIssues(info, "", issues)
+		if len(req.ForkOrg) == 0 || len(req.ForkRepo) == 0 {
+			continue
+		}
+		comments, err := info.getComments(ctx, p, req.ForkOrg, req.ForkRepo)
+		if err != nil {
+			return nil, err
+		}
+		for _, comment := range comments {
+			_, issues := lintCommitMarkers(comment.GetBody())
+			addIssues(info, comment.GetHTMLURL(), issues)
+		}
+	}
+	return res, nil
+}
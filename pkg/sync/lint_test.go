@@ -0,0 +1,62 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLintGit serves the given commit messages by SHA, in order
+type fakeLintGit struct {
+	utils.GitHelper
+	shas     []string
+	messages map[string]string
+}
+
+func (f *fakeLintGit) DoOutput(args ...string) (string, error) {
+	if args[0] == "rev-list" {
+		return strings.Join(f.shas, "\n"), nil
+	}
+	sha := args[len(args)-1]
+	msg, ok := f.messages[sha]
+	if !ok {
+		return "", fmt.Errorf("unknown revision: %s", sha)
+	}
+	return strings.Join([]string{sha, "John Doe", "jdoe@example.com", "2024-01-01T00:00:00Z", msg}, "\x00"), nil
+}
+
+func TestLintMarkers(t *testing.T) {
+	git := &fakeLintGit{
+		shas: []string{"sha1", "sha2"},
+		messages: map[string]string{
+			"sha1": "fix: one\n\nSYNC_IGNORE: not needed anymore",
+			"sha2": "fix: two\n\nSYNC_CONFLICT_SKIP(vendor/**)",
+		},
+	}
+	p := &fakeCommentsProvider{comments: []*github.RepositoryComment{{
+		Body:    github.String("SYNC_CONFLICT_SKIPP"),
+		HTMLURL: github.String("https://github.com/fork/repo/commit/sha#comment-1"),
+	}}}
+
+	// only the commit messages are validated without a repository
+	issues, err := LintMarkers(context.Background(), git, nil, &LintRequest{RevRange: "main..dev"})
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	assert.Equal(t, "sha1", issues[0].SHA)
+	assert.Equal(t, "fix: one", issues[0].Title)
+	assert.Equal(t, "line 3: marker SYNC_IGNORE is ignored as it is not on its own line nor in a Synchro-Marker trailer", issues[0].String())
+
+	issues, err = LintMarkers(context.Background(), git, p, &LintRequest{RevRange: "main..dev", ForkOrg: "fork", ForkRepo: "repo"})
+	require.NoError(t, err)
+	require.Len(t, issues, 3)
+	assert.Equal(t, "sha1", issues[1].SHA)
+	assert.Equal(t, "comment https://github.com/fork/repo/commit/sha#comment-1 line 1: unknown marker: SYNC_CONFLICT_SKIPP", issues[1].String())
+	assert.Equal(t, "sha2", issues[2].SHA)
+	assert.Equal(t, "fix: two", issues[2].Title)
+}
@@ -1,5 +1,14 @@
 package sync
 
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jasondellaluce/synchro/pkg/utils"
+)
+
 type CommitMarker string
 
 const (
@@ -8,13 +17,37 @@ const (
 	CommitMarkerIgnore CommitMarker = "SYNC_IGNORE"
 
 	// CommitMarkerConflictSkip is a keyword that can be used for signaling that a given
-	// commit should be skipped in case of a merge conflict
+	// commit should be skipped in case of a merge conflict. The marker can be
+	// restricted to some files with comma-separated globs in parentheses,
+	// such as `SYNC_CONFLICT_SKIP(vendor/**)`.
 	CommitMarkerConflictSkip CommitMarker = "SYNC_CONFLICT_SKIP"
 
 	// CommitMarkerConflictApply is a keyword that can be used for signaling that a given
 	// commit should be always applied in case of a merge conflict. In case
-	// of content conflict markers, the commit's markers are chosen.
+	// of content conflict markers, the commit's markers are chosen. The marker
+	// can be restricted to some files like CommitMarkerConflictSkip.
 	CommitMarkerConflictApply CommitMarker = "SYNC_CONFLICT_APPLY"
+
+	// CommitMarkerUntil is a keyword that can be used for signaling that a given
+	// commit should be picked only until the upstream head includes the given
+	// ref, such as `SYNC_UNTIL=v0.37.0`. This is useful for backports of
+	// upstream changes, which are not required anymore once released.
+	CommitMarkerUntil CommitMarker = "SYNC_UNTIL"
+
+	// CommitMarkerSince is a keyword that can be used for signaling that a given
+	// commit should be picked only once the upstream head includes the given
+	// ref, such as `SYNC_SINCE=v0.37.0`.
+	CommitMarkerSince CommitMarker = "SYNC_SINCE"
+
+	// CommitMarkerSquashInto is a keyword that can be used for signaling that
+	// a given commit should be folded into another picked commit, identified
+	// by its SHA or by the number of its fork pull request, such as
+	// `SYNC_SQUASH_INTO=#42`. The commit is moved right after its target.
+	CommitMarkerSquashInto CommitMarker = "SYNC_SQUASH_INTO"
+
+	// CommitMarkerFixup is a keyword that can be used for signaling that a
+	// given commit should be folded into the picked commit preceding it.
+	CommitMarkerFixup CommitMarker = "SYNC_FIXUP"
 )
 
 // AllCommitMarkers is a collection of all commit markers supported
@@ -22,6 +55,10 @@ var AllCommitMarkers = []CommitMarker{
 	CommitMarkerIgnore,
 	CommitMarkerConflictSkip,
 	CommitMarkerConflictApply,
+	CommitMarkerUntil,
+	CommitMarkerSince,
+	CommitMarkerSquashInto,
+	CommitMarkerFixup,
 }
 
 func (c CommitMarker) String() string {
@@ -33,10 +70,213 @@ func (c CommitMarker) Description() string {
 	case CommitMarkerIgnore:
 		return "The commit should be ignored during the sync"
 	case CommitMarkerConflictSkip:
-		return "In case of a merge conflict, the conflicting changes of the commit should be skipped"
+		return "In case of a merge conflict, the conflicting changes of the commit should be skipped. " +
+			"Can be restricted to some files with comma-separated globs, such as `" + c.String() + "(vendor/**,*.pb.go)`, but not to single hunks of them"
 	case CommitMarkerConflictApply:
-		return "In case of a merge conflict, the conflicting changes of the commit should be forcefully applied"
+		return "In case of a merge conflict, the conflicting changes of the commit should be forcefully applied. " +
+			"Can be restricted to some files with comma-separated globs, such as `" + c.String() + "(src/**)`, but not to single hunks of them"
+	case CommitMarkerUntil:
+		return "The commit should be picked only until the upstream head includes the given tag or ref, such as `" + c.String() + "=v0.37.0`. " +
+			"Version tags are compared semantically, and other refs by ancestry in the local clone"
+	case CommitMarkerSince:
+		return "The commit should be picked only once the upstream head includes the given tag or ref, such as `" + c.String() + "=v0.37.0`. " +
+			"Version tags are compared semantically, and other refs by ancestry in the local clone"
+	case CommitMarkerSquashInto:
+		return "The commit should be folded into another picked commit, identified by SHA or by fork pull request number, such as `" + c.String() + "=#42`. " +
+			"The commit is moved right after its target in the sync branch"
+	case CommitMarkerFixup:
+		return "The commit should be folded into the picked commit preceding it"
 	default:
 		panic("CommitMarker.Description invoked on invalid instance")
 	}
 }
+
+// MarkerTrailerKey is the key of the git trailers that can be used for
+// annotating markers, such as `Synchro-Marker: conflict-skip(vendor/**)`
+var MarkerTrailerKey = strings.ToUpper(utils.ProjectName[:1]) + utils.ProjectName[1:] + "-Marker"
+
+// TrailerValue returns the value of the MarkerTrailerKey git trailer
+// that annotates the marker
+func (c CommitMarker) TrailerValue() string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(c.String(), "SYNC_"), "_", "-"))
+}
+
+// returns true if the marker requires a value, such as `SYNC_UNTIL=<ref>`,
+// instead of accepting file globs
+func (c CommitMarker) hasValue() bool {
+	return c == CommitMarkerUntil || c == CommitMarkerSince || c == CommitMarkerSquashInto
+}
+
+// commitWideMarkerGlob is the glob of markers that are not restricted to
+// any specific file
+const commitWideMarkerGlob = "**"
+
+// returns the given markers in the form in which they are annotated, such
+// as `SYNC_UNTIL=<ref>`, `SYNC_IGNORE`, or `SYNC_CONFLICT_SKIP(<glob>)`, one
+// for each glob or value and in the order of AllCommitMarkers
+func formatCommitMarkers(markers map[string][]string) []string {
+	var res []string
+	for _, m := range AllCommitMarkers {
+		for _, v := range markers[m.String()] {
+			switch {
+			case m.hasValue():
+				res = append(res, fmt.Sprintf("%s=%s", m, v))
+			case v == commitWideMarkerGlob:
+				res = append(res, m.String())
+			default:
+				res = append(res, fmt.Sprintf("%s(%s)", m, v))
+			}
+		}
+	}
+	return res
+}
+
+var (
+	rgxMarkerLine    = regexp.MustCompile(`^(SYNC_[A-Za-z0-9_]*)(?:\(([^)]*)\)|(=\S*))?$`)
+	rgxMarkerTrailer = regexp.MustCompile(`(?i)^` + regexp.QuoteMeta(MarkerTrailerKey) + `:(.*)$`)
+	rgxTrailerValue  = regexp.MustCompile(`^([A-Za-z_-]+)(?:\(([^)]*)\)|(=\S*))?$`)
+)
+
+// MarkerIssue is a problem found in the markers annotated on a commit
+type MarkerIssue struct {
+	// SHA and Title identify the commit, if known
+	SHA   string
+	Title string
+	// URL is the web URL of the commit comment in which the issue is found,
+	// or empty if found in the commit message
+	URL string
+	// Line is the line of the text in which the issue is found, starting at 1
+	Line    int
+	Message string
+}
+
+func (i *MarkerIssue) String() string {
+	if len(i.URL) > 0 {
+		return fmt.Sprintf("comment %s line %d: %s", i.URL, i.Line, i.Message)
+	}
+	return fmt.Sprintf("line %d: %s", i.Line, i.Message)
+}
+
+// rgxMarkers contains the regex of each marker, compiled once for all
+var rgxMarkers = func() map[CommitMarker]*regexp.Regexp {
+	res := make(map[CommitMarker]*regexp.Regexp)
+	for _, m := range AllCommitMarkers {
+		res[m] = regexp.MustCompile(`\b` + regexp.QuoteMeta(m.String()) + `\b(?:\(([^)]*)\))?`)
+	}
+	return res
+}()
+
+// regex matches a marker, optionally followed by a list of globs in parentheses
+func (c CommitMarker) regex() *regexp.Regexp {
+	return rgxMarkers[c]
+}
+
+// returns the marker with the given name or trailer value, if any
+func lookupCommitMarker(s string) (CommitMarker, bool) {
+	for _, m := range AllCommitMarkers {
+		if strings.EqualFold(s, m.String()) || strings.EqualFold(s, m.TrailerValue()) {
+			return m, true
+		}
+	}
+	return "", false
+}
+
+// returns the non-empty comma-separated globs of a marker, or the
+// commitWideMarkerGlob glob if there are none
+func parseMarkerGlobs(s string) []string {
+	var res []string
+	for _, g := range strings.Split(s, ",") {
+		if g = strings.TrimSpace(g); len(g) > 0 {
+			res = append(res, g)
+		}
+	}
+	if len(res) == 0 {
+		return []string{commitWideMarkerGlob}
+	}
+	return res
+}
+
+// searches for all markers in the given text and returns the globs of the
+// files to which each found marker is restricted. Markers not restricted to
+// any file have the commitWideMarkerGlob glob.
+func parseCommitMarkers(text string) map[string][]string {
+	res, _ := lintCommitMarkers(text)
+	return res
+}
+
+// same as parseCommitMarkers, but also returns the issues found in the text.
+// Markers are recognized only if they are on their own line, or if they are
+// the value of a MarkerTrailerKey trailer, and never inside code blocks.
+// This prevents markers mentioned in prose or quoted from having effects.
+func lintCommitMarkers(text string) (map[string][]string, []*MarkerIssue) {
+	res := make(map[string][]string)
+	var issues []*MarkerIssue
+	addIssue := func(line int, format string, args ...interface{}) {
+		issues = append(issues, &MarkerIssue{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+	// note: globs and value are the optional `(<globs>)` and `=<value>`
+	// suffixes of the marker, of which at most one is non-empty
+	addMarker := func(line int, m CommitMarker, globs, value string) {
+		if m.hasValue() {
+			if len(value) <= 1 {
+				addIssue(line, "marker %s requires a value, such as %s=<ref>", m, m)
+				return
+			}
+			res[m.String()] = append(res[m.String()], value[1:])
+			return
+		}
+		if len(value) > 0 {
+			addIssue(line, "marker %s does not accept a value", m)
+			return
+		}
+		res[m.String()] = append(res[m.String()], parseMarkerGlobs(globs)...)
+	}
+
+	inCodeBlock := false
+	lineNum := 0
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "```") {
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+		if inCodeBlock {
+			continue
+		}
+
+		if match := rgxMarkerTrailer.FindStringSubmatch(line); match != nil {
+			value := strings.TrimSpace(match[1])
+			valueMatch := rgxTrailerValue.FindStringSubmatch(value)
+			if valueMatch == nil {
+				addIssue(lineNum, "malformed %s trailer value: %s", MarkerTrailerKey, value)
+				continue
+			}
+			m, ok := lookupCommitMarker(valueMatch[1])
+			if !ok {
+				addIssue(lineNum, "unknown marker in %s trailer: %s", MarkerTrailerKey, valueMatch[1])
+				continue
+			}
+			addMarker(lineNum, m, valueMatch[2], valueMatch[3])
+			continue
+		}
+
+		if match := rgxMarkerLine.FindStringSubmatch(line); match != nil {
+			m, ok := lookupCommitMarker(match[1])
+			if !ok || m.String() != match[1] {
+				addIssue(lineNum, "unknown marker: %s", match[1])
+				continue
+			}
+			addMarker(lineNum, m, match[2], match[3])
+			continue
+		}
+
+		for _, m := range AllCommitMarkers {
+			if m.regex().MatchString(line) {
+				addIssue(lineNum, "marker %s is ignored as it is not on its own line nor in a %s trailer", m, MarkerTrailerKey)
+			}
+		}
+	}
+	return res, issues
+}
@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitMarkers(t *testing.T) {
+	t.Run("parse", func(t *testing.T) {
+		markers := parseCommitMarkers("fix: something\n\nSYNC_CONFLICT_SKIP(vendor/**, *.pb.go)\nSYNC_CONFLICT_APPLY\nSYNC_IGNORE_NOT_A_MARKER")
+		assert.Equal(t, map[string][]string{
+			CommitMarkerConflictSkip.String():  {"vendor/**", "*.pb.go"},
+			CommitMarkerConflictApply.String(): {commitWideMarkerGlob},
+		}, markers)
+	})
+
+	t.Run("format", func(t *testing.T) {
+		markers := parseCommitMarkers("SYNC_UNTIL=v1.0.0\nSYNC_CONFLICT_SKIP(vendor/**, *.pb.go)\nSYNC_IGNORE")
+		assert.Equal(t, []string{
+			"SYNC_IGNORE",
+			"SYNC_CONFLICT_SKIP(vendor/**)",
+			"SYNC_CONFLICT_SKIP(*.pb.go)",
+			"SYNC_UNTIL=v1.0.0",
+		}, formatCommitMarkers(markers))
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		markers, issues := lintCommitMarkers("fix: something\n\n" +
+			"this does not need SYNC_IGNORE, as discussed\n" +
+			"```\nSYNC_IGNORE\n```\n" +
+			"SYNC_IGNOR\n" +
+			"Synchro-Marker: conflict-skip(vendor/**)\n" +
+			"synchro-marker: SYNC_CONFLICT_APPLY\n" +
+			"Synchro-Marker: conflict-drop\n")
+		assert.Equal(t, map[string][]string{
+			CommitMarkerConflictSkip.String():  {"vendor/**"},
+			CommitMarkerConflictApply.String(): {commitWideMarkerGlob},
+		}, markers)
+		if assert.Len(t, issues, 3) {
+			assert.Equal(t, 3, issues[0].Line)
+			assert.Equal(t, 7, issues[1].Line)
+			assert.Equal(t, 10, issues[2].Line)
+		}
+	})
+
+	t.Run("per-file", func(t *testing.T) {
+		c := &commitInfo{
+			Commit:  &github.RepositoryCommit{},
+			Markers: parseCommitMarkers("SYNC_CONFLICT_SKIP(vendor/**)\nSYNC_CONFLICT_APPLY(vendor/ours/**)"),
+		}
+		assert.Equal(t, CommitMarkerConflictSkip, c.conflictMarker("vendor/lib/a.go"))
+		assert.Equal(t, CommitMarkerConflictApply, c.conflictMarker("vendor/ours/a.go"))
+		assert.Equal(t, CommitMarker(""), c.conflictMarker("src/a.go"))
+
+		c.Markers = parseCommitMarkers("SYNC_CONFLICT_APPLY\nSYNC_CONFLICT_SKIP(vendor/**)")
+		assert.Equal(t, CommitMarkerConflictSkip, c.conflictMarker("vendor/lib/a.go"))
+		assert.Equal(t, CommitMarkerConflictApply, c.conflictMarker("src/a.go"))
+	})
+}
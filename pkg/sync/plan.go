@@ -0,0 +1,141 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+)
+
+// Plan is a machine-readable description of the changes that a sync
+// would apply, as resulting from a fork scan
+type Plan struct {
+	UpstreamRepo    string `json:"upstreamRepo" yaml:"upstreamRepo"`
+	UpstreamHeadRef string `json:"upstreamHeadRef" yaml:"upstreamHeadRef"`
+	ForkRepo        string `json:"forkRepo" yaml:"forkRepo"`
+	ForkHeadRef     string `json:"forkHeadRef" yaml:"forkHeadRef"`
+	OutBranch       string `json:"outBranch" yaml:"outBranch"`
+	// Commits are the commits that would be picked, in order of application
+	Commits []*PlanCommit `json:"commits" yaml:"commits"`
+	// Skipped are the commits excluded from the sync, in chronological order
+	Skipped []*PlanCommit `json:"skipped" yaml:"skipped"`
+}
+
+// PlanCommit describes a single fork commit considered by a sync
+type PlanCommit struct {
+	SHA                  string             `json:"sha" yaml:"sha"`
+	Title                string             `json:"title" yaml:"title"`
+	Author               string             `json:"author" yaml:"author"`
+	URL                  string             `json:"url" yaml:"url"`
+	Markers              []string           `json:"markers,omitempty" yaml:"markers,omitempty"`
+	ForkPullRequests     []*PlanPullRequest `json:"forkPullRequests,omitempty" yaml:"forkPullRequests,omitempty"`
+	UpstreamPullRequests []*PlanPullRequest `json:"upstreamPullRequests,omitempty" yaml:"upstreamPullRequests,omitempty"`
+	// UpstreamRef is the upstream pull request referenced by the commit, if any
+	UpstreamRef *PlanPullRequest `json:"upstreamRef,omitempty" yaml:"upstreamRef,omitempty"`
+	// SkipReason is the reason for which the commit is excluded from the sync, if so
+	SkipReason SkipReason `json:"skipReason,omitempty" yaml:"skipReason,omitempty"`
+	// SkipEvidence describes what caused the exclusion of the commit
+	SkipEvidence string `json:"skipEvidence,omitempty" yaml:"skipEvidence,omitempty"`
+	// SkipURL points to the resource that caused the exclusion, if any
+	SkipURL string `json:"skipURL,omitempty" yaml:"skipURL,omitempty"`
+	// SquashInto is the SHA of the commit into which the commit is folded, if any
+	SquashInto string `json:"squashInto,omitempty" yaml:"squashInto,omitempty"`
+	// Prediction is the predicted outcome of picking the commit, if requested
+	Prediction *PlanPrediction `json:"prediction,omitempty" yaml:"prediction,omitempty"`
+}
+
+// PlanPrediction is the predicted outcome of picking a commit during a sync
+type PlanPrediction struct {
+	Outcome PredictionOutcome `json:"outcome" yaml:"outcome"`
+	// Conflicts are the merge conflicts reported by git, if any
+	Conflicts []string `json:"conflicts,omitempty" yaml:"conflicts,omitempty"`
+	// Approximate is true if a previous commit is predicted to conflict, in
+	// which case the prediction assumes the previous commit has been skipped
+	Approximate bool `json:"approximate,omitempty" yaml:"approximate,omitempty"`
+}
+
+// PlanPullRequest describes a pull request related to a fork commit
+type PlanPullRequest struct {
+	Number int    `json:"number" yaml:"number"`
+	Title  string `json:"title" yaml:"title"`
+	URL    string `json:"url" yaml:"url"`
+	// State is one of: open, draft, closed, merged
+	State string `json:"state" yaml:"state"`
+}
+
+// ScanPlan scans the fork as specified by the given request, and returns
+// the plan of the sync that would be performed, without applying anything
+func ScanPlan(ctx context.Context, git utils.GitHelper, p provider.Provider, req *Request) (*Plan, error) {
+	scanRes, err := runScan(ctx, git, p, req)
+	if err != nil {
+		return nil, err
+	}
+	return newPlan(p.Links(), req, scanRes), nil
+}
+
+func newPlan(links *provider.Links, req *Request, scanRes *scanResult) *Plan {
+	res := &Plan{
+		UpstreamRepo:    fmt.Sprintf("%s/%s", req.UpstreamOrg, req.UpstreamRepo),
+		UpstreamHeadRef: req.UpstreamHeadRef,
+		ForkRepo:        fmt.Sprintf("%s/%s", req.ForkOrg, req.ForkRepo),
+		ForkHeadRef:     req.ForkHeadRef,
+		OutBranch:       req.OutBranch,
+		Commits:         []*PlanCommit{},
+		Skipped:         []*PlanCommit{},
+	}
+	for _, c := range scanRes.Picked {
+		res.Commits = append(res.Commits, newPlanCommit(links, req, c))
+	}
+	for _, c := range scanRes.Skipped {
+		res.Skipped = append(res.Skipped, newPlanCommit(links, req, c))
+	}
+	return res
+}
+
+func newPlanCommit(links *provider.Links, req *Request, c *commitInfo) *PlanCommit {
+	res := &PlanCommit{
+		SHA:        c.SHA(),
+		Title:      c.Title(),
+		Author:     c.AuthorLogin(),
+		URL:        links.Commit(req.ForkOrg, req.ForkRepo, c.SHA()),
+		SquashInto: c.SquashInto,
+	}
+	if c.Skip != nil {
+		res.SkipReason = c.Skip.Reason
+		res.SkipEvidence = c.Skip.Evidence
+		res.SkipURL = c.Skip.URL
+	}
+	if len(res.Author) == 0 {
+		res.Author = c.Commit.GetCommit().GetAuthor().GetName()
+	}
+	res.Markers = formatCommitMarkers(c.Markers)
+	for _, pr := range c.pullRequestsOfRepo(req.ForkOrg, req.ForkRepo) {
+		res.ForkPullRequests = append(res.ForkPullRequests, newPlanPullRequest(links, req.ForkOrg, req.ForkRepo, pr))
+	}
+	for _, pr := range c.pullRequestsOfRepo(req.UpstreamOrg, req.UpstreamRepo) {
+		res.UpstreamPullRequests = append(res.UpstreamPullRequests, newPlanPullRequest(links, req.UpstreamOrg, req.UpstreamRepo, pr))
+	}
+	if c.UpstreamRef != nil {
+		res.UpstreamRef = newPlanPullRequest(links, req.UpstreamOrg, req.UpstreamRepo, c.UpstreamRef)
+	}
+	return res
+}
+
+func newPlanPullRequest(links *provider.Links, org, repo string, pr *github.PullRequest) *PlanPullRequest {
+	res := &PlanPullRequest{
+		Number: pr.GetNumber(),
+		Title:  pr.GetTitle(),
+		URL:    pullRequestURL(links, org, repo, pr),
+		State:  "open",
+	}
+	if pr.MergedAt != nil || pr.GetMerged() {
+		res.State = "merged"
+	} else if pr.GetState() == "closed" {
+		res.State = "closed"
+	} else if pr.GetDraft() {
+		res.State = "draft"
+	}
+	return res
+}
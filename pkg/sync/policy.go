@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+)
+
+// returns the skip info of a commit that the request requires to ignore,
+// either by SHA or by author, or nil otherwise
+func policyIgnoreSkip(req *Request, c *commitInfo) *commitSkip {
+	for _, sha := range req.IgnoreCommits {
+		if len(sha) > 0 && strings.HasPrefix(c.SHA(), strings.ToLower(sha)) {
+			return &commitSkip{
+				Reason:   SkipReasonPolicy,
+				Evidence: fmt.Sprintf("commit %s is ignored by the sync policy", sha),
+			}
+		}
+	}
+	author := c.Commit.GetCommit().GetAuthor()
+	for _, a := range req.IgnoreAuthors {
+		for _, v := range []string{c.AuthorLogin(), author.GetName(), author.GetEmail()} {
+			if len(v) > 0 && strings.EqualFold(a, v) {
+				return &commitSkip{
+					Reason:   SkipReasonPolicy,
+					Evidence: fmt.Sprintf("author %s is ignored by the sync policy", a),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// returns a non-nil error if a SHA prefix ignored by the request matches
+// more than one of the scanned commits, as it would ignore unrelated ones
+func checkIgnoredCommits(req *Request, res *scanResult) error {
+	for _, sha := range req.IgnoreCommits {
+		var matches []*commitInfo
+		for _, list := range [][]*commitInfo{res.Picked, res.Skipped} {
+			for _, c := range list {
+				if len(sha) > 0 && strings.HasPrefix(c.SHA(), strings.ToLower(sha)) {
+					matches = append(matches, c)
+				}
+			}
+		}
+		if len(matches) > 1 {
+			var lines []string
+			for _, c := range matches {
+				lines = append(lines, fmt.Sprintf("%s %s", c.SHA(), c.Title()))
+			}
+			return fmt.Errorf("commit %s ignored by the sync policy matches multiple commits:\n%s", sha, strings.Join(lines, "\n"))
+		}
+	}
+	return nil
+}
+
+// returns the default conflict markers of all the commits of the request,
+// or nil if the request defines none
+func requestDefaultMarkers(req *Request) map[string][]string {
+	if len(req.ConflictSkipGlobs) == 0 && len(req.ConflictApplyGlobs) == 0 {
+		return nil
+	}
+	res := make(map[string][]string)
+	if len(req.ConflictSkipGlobs) > 0 {
+		res[CommitMarkerConflictSkip.String()] = req.ConflictSkipGlobs
+	}
+	if len(req.ConflictApplyGlobs) > 0 {
+		res[CommitMarkerConflictApply.String()] = req.ConflictApplyGlobs
+	}
+	return res
+}
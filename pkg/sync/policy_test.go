@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	c := &commitInfo{
+		Commit: &github.RepositoryCommit{
+			SHA:    github.String("0123456789abcdef"),
+			Author: &github.User{Login: github.String("jdoe")},
+			Commit: &github.Commit{
+				Author: &github.CommitAuthor{Name: github.String("John Doe"), Email: github.String("jdoe@example.com")},
+			},
+		},
+	}
+
+	t.Run("ignore", func(t *testing.T) {
+		assert.Nil(t, policyIgnoreSkip(&Request{}, c))
+		assert.Nil(t, policyIgnoreSkip(&Request{IgnoreCommits: []string{"abcdef"}, IgnoreAuthors: []string{"someone"}}, c))
+		for _, req := range []*Request{
+			{IgnoreCommits: []string{"0123ABC", "01234567"}},
+			{IgnoreAuthors: []string{"JDoe"}},
+			{IgnoreAuthors: []string{"john doe"}},
+			{IgnoreAuthors: []string{"jdoe@example.com"}},
+		} {
+			skip := policyIgnoreSkip(req, c)
+			if assert.NotNil(t, skip) {
+				assert.Equal(t, SkipReasonPolicy, skip.Reason)
+			}
+		}
+	})
+
+	t.Run("ignore-ambiguous", func(t *testing.T) {
+		other := &commitInfo{Commit: &github.RepositoryCommit{
+			SHA:    github.String("0123456789ffffff"),
+			Commit: &github.Commit{Message: github.String("fix: something else")},
+		}}
+		res := &scanResult{Picked: []*commitInfo{c}, Skipped: []*commitInfo{other}}
+		assert.NoError(t, checkIgnoredCommits(&Request{IgnoreCommits: []string{"0123456789abc"}}, res))
+		err := checkIgnoredCommits(&Request{IgnoreCommits: []string{"0123456789abc", "0123456"}}, res)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "0123456789ffffff fix: something else")
+		}
+	})
+
+	t.Run("default-markers", func(t *testing.T) {
+		c.Markers = parseCommitMarkers("SYNC_CONFLICT_APPLY(src/**)")
+		c.DefaultMarkers = requestDefaultMarkers(&Request{ConflictSkipGlobs: []string{"**"}, ConflictApplyGlobs: []string{"vendor/ours/**"}})
+		assert.Equal(t, CommitMarkerConflictApply, c.conflictMarker("src/a.go"))
+		assert.Equal(t, CommitMarkerConflictApply, c.conflictMarker("vendor/ours/a.go"))
+		assert.Equal(t, CommitMarkerConflictSkip, c.conflictMarker("vendor/lib/a.go"))
+
+		c.Markers = parseCommitMarkers("SYNC_CONFLICT_APPLY")
+		assert.Equal(t, CommitMarkerConflictApply, c.conflictMarker("vendor/lib/a.go"))
+		assert.Nil(t, requestDefaultMarkers(&Request{}))
+	})
+}
@@ -0,0 +1,201 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// PredictionOutcome is the predicted outcome of picking a commit during a sync
+type PredictionOutcome string
+
+const (
+	// PredictionClean is used when a commit is predicted to apply cleanly
+	PredictionClean PredictionOutcome = "clean"
+
+	// PredictionAutoResolvable is used when a commit is predicted to cause
+	// merge conflicts that can be solved automatically
+	PredictionAutoResolvable PredictionOutcome = "auto-resolvable"
+
+	// PredictionNeedsHuman is used when a commit is predicted to cause
+	// merge conflicts that require manual intervention
+	PredictionNeedsHuman PredictionOutcome = "needs-human"
+)
+
+func (p PredictionOutcome) String() string {
+	return string(p)
+}
+
+// commitPrediction is the predicted outcome of picking a single commit
+type commitPrediction struct {
+	Outcome PredictionOutcome
+	// Conflicts are the merge conflicts reported by git, if any
+	Conflicts []string
+	// Approximate is true if a previous commit is predicted to conflict, in
+	// which case the prediction assumes the previous commit has been skipped
+	Approximate bool
+}
+
+// PredictPlan scans the fork as specified by the given request, and returns
+// the plan of the sync that would be performed along with a prediction of
+// the merge conflicts that each commit would cause. The cherry-pick sequence
+// is simulated with `git merge-tree` without touching the working tree, so
+// both the upstream head and the fork commits must be available locally.
+func PredictPlan(ctx context.Context, git utils.GitHelper, p provider.Provider, req *Request) (*Plan, error) {
+	scanRes, err := runScan(ctx, git, p, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var predictions []*commitPrediction
+	err = withLocalScanRemote(git, p.Links(), req, func(remoteName string) error {
+		upstreamRef, err := utils.ResolveLocalRef(git, remoteName, req.UpstreamHeadRef)
+		if err != nil {
+			return err
+		}
+		predictions, err = predictConflicts(git, upstreamRef, scanRes.Picked)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := newPlan(p.Links(), req, scanRes)
+	for i, pred := range predictions {
+		plan.Commits[i].Prediction = &PlanPrediction{
+			Outcome:     pred.Outcome,
+			Conflicts:   pred.Conflicts,
+			Approximate: pred.Approximate,
+		}
+	}
+	return plan, nil
+}
+
+// simulates picking the given commits in order on top of the upstream ref,
+// and returns the prediction of the outcome of each of them
+func predictConflicts(git utils.GitHelper, upstreamRef string, commits []*commitInfo) ([]*commitPrediction, error) {
+	head, err := git.DoOutput("rev-parse", upstreamRef+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*commitPrediction
+	approximate := false
+	for _, c := range commits {
+		if err := git.Do("cat-file", "-e", c.SHA()+"^{commit}"); err != nil {
+			return nil, fmt.Errorf("commit %s is not available locally, make sure the fork is fetched: %s", c.SHA(), err.Error())
+		}
+		pred, tree, err := predictCommit(git, head, c)
+		if err != nil {
+			return nil, err
+		}
+		pred.Approximate = approximate
+		logrus.Infof("predicted %s for (%s) %s", pred.Outcome, c.ShortSHA(), c.Title())
+		res = append(res, pred)
+
+		// chain the simulated commits, and keep going from the previous
+		// head in case of conflict as if the commit has been skipped
+		if pred.Outcome != PredictionClean {
+			approximate = true
+			continue
+		}
+		head, err = commitTree(git, tree, head)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// simulates picking a commit on top of the given head, and returns the
+// prediction of its outcome along with the resulting tree
+func predictCommit(git utils.GitHelper, head string, c *commitInfo) (*commitPrediction, string, error) {
+	// `git merge-tree` merges two commits using their merge base, whereas
+	// cherry-picking uses the parent of the picked commit as the base. We
+	// get the same semantics by merging with a temporary commit having the
+	// same tree of the head and the parent of the picked commit as parent.
+	headTree, err := git.DoOutput("rev-parse", head+"^{tree}")
+	if err != nil {
+		return nil, "", err
+	}
+	parent, err := git.DoOutput("rev-parse", c.SHA()+"^")
+	if err != nil {
+		return nil, "", err
+	}
+	base, err := commitTree(git, headTree, parent)
+	if err != nil {
+		return nil, "", err
+	}
+
+	out, err := git.DoOutput("merge-tree", "--write-tree", base, c.SHA())
+	if err != nil && utils.GitExitCode(err) != 1 {
+		return nil, "", fmt.Errorf("could not simulate merge (git 2.38+ is required): %s", out)
+	}
+	tree, messages := parseMergeTree(out)
+	if err == nil {
+		return &commitPrediction{Outcome: PredictionClean}, tree, nil
+	}
+
+	// make the messages look like the ones of `git cherry-pick`, so that
+	// the conflicts are parsed exactly like during a sync
+	messages = strings.ReplaceAll(messages, base, "HEAD")
+	messages = strings.ReplaceAll(messages, c.SHA(), fmt.Sprintf("%s (%s)", c.ShortSHA(), c.Title()))
+
+	res := &commitPrediction{Outcome: PredictionAutoResolvable}
+	scanner := bufio.NewScanner(strings.NewReader(messages))
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "CONFLICT (") {
+			res.Conflicts = append(res.Conflicts, scanner.Text())
+			if predictConflict(c, scanner.Text()) == PredictionNeedsHuman {
+				res.Outcome = PredictionNeedsHuman
+			}
+		}
+	}
+	return res, tree, nil
+}
+
+// returns the predicted outcome of a single merge conflict reported by git
+func predictConflict(c *commitInfo, conflict string) PredictionOutcome {
+	// note: content conflicts may still be solved through `git rerere`
+	// during the actual sync, but we can't know it in advance
+	if m := rgxConflictContent.FindStringSubmatch(conflict); m != nil {
+		if len(c.conflictMarker(m[1])) == 0 {
+			return PredictionNeedsHuman
+		}
+		return PredictionAutoResolvable
+	}
+
+	// these are always recovered by keeping the file of one of the two sides.
+	// The recovery of rename/delete conflicts relies on git leaving the
+	// renamed file in the tree, which can't be verified in a simulation, and
+	// the ones of any other kind, such as the mode or file type ones, are
+	// not recovered at all
+	if rgxConflictDeleteModify.MatchString(conflict) ||
+		rgxConflictModifyDelete.MatchString(conflict) ||
+		rgxConflictRenameRename.MatchString(conflict) {
+		return PredictionAutoResolvable
+	}
+	return PredictionNeedsHuman
+}
+
+// creates a temporary commit object with the given tree and parent
+func commitTree(git utils.GitHelper, tree, parent string) (string, error) {
+	return git.DoOutput(
+		"-c", "user.name="+utils.ProjectName,
+		"-c", "user.email="+utils.ProjectName+"@localhost",
+		"commit-tree", tree, "-p", parent, "-m", "temporary commit for conflict prediction")
+}
+
+// parses the output of `git merge-tree --write-tree`, which contains the
+// resulting tree, the conflicted files, and the informational messages
+// separated by an empty line
+func parseMergeTree(out string) (string, string) {
+	tree, rest, _ := strings.Cut(out, "\n")
+	_, messages, _ := strings.Cut(rest, "\n\n")
+	return strings.TrimSpace(tree), messages
+}
@@ -0,0 +1,143 @@
+package sync
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMergeTree(t *testing.T) {
+	const sample = `370be4fa82187e5b4facdad652b81ddf047cd2cb
+100644 de980441c3ab03a8c07dda1ad27b8a11f39deb1e 1	f
+100644 68a11f240675383fb11c50bbc438e5d7b5abf399 2	f
+100644 7be73ce3c1b1cdaea86e8168dfee8575175953bf 3	f
+
+Auto-merging f
+CONFLICT (content): Merge conflict in f`
+
+	tree, messages := parseMergeTree(sample)
+	assert.Equal(t, "370be4fa82187e5b4facdad652b81ddf047cd2cb", tree)
+	assert.Equal(t, "Auto-merging f\nCONFLICT (content): Merge conflict in f", messages)
+	assert.Equal(t, 1, countMergeContentConflicts(messages))
+
+	tree, messages = parseMergeTree("370be4fa82187e5b4facdad652b81ddf047cd2cb")
+	assert.Equal(t, "370be4fa82187e5b4facdad652b81ddf047cd2cb", tree)
+	assert.Empty(t, messages)
+}
+
+// fakeMergeTreeGit simulates a `git merge-tree` exiting with the given code
+// and messages, and resolves every other object to a fixed hash
+type fakeMergeTreeGit struct {
+	utils.GitHelper
+	code     int
+	messages string
+}
+
+const (
+	fakeMergeTreeBase = "b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0"
+	fakeMergeTreeTree = "7e7e7e7e7e7e7e7e7e7e7e7e7e7e7e7e7e7e7e7e"
+)
+
+func (f *fakeMergeTreeGit) DoOutput(commands ...string) (string, error) {
+	switch commands[0] {
+	case "merge-tree":
+		if f.code == 0 {
+			return fakeMergeTreeTree, nil
+		}
+		err := exec.Command("sh", "-c", fmt.Sprintf("exit %d", f.code)).Run()
+		if f.code > 1 {
+			return "fatal: unknown option `write-tree'", err
+		}
+		return fakeMergeTreeTree + "\n100644 de980441c3ab03a8c07dda1ad27b8a11f39deb1e 1\tf\n\n" + f.messages, err
+	case "rev-parse":
+		return fakeMergeTreeTree, nil
+	default:
+		return fakeMergeTreeBase, nil
+	}
+}
+
+func TestPredictCommit(t *testing.T) {
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+	newCommit := func(message string) *commitInfo {
+		return &commitInfo{
+			Commit: &github.RepositoryCommit{
+				SHA:    github.String(sha),
+				Commit: &github.Commit{Message: github.String(message)},
+			},
+			Markers: parseCommitMarkers(message),
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		code     int
+		messages string
+		message  string
+		outcome  PredictionOutcome
+	}{
+		{
+			name:    "clean",
+			message: "fix: something",
+			outcome: PredictionClean,
+		},
+		{
+			name:     "content-unmarked",
+			code:     1,
+			messages: "Auto-merging f\nCONFLICT (content): Merge conflict in f\n",
+			message:  "fix: something",
+			outcome:  PredictionNeedsHuman,
+		},
+		{
+			name:     "content-marked",
+			code:     1,
+			messages: "Auto-merging f\nCONFLICT (content): Merge conflict in f\n",
+			message:  "fix: something\n\nSYNC_CONFLICT_SKIP",
+			outcome:  PredictionAutoResolvable,
+		},
+		{
+			name:     "delete-modify",
+			code:     1,
+			messages: "CONFLICT (modify/delete): f deleted in " + fakeMergeTreeBase + " and modified in " + sha + ".  Version " + sha + " of f left in tree.\n",
+			message:  "fix: something",
+			outcome:  PredictionAutoResolvable,
+		},
+		{
+			name:     "rename-delete",
+			code:     1,
+			messages: "CONFLICT (rename/delete): f renamed to g in " + fakeMergeTreeBase + ", but deleted in " + sha + ".\n",
+			message:  "fix: something\n\nSYNC_CONFLICT_SKIP",
+			outcome:  PredictionNeedsHuman,
+		},
+		{
+			name:     "distinct-types",
+			code:     1,
+			messages: "CONFLICT (distinct types): f had different types on each side; renamed one of them so each can be recorded somewhere.\n",
+			message:  "fix: something",
+			outcome:  PredictionNeedsHuman,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			git := &fakeMergeTreeGit{code: tc.code, messages: tc.messages}
+			pred, tree, err := predictCommit(git, "head", newCommit(tc.message))
+			require.NoError(t, err)
+			assert.Equal(t, fakeMergeTreeTree, tree)
+			assert.Equal(t, tc.outcome, pred.Outcome)
+			if tc.code == 0 {
+				assert.Empty(t, pred.Conflicts)
+			} else {
+				assert.Len(t, pred.Conflicts, 1)
+			}
+		})
+	}
+
+	t.Run("unsupported-git", func(t *testing.T) {
+		_, _, err := predictCommit(&fakeMergeTreeGit{code: 128}, "head", newCommit("fix: something"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "git 2.38+ is required")
+	})
+}
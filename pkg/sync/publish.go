@@ -0,0 +1,144 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// returns the prefix of the title of the sync pull requests of the given
+// request, which is used for finding the one already open for the same branch
+func syncPullRequestTitlePrefix(req *Request) string {
+	return fmt.Sprintf("sync(%s): ", req.OutBranch)
+}
+
+// pushes the sync branch into the fork and opens a pull request for it, or
+// updates the one already open for the same branch, as required by the
+// request of a completed sync
+func publishSyncBranch(ctx context.Context, git utils.GitHelper, p provider.Provider, state *syncState) error {
+	req := state.Request
+	if !req.Push && !req.OpenPullRequest {
+		return nil
+	}
+
+	logrus.Infof("pushing branch '%s' into %s/%s", req.OutBranch, req.ForkOrg, req.ForkRepo)
+	if err := git.Do("push", "-f", "origin", req.OutBranch); err != nil {
+		logrus.Errorf("failure in pushing branch into fork: %s", req.OutBranch)
+		return err
+	}
+	if !req.OpenPullRequest {
+		return nil
+	}
+
+	base := req.PullRequestBase
+	if len(base) == 0 {
+		base = req.ForkHeadRef
+	}
+	titlePrefix := syncPullRequestTitlePrefix(req)
+	title := fmt.Sprintf("%ssync with upstream %s/%s %s", titlePrefix, req.UpstreamOrg, req.UpstreamRepo, req.UpstreamHeadRef)
+	body := formatSyncPullRequestBody(state)
+
+	logrus.Infof("checking if a pull request has already been opened for the same branch")
+	searchRes, err := p.SearchPullRequests(ctx, req.ForkOrg, req.ForkRepo, titlePrefix)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("search found %d results", len(searchRes))
+	for _, found := range searchRes {
+		logrus.Debugf("checking search result %s", found.GetHTMLURL())
+		if strings.HasPrefix(found.GetTitle(), titlePrefix) && found.GetState() == "open" {
+			logrus.Infof("updating existing pull request for the same branch: %s", found.GetHTMLURL())
+			pr, err := p.EditPullRequest(ctx, req.ForkOrg, req.ForkRepo, found.GetNumber(), &github.PullRequest{
+				Title: &title,
+				Body:  &body,
+				Base:  &github.PullRequestBranch{Ref: &base},
+			})
+			if err != nil {
+				logrus.Errorf("failure in updating pull request: %s", err.Error())
+				return err
+			}
+			logrus.Infof("pull request updated successfully: %s", pr.GetHTMLURL())
+			return nil
+		}
+	}
+
+	logrus.Infof("opening new pull request in %s/%s", req.ForkOrg, req.ForkRepo)
+	pr, err := p.CreatePullRequest(ctx, req.ForkOrg, req.ForkRepo, &github.NewPullRequest{
+		Title: &title,
+		Head:  &req.OutBranch,
+		Base:  &base,
+		Body:  &body,
+	})
+	if err != nil {
+		logrus.Errorf("failure in opening pull request: %s", err.Error())
+		return err
+	}
+	logrus.Infof("pull request opened successfully: %s", pr.GetHTMLURL())
+	return nil
+}
+
+// formats the body of the pull request of a completed sync in markdown
+func formatSyncPullRequestBody(state *syncState) string {
+	req := state.Request
+	links := state.Links
+	titles := make(map[string]string)
+	for _, commits := range [][]*commitInfo{state.Commits, state.Skipped} {
+		for _, c := range commits {
+			titles[c.SHA()] = c.Title()
+		}
+	}
+	writeCommit := func(b *strings.Builder, sha, suffix string) {
+		b.WriteString(fmt.Sprintf("  * [%s](%s) %s%s\n", ShortSHA(sha), links.Commit(req.ForkOrg, req.ForkRepo, sha), titles[sha], suffix))
+	}
+
+	// note: the upstream pull request commits only mark the point at
+	// which the scan stopped, so they are not reported as dropped
+	var dropped []*commitInfo
+	for _, c := range state.Skipped {
+		if c.Skip == nil || c.Skip.Reason != SkipReasonUpstreamPullRequest {
+			dropped = append(dropped, c)
+		}
+	}
+
+	// note: the commits squashed into another one don't result in a patch
+	notApplied := make(map[string]bool)
+	for _, sha := range state.Emptied {
+		notApplied[sha] = true
+	}
+	for _, r := range state.Failed {
+		notApplied[r.SHA] = true
+	}
+	patches := 0
+	for _, c := range state.Commits {
+		if len(c.SquashInto) == 0 && !notApplied[c.SHA()] {
+			patches++
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Sync of fork %s/%s (`%s`) on top of upstream %s/%s ref [`%s`](%s).\n\n",
+		req.ForkOrg, req.ForkRepo, req.ForkHeadRef, req.UpstreamOrg, req.UpstreamRepo, req.UpstreamHeadRef,
+		links.Tree(req.UpstreamOrg, req.UpstreamRepo, req.UpstreamHeadRef)))
+	b.WriteString(fmt.Sprintf("* Patches applied: %d\n", patches))
+	b.WriteString(fmt.Sprintf("* Merge conflicts solved automatically: %d\n", len(state.Recovered)))
+	for _, sha := range state.Recovered {
+		writeCommit(&b, sha, "")
+	}
+	b.WriteString(fmt.Sprintf("* Commits dropped: %d\n", len(dropped)+len(state.Emptied)))
+	for _, c := range dropped {
+		reason := ""
+		if c.Skip != nil {
+			reason = fmt.Sprintf(" (`%s`: %s)", c.Skip.Reason, c.Skip.Evidence)
+		}
+		writeCommit(&b, c.SHA(), reason)
+	}
+	for _, sha := range state.Emptied {
+		writeCommit(&b, sha, " (empty after solving merge conflicts)")
+	}
+	return b.String()
+}
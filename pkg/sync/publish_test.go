@@ -0,0 +1,143 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRecordingGit records all the git commands, which always succeed
+type fakeRecordingGit struct {
+	utils.GitHelper
+	commands []string
+}
+
+func (f *fakeRecordingGit) Do(commands ...string) error {
+	f.commands = append(f.commands, strings.Join(commands, " "))
+	return nil
+}
+
+// fakePullRequestProvider serves fixed pull request search results, and
+// records the pull requests created and edited
+type fakePullRequestProvider struct {
+	fakeScanProvider
+	found   []*github.PullRequest
+	created []*github.NewPullRequest
+	edited  map[int]*github.PullRequest
+}
+
+func (f *fakePullRequestProvider) SearchPullRequests(ctx context.Context, org, repo, text string) ([]*github.PullRequest, error) {
+	return f.found, nil
+}
+
+func (f *fakePullRequestProvider) CreatePullRequest(ctx context.Context, org, repo string, pr *github.NewPullRequest) (*github.PullRequest, error) {
+	f.created = append(f.created, pr)
+	return &github.PullRequest{}, nil
+}
+
+func (f *fakePullRequestProvider) EditPullRequest(ctx context.Context, org, repo string, num int, pr *github.PullRequest) (*github.PullRequest, error) {
+	f.edited[num] = pr
+	return pr, nil
+}
+
+func TestPublishSyncBranch(t *testing.T) {
+	newCommit := func(i int, title string) *commitInfo {
+		return &commitInfo{Commit: &github.RepositoryCommit{
+			SHA:    github.String(fmt.Sprintf("%040d", i)),
+			Commit: &github.Commit{Message: github.String(title)},
+		}}
+	}
+	newState := func() *syncState {
+		dropped := newCommit(3, "dropped")
+		dropped.Skip = &commitSkip{Reason: SkipReasonIgnoreMarker, Evidence: "commit message"}
+		upstream := newCommit(4, "upstream")
+		upstream.Skip = &commitSkip{Reason: SkipReasonUpstreamPullRequest}
+		return &syncState{
+			Request: &Request{
+				UpstreamOrg: "upstream", UpstreamRepo: "repo", UpstreamHeadRef: "0.37.0",
+				ForkOrg: "fork", ForkRepo: "repo", ForkHeadRef: "main", OutBranch: "sync/0.37.0",
+				Push: true, OpenPullRequest: true,
+			},
+			Links:     (&fakeScanProvider{}).Links(),
+			Commits:   []*commitInfo{newCommit(1, "first"), newCommit(2, "second")},
+			Recovered: []string{fmt.Sprintf("%040d", 2)},
+			Skipped:   []*commitInfo{dropped, upstream},
+		}
+	}
+
+	t.Run("body", func(t *testing.T) {
+		state := newState()
+		fixup := newCommit(5, "fixup")
+		fixup.SquashInto = state.Commits[0].SHA()
+		state.Commits = append(state.Commits, fixup)
+		body := formatSyncPullRequestBody(state)
+		assert.Contains(t, body, "* Patches applied: 2\n")
+		assert.Contains(t, body, "* Merge conflicts solved automatically: 1\n  * [00000000](https://github.com/fork/repo/commit/0000000000000000000000000000000000000002) second\n")
+		assert.Contains(t, body, "* Commits dropped: 1\n  * [00000000](https://github.com/fork/repo/commit/0000000000000000000000000000000000000003) dropped (`ignore-marker`: commit message)\n")
+	})
+
+	t.Run("create", func(t *testing.T) {
+		git := &fakeRecordingGit{}
+		p := &fakePullRequestProvider{found: []*github.PullRequest{
+			{Number: github.Int(1), Title: github.String("sync(sync/0.37.0): old"), State: github.String("closed")},
+			{Number: github.Int(2), Title: github.String("sync(sync/0.36.0): other"), State: github.String("open")},
+		}, edited: map[int]*github.PullRequest{}}
+		require.NoError(t, publishSyncBranch(context.Background(), git, p, newState()))
+		assert.Equal(t, []string{"push -f origin sync/0.37.0"}, git.commands)
+		require.Len(t, p.created, 1)
+		assert.Empty(t, p.edited)
+		assert.Equal(t, "sync(sync/0.37.0): sync with upstream upstream/repo 0.37.0", p.created[0].GetTitle())
+		assert.Equal(t, "main", p.created[0].GetBase())
+		assert.Equal(t, "sync/0.37.0", p.created[0].GetHead())
+	})
+
+	t.Run("update", func(t *testing.T) {
+		p := &fakePullRequestProvider{found: []*github.PullRequest{
+			{Number: github.Int(3), Title: github.String("sync(sync/0.37.0): previous"), State: github.String("open")},
+		}, edited: map[int]*github.PullRequest{}}
+		state := newState()
+		state.Request.PullRequestBase = "release"
+		require.NoError(t, publishSyncBranch(context.Background(), &fakeRecordingGit{}, p, state))
+		assert.Empty(t, p.created)
+		require.Contains(t, p.edited, 3)
+		assert.Equal(t, "release", p.edited[3].GetBase().GetRef())
+	})
+
+	t.Run("push-only", func(t *testing.T) {
+		git := &fakeRecordingGit{}
+		p := &fakePullRequestProvider{}
+		state := newState()
+		state.Request.OpenPullRequest = false
+		require.NoError(t, publishSyncBranch(context.Background(), git, p, state))
+		assert.Len(t, git.commands, 1)
+		assert.Empty(t, p.created)
+	})
+}
+
+func TestResumeProvider(t *testing.T) {
+	gitlab := &provider.Options{Kind: provider.KindGitLab, BaseURL: "https://gitlab.example.com"}
+
+	// the provider of the stopped sync is used by default
+	p, err := resumeProvider(&Request{Provider: gitlab}, &provider.Options{NoCache: true})
+	require.NoError(t, err)
+	assert.Equal(t, "https://gitlab.example.com", p.Links().BaseURL)
+
+	p, err = resumeProvider(&Request{Provider: gitlab}, &provider.Options{Kind: provider.KindGitLab, BaseURL: "https://gitlab.example.com", NoCache: true})
+	require.NoError(t, err)
+	assert.Equal(t, "https://gitlab.example.com", p.Links().BaseURL)
+
+	_, err = resumeProvider(&Request{Provider: gitlab}, &provider.Options{Kind: provider.KindGitHub})
+	assert.Error(t, err)
+
+	// syncs started by previous versions don't record the provider
+	p, err = resumeProvider(&Request{}, &provider.Options{NoCache: true})
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com", p.Links().BaseURL)
+}
@@ -0,0 +1,264 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/jasondellaluce/synchro/pkg/utils"
+)
+
+// RangeDiffStatus describes how a fork commit changed between two sync branches
+type RangeDiffStatus string
+
+const (
+	// RangeDiffUnchanged is used when the changes of a commit are the
+	// same in both sync branches
+	RangeDiffUnchanged RangeDiffStatus = "unchanged"
+
+	// RangeDiffModified is used when the changes of a commit differ
+	// between the two sync branches
+	RangeDiffModified RangeDiffStatus = "modified"
+
+	// RangeDiffDropped is used when a commit is only in the previous sync branch
+	RangeDiffDropped RangeDiffStatus = "dropped"
+
+	// RangeDiffNew is used when a commit is only in the new sync branch
+	RangeDiffNew RangeDiffStatus = "new"
+
+	// RangeDiffConflictResolved is used when the merge conflicts caused by
+	// a commit have been solved automatically in the new sync branch, which
+	// takes precedence over all the other statuses
+	RangeDiffConflictResolved RangeDiffStatus = "conflict-resolved"
+)
+
+func (s RangeDiffStatus) String() string {
+	return string(s)
+}
+
+// RangeDiffReport describes how the fork commits changed between the
+// previous and the new sync branches
+type RangeDiffReport struct {
+	PreviousBranch string
+	NewBranch      string
+	// Entries are the fork commits of the new sync branch in order of
+	// application, followed by the ones dropped from the previous one
+	Entries []*RangeDiffEntry
+}
+
+// RangeDiffEntry describes how a single fork commit changed between the
+// previous and the new sync branches
+type RangeDiffEntry struct {
+	Status RangeDiffStatus
+	// ForkSHA and ForkURL identify the fork commit, as reported in the
+	// metadata of the sync branches
+	ForkSHA string
+	ForkURL string
+	Title   string
+	// PreviousSHA and NewSHA are the commits porting the fork commit in the
+	// previous and in the new sync branches, if any
+	PreviousSHA string
+	NewSHA      string
+	// Interdiff is the `git range-diff` of the porting commits, if the
+	// fork commit is in both sync branches and its changes differ
+	Interdiff string
+}
+
+// syncPort is a fork commit ported in a sync branch
+type syncPort struct {
+	ForkSHA   string
+	ForkURL   string
+	SHA       string
+	Title     string
+	Recovered bool
+}
+
+var (
+	rgxSyncPortingFooter   = regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(SyncCommitBodyHeader) + `: porting of ([0-9a-fA-F]+) \((\S+)\)$`)
+	rgxSyncRecoveredFooter = regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(SyncCommitBodyHeader) + `: solved merge conflicts automatically(?: in ([0-9a-fA-F]+))?$`)
+	rgxDiffHunkHeader      = regexp.MustCompile(`(?m)^@@ [^@]* @@.*$`)
+	rgxDiffIndexLine       = regexp.MustCompile(`(?m)^index \S+.*\n`)
+)
+
+// RangeDiff matches the fork commits ported in the previous and in the new
+// sync branches through the metadata footers written during a sync, and
+// reports how each of them changed. Both branches must be available locally.
+func RangeDiff(git utils.GitHelper, previousBranch, newBranch string) (*RangeDiffReport, error) {
+	prevPorts, err := listSyncPorts(git, previousBranch)
+	if err != nil {
+		return nil, err
+	}
+	newPorts, err := listSyncPorts(git, newBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RangeDiffReport{PreviousBranch: previousBranch, NewBranch: newBranch}
+	prevBySHA := make(map[string]*syncPort)
+	for _, p := range prevPorts {
+		prevBySHA[p.ForkSHA] = p
+	}
+	matched := make(map[string]bool)
+	for _, p := range newPorts {
+		entry := &RangeDiffEntry{Status: RangeDiffNew, ForkSHA: p.ForkSHA, ForkURL: p.ForkURL, Title: p.Title, NewSHA: p.SHA}
+		if prev, ok := prevBySHA[p.ForkSHA]; ok {
+			matched[p.ForkSHA] = true
+			entry.PreviousSHA = prev.SHA
+			entry.Status = RangeDiffUnchanged
+			same, err := samePortedChanges(git, prev.SHA, p.SHA)
+			if err != nil {
+				return nil, err
+			}
+			if !same {
+				entry.Status = RangeDiffModified
+				entry.Interdiff, err = portInterdiff(git, prev.SHA, p.SHA)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if p.Recovered {
+			entry.Status = RangeDiffConflictResolved
+		}
+		res.Entries = append(res.Entries, entry)
+	}
+	for _, p := range prevPorts {
+		if !matched[p.ForkSHA] {
+			res.Entries = append(res.Entries, &RangeDiffEntry{Status: RangeDiffDropped, ForkSHA: p.ForkSHA, ForkURL: p.ForkURL, Title: p.Title, PreviousSHA: p.SHA})
+		}
+	}
+	return res, nil
+}
+
+// returns all the fork commits ported in the given sync branch, in order of
+// application. Commits squashed together are reported once for each of the
+// fork commits they contain.
+func listSyncPorts(git utils.GitHelper, branch string) ([]*syncPort, error) {
+	out, err := git.DoOutput("log", "--reverse", "--no-color", "--format=%H%x1f%B%x1e",
+		"--grep=^"+SyncCommitBodyHeader+": porting of ", branch)
+	if err != nil {
+		return nil, fmt.Errorf("can't list commits of sync branch '%s': %s", branch, out)
+	}
+	return parseSyncPorts(out), nil
+}
+
+// parses the output of listSyncPorts, in which each commit is terminated by
+// the record separator and its SHA is followed by the unit separator
+func parseSyncPorts(out string) []*syncPort {
+	var res []*syncPort
+	for _, record := range strings.Split(out, "\x1e") {
+		sha, msg, ok := strings.Cut(strings.TrimSpace(record), "\x1f")
+		if !ok {
+			continue
+		}
+		// note: the automatic conflict resolution footer refers to the
+		// first ported commit unless a SHA is specified, which happens
+		// for the commits squashed into it
+		recovered := make(map[string]bool)
+		for _, m := range rgxSyncRecoveredFooter.FindAllStringSubmatch(msg, -1) {
+			recovered[m[1]] = true
+		}
+		title := strings.Split(msg, "\n")[0]
+		for i, m := range rgxSyncPortingFooter.FindAllStringSubmatch(msg, -1) {
+			res = append(res, &syncPort{
+				ForkSHA:   m[1],
+				ForkURL:   m[2],
+				SHA:       sha,
+				Title:     title,
+				Recovered: recovered[m[1]] || (i == 0 && recovered[""]),
+			})
+		}
+	}
+	return res
+}
+
+// returns true if the two given commits apply the same changes, regardless
+// of the line numbers and of the blobs they apply to, like `git patch-id`.
+// Hunk headers are ignored entirely, as they also contain the line preceding
+// the hunk, which changes with the surrounding upstream code.
+func samePortedChanges(git utils.GitHelper, prevSHA, newSHA string) (bool, error) {
+	var diffs []string
+	for _, sha := range []string{prevSHA, newSHA} {
+		out, err := git.DoOutput("show", "--format=", "--no-color", sha)
+		if err != nil {
+			return false, fmt.Errorf("can't retrieve changes of commit %s: %s", sha, out)
+		}
+		diffs = append(diffs, rgxDiffHunkHeader.ReplaceAllString(rgxDiffIndexLine.ReplaceAllString(out, ""), "@@"))
+	}
+	return diffs[0] == diffs[1], nil
+}
+
+// returns the `git range-diff` of the two given commits, without the
+// header line summarizing the match
+func portInterdiff(git utils.GitHelper, prevSHA, newSHA string) (string, error) {
+	// note: the creation factor forces pairing the commits, which would
+	// otherwise be reported as unrelated if their changes differ too much
+	out, err := git.DoOutput("range-diff", "--no-color", "--creation-factor=100", prevSHA+"^!", newSHA+"^!")
+	if err != nil {
+		return "", fmt.Errorf("can't compute range-diff of commits %s and %s: %s", prevSHA, newSHA, out)
+	}
+	_, res, _ := strings.Cut(out, "\n")
+	return res, nil
+}
+
+// counts the entries having the given status
+func (r *RangeDiffReport) count(s RangeDiffStatus) int {
+	res := 0
+	for _, e := range r.Entries {
+		if e.Status == s {
+			res++
+		}
+	}
+	return res
+}
+
+func (r *RangeDiffReport) summary() string {
+	var counts []string
+	for _, s := range []RangeDiffStatus{RangeDiffUnchanged, RangeDiffModified, RangeDiffConflictResolved, RangeDiffNew, RangeDiffDropped} {
+		counts = append(counts, fmt.Sprintf("%d %s", r.count(s), s))
+	}
+	return strings.Join(counts, ", ")
+}
+
+// WriteText writes the report in a terminal-friendly form, in the
+// style of `git range-diff`
+func (r *RangeDiffReport) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "range-diff of sync branch '%s' against '%s': %s\n", r.NewBranch, r.PreviousBranch, r.summary())
+	for _, e := range r.Entries {
+		fmt.Fprintf(w, "%-17s %s %s -> %s # %s\n", e.Status, shortRangeDiffSHA(e.ForkSHA), shortRangeDiffSHA(e.PreviousSHA), shortRangeDiffSHA(e.NewSHA), e.Title)
+		if len(e.Interdiff) > 0 {
+			for _, l := range strings.Split(e.Interdiff, "\n") {
+				fmt.Fprintf(w, "    %s\n", l)
+			}
+		}
+	}
+}
+
+// WriteMarkdown writes the report in markdown, suitable for the body of
+// a pull request
+func (r *RangeDiffReport) WriteMarkdown(w io.Writer) {
+	fmt.Fprintf(w, "# Sync Range-Diff\n\n")
+	fmt.Fprintf(w, "Sync branch `%s` against `%s`: %s.\n\n", r.NewBranch, r.PreviousBranch, r.summary())
+	fmt.Fprintf(w, "| Status | Commit | Title | Previous | New |\n")
+	fmt.Fprintf(w, "|--------|--------|-------|----------|-----|\n")
+	for _, e := range r.Entries {
+		fmt.Fprintf(w, "| `%s` | [%s](%s) | %s | %s | %s |\n", e.Status, shortRangeDiffSHA(e.ForkSHA), e.ForkURL,
+			strings.ReplaceAll(e.Title, "|", "\\|"), shortRangeDiffSHA(e.PreviousSHA), shortRangeDiffSHA(e.NewSHA))
+	}
+	for _, e := range r.Entries {
+		if len(e.Interdiff) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n<details>\n<summary>%s %s</summary>\n\n```diff\n%s\n```\n\n</details>\n", shortRangeDiffSHA(e.ForkSHA), e.Title, e.Interdiff)
+	}
+}
+
+// returns the abbreviated form of a SHA in the reports, with a placeholder
+// for the commits missing in one of the sync branches
+func shortRangeDiffSHA(sha string) string {
+	if len(sha) == 0 {
+		return "-"
+	}
+	return ShortSHA(sha)
+}
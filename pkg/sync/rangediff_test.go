@@ -0,0 +1,73 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangeDiff(t *testing.T) {
+	t.Run("parse-ports", func(t *testing.T) {
+		out := "1111\x1ffix: a\n\nSYNCHRO: porting of aaaaaaaa (https://x/commit/aaaaaaaa)\nSYNCHRO: porting of bbbbbbbb (https://x/commit/bbbbbbbb)\n" +
+			"SYNCHRO: solved merge conflicts automatically in bbbbbbbb\x1e\n" +
+			"2222\x1ffix: c\n\nSYNCHRO: porting of cccccccc (https://x/commit/cccccccc)\nSYNCHRO: solved merge conflicts automatically\x1e"
+		ports := parseSyncPorts(out)
+		require.Len(t, ports, 3)
+		assert.Equal(t, &syncPort{ForkSHA: "aaaaaaaa", ForkURL: "https://x/commit/aaaaaaaa", SHA: "1111", Title: "fix: a"}, ports[0])
+		assert.Equal(t, "bbbbbbbb", ports[1].ForkSHA)
+		assert.Equal(t, "1111", ports[1].SHA)
+		assert.True(t, ports[1].Recovered)
+		assert.Equal(t, "2222", ports[2].SHA)
+		assert.True(t, ports[2].Recovered)
+	})
+
+	t.Run("repository", func(t *testing.T) {
+		port := func(title, sha string) string {
+			return title + "\n\n" + SyncCommitBodyHeader + ": porting of " + sha + " (https://x/commit/" + sha + ")"
+		}
+		forkA, forkB := strings.Repeat("a", 40), strings.Repeat("b", 40)
+		forkC, forkD := strings.Repeat("c", 40), strings.Repeat("d", 40)
+
+		f := newGitFixture(t)
+		f.commit("initial commit", map[string]string{"a.txt": "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"})
+		f.run("checkout", "-q", "-b", "prev")
+		prevA := f.commit(port("fix: a", forkA), map[string]string{"a.txt": "1\n2\n3\n4\n5\n6\n7\n8\n9\nten\n"})
+		prevB := f.commit(port("fix: b", forkB), map[string]string{"b.txt": "b\n"})
+		prevC := f.commit(port("fix: c", forkC), map[string]string{"c.txt": "c\n"})
+
+		// the new sync branch is on top of a newer upstream, so that the
+		// unchanged commit is ported with different blobs
+		f.run("checkout", "-q", "main")
+		f.commit("fix: upstream", map[string]string{"a.txt": "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"})
+		f.run("checkout", "-q", "-b", "new")
+		newA := f.commit(port("fix: a", forkA), map[string]string{"a.txt": "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n"})
+		newB := f.commit(port("fix: b", forkB), map[string]string{"b.txt": "b changed\n"})
+		newD := f.commit(port("fix: d", forkD), map[string]string{"d.txt": "d\n"})
+
+		report, err := RangeDiff(f.git, "prev", "new")
+		require.NoError(t, err)
+		require.Len(t, report.Entries, 4)
+		assert.Equal(t, &RangeDiffEntry{Status: RangeDiffUnchanged, ForkSHA: forkA, ForkURL: "https://x/commit/" + forkA, Title: "fix: a", PreviousSHA: prevA, NewSHA: newA}, report.Entries[0])
+		assert.Equal(t, RangeDiffModified, report.Entries[1].Status)
+		assert.Equal(t, prevB, report.Entries[1].PreviousSHA)
+		assert.Equal(t, newB, report.Entries[1].NewSHA)
+		assert.Contains(t, report.Entries[1].Interdiff, "b changed")
+		assert.Equal(t, &RangeDiffEntry{Status: RangeDiffNew, ForkSHA: forkD, ForkURL: "https://x/commit/" + forkD, Title: "fix: d", NewSHA: newD}, report.Entries[2])
+		assert.Equal(t, &RangeDiffEntry{Status: RangeDiffDropped, ForkSHA: forkC, ForkURL: "https://x/commit/" + forkC, Title: "fix: c", PreviousSHA: prevC}, report.Entries[3])
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		report := &RangeDiffReport{PreviousBranch: "prev", NewBranch: "new", Entries: []*RangeDiffEntry{
+			{Status: RangeDiffModified, ForkSHA: "aaaaaaaa", ForkURL: "https://x/commit/aaaaaaaa", Title: "fix: a|b", PreviousSHA: "1111", NewSHA: "2222", Interdiff: "-a\n+b"},
+			{Status: RangeDiffDropped, ForkSHA: "bbbbbbbb", ForkURL: "https://x/commit/bbbbbbbb", Title: "fix: c", PreviousSHA: "3333"},
+		}}
+		var b strings.Builder
+		report.WriteMarkdown(&b)
+		assert.Contains(t, b.String(), "0 unchanged, 1 modified, 0 conflict-resolved, 0 new, 1 dropped")
+		assert.Contains(t, b.String(), "| `modified` | [aaaaaaaa](https://x/commit/aaaaaaaa) | fix: a\\|b | 1111 | 2222 |\n")
+		assert.Contains(t, b.String(), "| `dropped` | [bbbbbbbb](https://x/commit/bbbbbbbb) | fix: c | 3333 | - |\n")
+		assert.Contains(t, b.String(), "```diff\n-a\n+b\n```")
+	})
+}
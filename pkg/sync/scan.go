@@ -6,78 +6,196 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	gosync "sync"
 
 	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
 	"github.com/jasondellaluce/synchro/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
+// scanResult is the outcome of a fork scan
+type scanResult struct {
+	// Picked are the commits present in the fork exclusively in the form
+	// of private patches, in the order in which they should be applied
+	Picked []*commitInfo
+	// Skipped are the commits excluded from the sync, in chronological order
+	// except for the ones excluded by their version range markers, which
+	// are evaluated after the scan and come last
+	Skipped []*commitInfo
+}
+
 // Scan analyzes both the upstream and the fork repositories specified in the given
 // scan request, and returns a list of commit info representing the restricted
 // set of commits that are present in the fork exclusively in the form of
-// private patches. Returns a non-nil error in case of failure.
-func scan(ctx context.Context, client *github.Client, req *Request) ([]*commitInfo, error) {
+// private patches, along with the ones that have been excluded.
+// Returns a non-nil error in case of failure.
+func scan(ctx context.Context, p provider.Provider, req *Request) (*scanResult, error) {
 	logrus.Infof("initiating fork scan for repository %s/%s with upstream %s/%s", req.ForkOrg, req.ForkRepo, req.UpstreamOrg, req.UpstreamRepo)
 	defer logrus.Infof("finished fork scan for repository %s/%s with upstream %s/%s", req.ForkOrg, req.ForkRepo, req.UpstreamOrg, req.UpstreamRepo)
 
-	// iterate through the commits of the fork
-	var result []*commitInfo
-	err := utils.ConsumeSequence(iterateCommitsByHead(ctx, client, req.ForkOrg, req.ForkRepo, req.ForkHeadRef),
-		func(c *github.RepositoryCommit) error {
-			info, err := scanRepoCommit(ctx, client, req, c)
-			if err == nil {
-				if info != nil {
-					upstreamPRs := info.pullRequestsOfRepo(req.UpstreamOrg, req.UpstreamRepo)
-					if len(info.PullRequests) == 1 && len(upstreamPRs) == 1 && upstreamPRs[0].MergedAt != nil {
-						logrus.Debugf("commit is only part of a upstream repo PR, stopping")
-						return utils.ErrSeqBreakout
-					}
-					result = append(result, info)
-				}
-			}
-			return err
-		})
-	if err != nil && err != utils.ErrSeqBreakout {
+	concurrency := req.ScanConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// the commits of the fork are scanned concurrently by a bounded pool of
+	// workers, and the results are then consumed in order, so that we can stop
+	// at the first commit that is only part of an upstream PR.
+	// note: the commits dispatched past the stop point are scanned for
+	// nothing, which is the price we pay for concurrency. Their failures are
+	// ignored, as the sequential scan would have never seen them
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var workers gosync.WaitGroup
+	jobs := scanRepoCommits(ctx, &workers, p, req, newTrustCache(), concurrency)
+	result, err := collectScanJobs(p, req, jobs)
+	cancel()
+	workers.Wait()
+	if err != nil {
 		return nil, err
 	}
-	utils.ReverseSlice(result)
+	result.reverse()
 	return result, nil
 }
 
-// performs the scan process for the given commit
-func scanRepoCommit(ctx context.Context, client *github.Client, req *Request, c *github.RepositoryCommit) (*commitInfo, error) {
+// consumes the given scan jobs in order, and returns the scan result. The
+// consumption stops either at a commit that is only part of an upstream PR,
+// or at the first job failing, whose error is returned.
+func collectScanJobs(p provider.Provider, req *Request, jobs <-chan *scanJob) (*scanResult, error) {
+	result := &scanResult{}
+	for job := range jobs {
+		<-job.done
+		if job.err != nil {
+			return nil, job.err
+		}
+		info := job.info
+		if info.Skip != nil {
+			result.Skipped = append(result.Skipped, info)
+			continue
+		}
+		upstreamPRs := info.pullRequestsOfRepo(req.UpstreamOrg, req.UpstreamRepo)
+		if len(info.PullRequests) == 1 && len(upstreamPRs) == 1 && upstreamPRs[0].MergedAt != nil {
+			logrus.Debugf("commit is only part of a upstream repo PR, stopping")
+			info.Skip = &commitSkip{
+				Reason:   SkipReasonUpstreamPullRequest,
+				Evidence: fmt.Sprintf("only part of upstream pull request #%d, scan stopped here", upstreamPRs[0].GetNumber()),
+				URL:      pullRequestURL(p.Links(), req.UpstreamOrg, req.UpstreamRepo, upstreamPRs[0]),
+			}
+			result.Skipped = append(result.Skipped, info)
+			return result, nil
+		}
+		result.Picked = append(result.Picked, info)
+	}
+	return result, nil
+}
+
+// reverses the order of the results, for turning the iteration order of
+// the fork's history (most recent first) into the chronological one
+func (s *scanResult) reverse() {
+	utils.ReverseSlice(s.Picked)
+	utils.ReverseSlice(s.Skipped)
+}
+
+// scanJob is the scan of a single commit, which is done once its done
+// channel is closed
+type scanJob struct {
+	info *commitInfo
+	err  error
+	done chan struct{}
+}
+
+// dispatches the scan of each commit of the fork to a pool of at most the
+// given number of concurrent workers, all tracked by the given wait group,
+// and returns the scan jobs in the order of the fork's history. A failure in
+// listing the fork commits is reported as a failed job. Dispatching stops once
+// the given context is done, which is up to the consumer of the jobs, as the
+// failure of a single job doesn't affect the other ones.
+func scanRepoCommits(ctx context.Context, workers *gosync.WaitGroup, p provider.Provider, req *Request, trust *trustCache, concurrency int) <-chan *scanJob {
+	jobs := make(chan *scanJob, concurrency)
+	sem := make(chan struct{}, concurrency)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		defer close(jobs)
+		commits := p.ListCommits(ctx, req.ForkOrg, req.ForkRepo, req.ForkHeadRef)
+		for {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			c := commits.Next()
+			job := &scanJob{done: make(chan struct{})}
+			if c == nil {
+				// a listing failure is consumed in order, like a failed scan
+				if job.err = commits.Error(); job.err != nil {
+					close(job.done)
+					select {
+					case jobs <- job:
+					case <-ctx.Done():
+					}
+				}
+				return
+			}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				defer func() { <-sem }()
+				defer close(job.done)
+				job.info, job.err = scanRepoCommit(ctx, p, req, trust, c)
+			}()
+		}
+	}()
+	return jobs
+}
+
+// performs the scan process for the given commit. If the commit should not be
+// picked, the returned info has a non-empty skip reason
+func scanRepoCommit(ctx context.Context, p provider.Provider, req *Request, trust *trustCache, c *github.RepositoryCommit) (*commitInfo, error) {
 	res := &commitInfo{Commit: c}
 	logrus.Infof("scanning commit %s %s", res.SHA(), res.Title())
 
 	logrus.Debugf("listing pull requests in fork repository %s/%s", req.ForkOrg, req.ForkRepo)
-	pulls, err := utils.CollectSequence(iteratePullRequestsByCommitSHA(ctx, client, req.ForkOrg, req.ForkRepo, res.SHA()))
+	pulls, err := utils.CollectSequence(iteratePullRequestsByCommitSHA(ctx, p, req.ForkOrg, req.ForkRepo, res.SHA()))
 	if err != nil {
 		return nil, err
 	}
 	res.PullRequests = pulls
 
 	logrus.Debugf("listing pull requests in upstream repository %s/%s", req.UpstreamOrg, req.UpstreamRepo)
-	pulls, err = utils.CollectSequence(iteratePullRequestsByCommitSHA(ctx, client, req.UpstreamOrg, req.UpstreamRepo, res.SHA()))
+	pulls, err = utils.CollectSequence(iteratePullRequestsByCommitSHA(ctx, p, req.UpstreamOrg, req.UpstreamRepo, res.SHA()))
 	if err != nil {
 		logrus.Debugf("commit probably not found in upstream repo, purposely ignoring error: %s", err.Error())
 	} else {
 		res.PullRequests = append(res.PullRequests, pulls...)
 	}
 
-	ref, err := searchForkCommitRef(ctx, client, req, res)
+	ref, err := searchForkCommitRef(ctx, p, req, res)
 	if err != nil {
 		return nil, err
 	}
 	if ref != 0 {
 		logrus.Debugf("checking ref pull request %s/%s#%d", req.UpstreamOrg, req.UpstreamRepo, ref)
-		pr, _, err := client.PullRequests.Get(ctx, req.UpstreamOrg, req.UpstreamRepo, ref)
+		pr, err := p.GetPullRequest(ctx, req.UpstreamOrg, req.UpstreamRepo, ref)
 		if err != nil {
 			return nil, err
 		}
 
+		res.UpstreamRef = pr
 		if pr.MergedAt != nil {
 			logrus.Infof("refed pull request is MERGED, skipping commit")
-			return nil, nil
+			res.Skip = &commitSkip{
+				Reason:   SkipReasonMergedUpstreamRef,
+				Evidence: fmt.Sprintf("referenced upstream pull request #%d is merged", ref),
+				URL:      pullRequestURL(p.Links(), req.UpstreamOrg, req.UpstreamRepo, pr),
+			}
+			return res, nil
 		} else if strings.ToLower(pr.GetState()) == "closed" {
 			logrus.Infof("refed pull request is CLOSED, picking commit")
 		} else {
@@ -88,13 +206,19 @@ func scanRepoCommit(ctx context.Context, client *github.Client, req *Request, c
 	}
 
 	logrus.Debugf("commit is being picked, checking if we should ignore it")
-	err = searchCommitMarkers(ctx, client, req, res)
+	if skip := policyIgnoreSkip(req, res); skip != nil {
+		logrus.Infof("commit ignored by sync policy, skipping commit")
+		res.Skip = skip
+		return res, nil
+	}
+	err = searchCommitMarkers(ctx, p, req, trust, res)
 	if err != nil {
 		return nil, err
 	}
 	if res.HasMarker(CommitMarkerIgnore) {
 		logrus.Infof("deteted ignore marker %s, skipping commit", CommitMarkerIgnore)
-		return nil, nil
+		res.Skip = ignoreMarkerSkip(res)
+		return res, nil
 	}
 
 	if ref == 0 && len(res.PullRequests) == 0 {
@@ -106,28 +230,12 @@ func scanRepoCommit(ctx context.Context, client *github.Client, req *Request, c
 
 // returns a sequence containing all pull requests containing a given commit
 // SHA for a specific repository.
-func iteratePullRequestsByCommitSHA(ctx context.Context, client *github.Client, org, repo, sha string) utils.Sequence[github.PullRequest] {
-	it := utils.NewGithubSequence(
-		func(o *github.ListOptions) ([]*github.PullRequest, *github.Response, error) {
-			return client.PullRequests.ListPullRequestsWithCommit(ctx, org, repo, sha, o)
-		})
-	return utils.NewFilteredSequence(it, func(pr *github.PullRequest) bool {
+func iteratePullRequestsByCommitSHA(ctx context.Context, p provider.Provider, org, repo, sha string) utils.Sequence[github.PullRequest] {
+	return utils.NewFilteredSequence(p.ListPullRequestsWithCommit(ctx, org, repo, sha), func(pr *github.PullRequest) bool {
 		return pr.MergedAt != nil
 	})
 }
 
-// returns a sequence containing all commits for a specific repository, starting
-// from the given head ref and proceeding from the most to the least recent.
-func iterateCommitsByHead(ctx context.Context, client *github.Client, org, repo, headRef string) utils.Sequence[github.RepositoryCommit] {
-	return utils.NewGithubSequence(
-		func(o *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
-			return client.Repositories.ListCommits(ctx, org, repo, &github.CommitsListOptions{
-				SHA:         headRef,
-				ListOptions: *o,
-			})
-		})
-}
-
 // returns true if the list of references found for a given commit is ambiguous
 // with regards to the scanning process.
 func commitRefsAreAmbiguos(refs []int) bool {
@@ -144,12 +252,12 @@ func commitRefsAreAmbiguos(refs []int) bool {
 // searches inside a text for pull request references of the given org and repo.
 // Returns a list of non-zero numbers representing the pull request numbers
 // found in the references. Returns a non-nil error in case of failure.
-func searchPullRequestRefs(org, repo, text string) ([]int, error) {
+func searchPullRequestRefs(links *provider.Links, org, repo, text string) ([]int, error) {
 	var res []int
 
 	var pullRequestRefInTextStyles = []*regexp.Regexp{
 		regexp.MustCompile(fmt.Sprintf(`%s/%s#(\d+)`, org, repo)),
-		regexp.MustCompile(fmt.Sprintf(`github.com/%s/%s/pull/(\d+)`, org, repo)),
+		regexp.MustCompile(regexp.QuoteMeta(links.PullRequestPrefix(org, repo)) + `(\d+)`),
 		regexp.MustCompile(fmt.Sprintf(`\[%s#(\d+)\]`, org)),
 	}
 
@@ -170,16 +278,16 @@ func searchPullRequestRefs(org, repo, text string) ([]int, error) {
 }
 
 // returns the pull request number relative to the upstream repo
-func searchForkCommitRef(ctx context.Context, client *github.Client, req *Request, c *commitInfo) (int, error) {
+func searchForkCommitRef(ctx context.Context, p provider.Provider, req *Request, c *commitInfo) (int, error) {
 	// search in pull request body
 	for _, pr := range c.pullRequestsOfRepo(req.ForkOrg, req.ForkRepo) {
-		refs, err := searchPullRequestRefs(req.UpstreamOrg, req.UpstreamRepo, pr.GetBody())
+		refs, err := searchPullRequestRefs(p.Links(), req.UpstreamOrg, req.UpstreamRepo, pr.GetBody())
 		if err != nil {
 			return 0, err
 		}
 		if len(refs) > 0 {
 			if commitRefsAreAmbiguos(refs) {
-				url := fmt.Sprintf("https://github.com/%s/%s/pull/%d", req.ForkOrg, req.ForkRepo, pr.GetNumber())
+				url := p.Links().PullRequest(req.ForkOrg, req.ForkRepo, pr.GetNumber())
 				logrus.Warnf("pull requests body contains multiple upstream repo refs and may be ambiguous: %s", url)
 			}
 			logrus.Infof("found ref in pull request body #%d", pr.GetNumber())
@@ -189,13 +297,13 @@ func searchForkCommitRef(ctx context.Context, client *github.Client, req *Reques
 
 	// search in commit message
 	// note(mrgian): we don't need to search in commit messages for now
-	/*refs, err := searchPullRequestRefs(req.UpstreamOrg, req.UpstreamRepo, c.Message())
+	/*refs, err := searchPullRequestRefs(p.Links(), req.UpstreamOrg, req.UpstreamRepo, c.Message())
 	if err != nil {
 		return 0, err
 	}
 	if len(refs) > 0 {
 		if commitRefsAreAmbiguos(refs) {
-			url := fmt.Sprintf("https://github.com/%s/%s/commit/%s", req.ForkOrg, req.ForkRepo, c.SHA())
+			url := p.Links().Commit(req.ForkOrg, req.ForkRepo, c.SHA())
 			logrus.Warnf("commit message contains multiple upstream repo refs and may be ambiguous: %s", url)
 		}
 		logrus.Infof("found ref in commit message of %s", c.SHA())
@@ -203,18 +311,18 @@ func searchForkCommitRef(ctx context.Context, client *github.Client, req *Reques
 	}*/
 
 	// search in commit comments
-	comments, err := c.getComments(ctx, client, req.ForkOrg, req.ForkRepo)
+	comments, err := c.getComments(ctx, p, req.ForkOrg, req.ForkRepo)
 	if err != nil {
 		return 0, err
 	}
 	for _, comment := range comments {
-		refs, err := searchPullRequestRefs(req.UpstreamOrg, req.UpstreamRepo, comment.GetBody())
+		refs, err := searchPullRequestRefs(p.Links(), req.UpstreamOrg, req.UpstreamRepo, comment.GetBody())
 		if err != nil {
 			return 0, err
 		}
 		if len(refs) > 0 {
 			if commitRefsAreAmbiguos(refs) {
-				url := fmt.Sprintf("https://github.com/%s/%s/commit/%s", req.ForkOrg, req.ForkRepo, c.SHA())
+				url := p.Links().Commit(req.ForkOrg, req.ForkRepo, c.SHA())
 				logrus.Warnf("commit comment contains multiple upstream repo refs and may be ambiguous: %s", url)
 			}
 			logrus.Infof("found ref in one comment body of %s", c.SHA())
@@ -225,28 +333,143 @@ func searchForkCommitRef(ctx context.Context, client *github.Client, req *Reques
 	return 0, nil
 }
 
-// returns true if the commit should be ignored for the given scan request
-func searchCommitMarkers(ctx context.Context, client *github.Client, req *Request, c *commitInfo) error {
-	c.Markers = make(map[string]bool)
-
+// searches for markers in the message and in the comments of the given
+// commit. The markers of comments are honored only if their author is
+// trusted as required by the scan request.
+func searchCommitMarkers(ctx context.Context, p provider.Provider, req *Request, trust *trustCache, c *commitInfo) error {
 	// search in commit's message
-	for _, m := range AllCommitMarkers {
-		if strings.Contains(c.Message(), m.String()) {
-			c.Markers[m.String()] = true
-		}
-	}
+	searchCommitMessageMarkers(c)
 
 	// search in commit's comments
-	comments, err := c.getComments(ctx, client, req.ForkOrg, req.ForkRepo)
+	comments, err := c.getComments(ctx, p, req.ForkOrg, req.ForkRepo)
 	if err != nil {
 		return err
 	}
 	for _, comment := range comments {
-		for _, m := range AllCommitMarkers {
-			if strings.Contains(comment.GetBody(), m.String()) {
-				c.Markers[m.String()] = true
+		markers, issues := lintCommitMarkers(comment.GetBody())
+		for _, issue := range issues {
+			logrus.Warnf("commit %s has a marker issue in comment %s, %s", c.ShortSHA(), comment.GetHTMLURL(), issue)
+		}
+		if len(markers) == 0 {
+			continue
+		}
+		author := comment.GetUser().GetLogin()
+		trusted, err := trust.isCommentTrusted(ctx, p, req, author)
+		if err != nil {
+			return err
+		}
+		if !trusted {
+			logrus.Warnf("commit %s has markers in comment %s, ignoring them as author '%s' is not trusted", c.ShortSHA(), comment.GetHTMLURL(), author)
+			continue
+		}
+		for m, globs := range markers {
+			logrus.Infof("commit %s has marker %s activated by comment %s of '%s'", c.ShortSHA(), m, comment.GetHTMLURL(), author)
+			c.Markers[m] = append(c.Markers[m], globs...)
+			if _, ok := c.markerSources[m]; !ok {
+				c.markerSources[m] = comment.GetHTMLURL()
+				c.markerAuthors[m] = author
 			}
 		}
 	}
 	return nil
 }
+
+// trustCache remembers which comment authors are trusted during a scan, so
+// that their permission and team membership are checked only once
+type trustCache struct {
+	mu      gosync.Mutex
+	trusted map[string]bool
+}
+
+func newTrustCache() *trustCache {
+	return &trustCache{trusted: make(map[string]bool)}
+}
+
+// returns true if the markers in the comments of the given user can be
+// honored as required by the scan request, caching the outcome
+func (t *trustCache) isCommentTrusted(ctx context.Context, p provider.Provider, req *Request, user string) (bool, error) {
+	t.mu.Lock()
+	trusted, ok := t.trusted[user]
+	t.mu.Unlock()
+	if ok {
+		return trusted, nil
+	}
+	trusted, err := isCommentTrusted(ctx, p, req, user)
+	if err != nil {
+		return false, err
+	}
+	t.mu.Lock()
+	t.trusted[user] = trusted
+	t.mu.Unlock()
+	return trusted, nil
+}
+
+// returns true if the markers in the comments of the given user can be
+// honored as required by the scan request
+func isCommentTrusted(ctx context.Context, p provider.Provider, req *Request, user string) (bool, error) {
+	if len(req.TrustedCommentPermission) == 0 && len(req.TrustedCommentTeams) == 0 {
+		return true, nil
+	}
+	if len(user) == 0 {
+		return false, nil
+	}
+	if len(req.TrustedCommentPermission) > 0 {
+		perm, err := p.GetUserPermission(ctx, req.ForkOrg, req.ForkRepo, user)
+		if err != nil {
+			return false, err
+		}
+		if provider.PermissionAtLeast(perm, req.TrustedCommentPermission) {
+			return true, nil
+		}
+		logrus.Debugf("user '%s' has permission '%s' on %s/%s", user, perm, req.ForkOrg, req.ForkRepo)
+	}
+	for _, team := range req.TrustedCommentTeams {
+		member, err := p.IsTeamMember(ctx, req.ForkOrg, team, user)
+		if err != nil {
+			return false, err
+		}
+		if member {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// searches for markers in the message of the given commit only
+func searchCommitMessageMarkers(c *commitInfo) {
+	markers, issues := lintCommitMarkers(c.Message())
+	for _, issue := range issues {
+		logrus.Warnf("commit %s has a marker issue in its message, %s", c.ShortSHA(), issue)
+	}
+	c.Markers = markers
+	c.markerSources = make(map[string]string)
+	c.markerAuthors = make(map[string]string)
+	for m := range c.Markers {
+		logrus.Infof("commit %s has marker %s in its message", c.ShortSHA(), m)
+		c.markerSources[m] = ""
+	}
+}
+
+// returns the skip info of a commit annotated with the ignore marker
+func ignoreMarkerSkip(c *commitInfo) *commitSkip {
+	url := c.markerSources[CommitMarkerIgnore.String()]
+	if len(url) > 0 {
+		return &commitSkip{
+			Reason:   SkipReasonIgnoreMarker,
+			Evidence: fmt.Sprintf("%s found in a commit comment of '%s'", CommitMarkerIgnore, c.markerAuthors[CommitMarkerIgnore.String()]),
+			URL:      url,
+		}
+	}
+	return &commitSkip{
+		Reason:   SkipReasonIgnoreMarker,
+		Evidence: fmt.Sprintf("%s found in the commit message", CommitMarkerIgnore),
+	}
+}
+
+// returns the web URL of a pull request
+func pullRequestURL(links *provider.Links, org, repo string, pr *github.PullRequest) string {
+	if len(pr.GetHTMLURL()) > 0 {
+		return pr.GetHTMLURL()
+	}
+	return links.PullRequest(org, repo, pr.GetNumber())
+}
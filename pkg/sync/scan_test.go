@@ -0,0 +1,229 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeScanProvider serves a fixed list of fork commits, in which each commit
+// is part of a merged fork PR except for the ones listed in upstreamOnly,
+// which are only part of a merged upstream PR
+type fakeScanProvider struct {
+	provider.Provider
+	commits      []*github.RepositoryCommit
+	upstreamOnly map[string]bool
+}
+
+func sliceGithubSequence[T interface{}](values []*T) utils.Sequence[T] {
+	return utils.NewGithubSequence(context.Background(), func(o *github.ListOptions) ([]*T, *github.Response, error) {
+		if o.Page > 1 {
+			return nil, nil, nil
+		}
+		return values, nil, nil
+	})
+}
+
+func (f *fakeScanProvider) Links() *provider.Links {
+	return &provider.Links{BaseURL: "https://github.com", PullRequestPath: "pull", CommitPath: "commit"}
+}
+
+func (f *fakeScanProvider) ListCommits(ctx context.Context, org, repo, headRef string) utils.Sequence[github.RepositoryCommit] {
+	return sliceGithubSequence(f.commits)
+}
+
+func (f *fakeScanProvider) ListPullRequestsWithCommit(ctx context.Context, org, repo, sha string) utils.Sequence[github.PullRequest] {
+	if (org == "upstream") != f.upstreamOnly[sha] {
+		return sliceGithubSequence[github.PullRequest](nil)
+	}
+	return sliceGithubSequence([]*github.PullRequest{{
+		Number:   github.Int(1),
+		MergedAt: &github.Timestamp{},
+		Base:     &github.PullRequestBranch{Repo: &github.Repository{FullName: github.String(org + "/" + repo)}},
+	}})
+}
+
+func (f *fakeScanProvider) ListCommitComments(ctx context.Context, org, repo, sha string) utils.Sequence[github.RepositoryComment] {
+	return sliceGithubSequence[github.RepositoryComment](nil)
+}
+
+func TestScanConcurrency(t *testing.T) {
+	p := &fakeScanProvider{upstreamOnly: map[string]bool{}}
+	for i := 0; i < 10; i++ {
+		msg := fmt.Sprintf("commit %d", i)
+		if i == 2 {
+			msg += "\n\n" + CommitMarkerIgnore.String()
+		}
+		p.commits = append(p.commits, &github.RepositoryCommit{
+			SHA:    github.String(fmt.Sprintf("%040d", i)),
+			Commit: &github.Commit{Message: github.String(msg)},
+		})
+	}
+	p.upstreamOnly[p.commits[6].GetSHA()] = true
+
+	for _, concurrency := range []int{0, 1, 3, 4, 20} {
+		t.Run(fmt.Sprintf("concurrency-%d", concurrency), func(t *testing.T) {
+			res, err := scan(context.Background(), p, &Request{
+				UpstreamOrg:     "upstream",
+				UpstreamRepo:    "repo",
+				ForkOrg:         "fork",
+				ForkRepo:        "repo",
+				ScanConcurrency: concurrency,
+			})
+			require.NoError(t, err)
+			var titles []string
+			for _, c := range res.Picked {
+				titles = append(titles, c.Title())
+			}
+			assert.Equal(t, []string{"commit 5", "commit 4", "commit 3", "commit 1", "commit 0"}, titles)
+			titles = nil
+			for _, c := range res.Skipped {
+				titles = append(titles, c.Title())
+			}
+			assert.Equal(t, []string{"commit 6", "commit 2"}, titles)
+			assert.Equal(t, SkipReasonUpstreamPullRequest, res.Skipped[0].Skip.Reason)
+			assert.Equal(t, SkipReasonIgnoreMarker, res.Skipped[1].Skip.Reason)
+			assert.Contains(t, res.Skipped[1].Skip.Evidence, "commit message")
+		})
+	}
+}
+
+// fakeFailingScanProvider fails listing the fork pull requests of the
+// commit with the failing SHA, and counts the commits scanned. If failed is
+// not nil, it is closed at the failure, and the other commits wait for it
+type fakeFailingScanProvider struct {
+	fakeScanProvider
+	failing string
+	scanned int32
+	failed  chan struct{}
+}
+
+func (f *fakeFailingScanProvider) ListPullRequestsWithCommit(ctx context.Context, org, repo, sha string) utils.Sequence[github.PullRequest] {
+	if org == "upstream" {
+		return f.fakeScanProvider.ListPullRequestsWithCommit(ctx, org, repo, sha)
+	}
+	atomic.AddInt32(&f.scanned, 1)
+	return utils.NewGithubSequence(ctx, func(o *github.ListOptions) ([]*github.PullRequest, *github.Response, error) {
+		if sha == f.failing {
+			if f.failed != nil {
+				close(f.failed)
+			}
+			return nil, nil, fmt.Errorf("can't list pull requests of commit %s", sha)
+		}
+		if f.failed != nil {
+			// give the failure the time to cancel the other scans, if any
+			<-f.failed
+			select {
+			case <-time.After(50 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+		}
+		return nil, nil, nil
+	})
+}
+
+func TestScanFailure(t *testing.T) {
+	p := &fakeFailingScanProvider{fakeScanProvider: fakeScanProvider{upstreamOnly: map[string]bool{}}}
+	for i := 0; i < 100; i++ {
+		p.commits = append(p.commits, &github.RepositoryCommit{
+			SHA:    github.String(fmt.Sprintf("%040d", i)),
+			Commit: &github.Commit{Message: github.String(fmt.Sprintf("commit %d", i))},
+		})
+	}
+	p.failing = p.commits[3].GetSHA()
+
+	// dispatching stops at the first failure
+	_, err := scan(context.Background(), p, &Request{UpstreamOrg: "upstream", ForkOrg: "fork", ScanConcurrency: 2})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), p.failing)
+	assert.Less(t, int(atomic.LoadInt32(&p.scanned)), 10)
+}
+
+func TestScanFailurePastStop(t *testing.T) {
+	p := &fakeFailingScanProvider{
+		fakeScanProvider: fakeScanProvider{upstreamOnly: map[string]bool{}},
+		failed:           make(chan struct{}),
+	}
+	for i := 0; i < 6; i++ {
+		p.commits = append(p.commits, &github.RepositoryCommit{
+			SHA:    github.String(fmt.Sprintf("%040d", i)),
+			Commit: &github.Commit{Message: github.String(fmt.Sprintf("commit %d", i))},
+		})
+	}
+	p.upstreamOnly[p.commits[2].GetSHA()] = true
+	p.failing = p.commits[4].GetSHA()
+
+	// the commit past the stop point fails before the ones preceding it
+	// are scanned, which must not affect them
+	res, err := scan(context.Background(), p, &Request{UpstreamOrg: "upstream", UpstreamRepo: "repo", ForkOrg: "fork", ScanConcurrency: 6})
+	require.NoError(t, err)
+	require.Len(t, res.Picked, 2)
+	assert.Equal(t, "commit 1", res.Picked[0].Title())
+	assert.Equal(t, "commit 0", res.Picked[1].Title())
+	require.Len(t, res.Skipped, 1)
+	assert.Equal(t, SkipReasonUpstreamPullRequest, res.Skipped[0].Skip.Reason)
+}
+
+// fakeCommentsProvider serves commit comments, each of which is authored by
+// a user having the permission of the same name on the fork, and counts the
+// permission lookups
+type fakeCommentsProvider struct {
+	fakeScanProvider
+	comments []*github.RepositoryComment
+	teams    map[string][]string
+	lookups  int
+}
+
+func (f *fakeCommentsProvider) ListCommitComments(ctx context.Context, org, repo, sha string) utils.Sequence[github.RepositoryComment] {
+	return sliceGithubSequence(f.comments)
+}
+
+func (f *fakeCommentsProvider) GetUserPermission(ctx context.Context, org, repo, user string) (string, error) {
+	f.lookups++
+	return user, nil
+}
+
+func (f *fakeCommentsProvider) IsTeamMember(ctx context.Context, org, team, user string) (bool, error) {
+	return utils.Contains(f.teams[team], user), nil
+}
+
+func TestScanTrustedComments(t *testing.T) {
+	p := &fakeCommentsProvider{teams: map[string][]string{"release": {provider.PermissionTriage}}}
+	for _, user := range []string{provider.PermissionRead, provider.PermissionTriage, provider.PermissionMaintain} {
+		p.comments = append(p.comments, &github.RepositoryComment{
+			Body:    github.String(fmt.Sprintf("%s(%s/**)", CommitMarkerConflictSkip, user)),
+			User:    &github.User{Login: github.String(user)},
+			HTMLURL: github.String("https://github.com/fork/repo/commit/sha#comment-" + user),
+		})
+	}
+	searchWithCache := func(req *Request, trust *trustCache) []string {
+		c := &commitInfo{Commit: &github.RepositoryCommit{SHA: github.String(fmt.Sprintf("%040d", 0)), Commit: &github.Commit{}}}
+		require.NoError(t, searchCommitMarkers(context.Background(), p, req, trust, c))
+		return c.Markers[CommitMarkerConflictSkip.String()]
+	}
+	search := func(req *Request) []string {
+		return searchWithCache(req, newTrustCache())
+	}
+
+	assert.Equal(t, []string{"read/**", "triage/**", "maintain/**"}, search(&Request{}))
+	assert.Equal(t, []string{"maintain/**"}, search(&Request{TrustedCommentPermission: provider.PermissionWrite}))
+	assert.Equal(t, []string{"triage/**", "maintain/**"}, search(&Request{TrustedCommentPermission: provider.PermissionWrite, TrustedCommentTeams: []string{"release"}}))
+	assert.Empty(t, search(&Request{TrustedCommentTeams: []string{"other"}}))
+
+	// the trust of each author is checked once per scan
+	p.lookups = 0
+	req := &Request{TrustedCommentPermission: provider.PermissionWrite}
+	trust := newTrustCache()
+	assert.Equal(t, []string{"maintain/**"}, searchWithCache(req, trust))
+	assert.Equal(t, []string{"maintain/**"}, searchWithCache(req, trust))
+	assert.Equal(t, 3, p.lookups)
+}
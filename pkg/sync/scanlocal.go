@@ -0,0 +1,203 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+var rgxCherryPickedFrom = regexp.MustCompile(`\(cherry picked from commit ([a-fA-F0-9]{7,64})\)`)
+
+// gitCherryEntry is a single line of output of the `git cherry` command
+type gitCherryEntry struct {
+	SHA string
+	// Equivalent is true if a patch-id equivalent change is already
+	// present in the upstream ref
+	Equivalent bool
+}
+
+// scanLocal has the same semantics of scan, but computes the set of private
+// fork patches from the git history of the local repository instead of
+// relying on the GitHub APIs. Commits present in the fork but not in upstream
+// are considered, excluding the ones for which an equivalent change (in terms
+// of patch-id) or the original cherry-picked commit is present upstream.
+// If the request requires it, the results are enriched with the same
+// information collected by scan through the given provider.
+func scanLocal(ctx context.Context, git utils.GitHelper, p provider.Provider, req *Request) (*scanResult, error) {
+	logrus.Infof("initiating local fork scan for repository %s/%s with upstream %s/%s", req.ForkOrg, req.ForkRepo, req.UpstreamOrg, req.UpstreamRepo)
+	defer logrus.Infof("finished local fork scan for repository %s/%s with upstream %s/%s", req.ForkOrg, req.ForkRepo, req.UpstreamOrg, req.UpstreamRepo)
+
+	result := &scanResult{}
+	trust := newTrustCache()
+	err := withLocalScanRemote(git, p.Links(), req, func(remoteName string) error {
+		upstreamRef, err := utils.ResolveLocalRef(git, remoteName, req.UpstreamHeadRef)
+		if err != nil {
+			return err
+		}
+		forkRef, err := utils.ResolveLocalRef(git, "origin", req.ForkHeadRef)
+		if err != nil {
+			return err
+		}
+		base, err := git.DoOutput("merge-base", forkRef, upstreamRef)
+		if err != nil {
+			return fmt.Errorf("can't find merge base of %s and %s: %s", forkRef, upstreamRef, err.Error())
+		}
+		logrus.Debugf("found merge base %s of %s and %s", base, forkRef, upstreamRef)
+
+		out, err := git.DoOutput("cherry", upstreamRef, forkRef, base)
+		if err != nil {
+			return err
+		}
+		entries, err := parseGitCherry(out)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			c, err := getLocalCommit(git, e.SHA)
+			if err != nil {
+				return err
+			}
+			info := &commitInfo{Commit: c}
+			logrus.Infof("scanning commit %s %s", info.SHA(), info.Title())
+
+			if e.Equivalent {
+				logrus.Infof("equivalent patch found in upstream, skipping commit")
+				info.Skip = &commitSkip{
+					Reason:   SkipReasonEquivalentPatch,
+					Evidence: fmt.Sprintf("patch-id equivalent change found in %s", upstreamRef),
+				}
+				result.Skipped = append(result.Skipped, info)
+				continue
+			}
+
+			if from := searchCherryPickedFrom(info.Message()); len(from) > 0 {
+				if git.Do("merge-base", "--is-ancestor", from, upstreamRef) == nil {
+					logrus.Infof("commit cherry-picked from upstream commit %s, skipping commit", from)
+					info.Skip = &commitSkip{
+						Reason:   SkipReasonCherryPicked,
+						Evidence: fmt.Sprintf("cherry-picked from upstream commit %s", from),
+						URL:      p.Links().Commit(req.UpstreamOrg, req.UpstreamRepo, from),
+					}
+					result.Skipped = append(result.Skipped, info)
+					continue
+				}
+			}
+
+			if skip := policyIgnoreSkip(req, info); skip != nil {
+				logrus.Infof("commit ignored by sync policy, skipping commit")
+				info.Skip = skip
+				result.Skipped = append(result.Skipped, info)
+				continue
+			}
+
+			if req.LocalScanEnrich {
+				info, err = scanRepoCommit(ctx, p, req, trust, c)
+				if err != nil {
+					return err
+				}
+			} else {
+				searchCommitMessageMarkers(info)
+				if info.HasMarker(CommitMarkerIgnore) {
+					logrus.Infof("deteted ignore marker %s, skipping commit", CommitMarkerIgnore)
+					info.Skip = ignoreMarkerSkip(info)
+				}
+			}
+			if info.Skip != nil {
+				result.Skipped = append(result.Skipped, info)
+				continue
+			}
+			result.Picked = append(result.Picked, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// invokes the callback with the name of a git remote from which the upstream
+// repository is available locally. If the request specifies an existing
+// remote, it is used as is without fetching it, otherwise a temporary one is
+// added for the whole duration of the callback.
+func withLocalScanRemote(git utils.GitHelper, links *provider.Links, req *Request, f func(string) error) error {
+	if len(req.UpstreamRemote) > 0 {
+		logrus.Infof("using existing git remote '%s' for upstream", req.UpstreamRemote)
+		return f(req.UpstreamRemote)
+	}
+	remoteName, remoteURL := upstreamRemote(links, req)
+	return utils.WithTempGitRemote(git, remoteName, remoteURL, func() error {
+		return f(remoteName)
+	})
+}
+
+// parses the output of `git cherry`, in which each line is in the form
+// of `+ <sha>` or `- <sha>`
+func parseGitCherry(s string) ([]*gitCherryEntry, error) {
+	var res []*gitCherryEntry
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		l := strings.TrimSpace(scanner.Text())
+		if len(l) == 0 {
+			continue
+		}
+		tokens := strings.Fields(l)
+		if len(tokens) < 2 || (tokens[0] != "+" && tokens[0] != "-") {
+			return nil, fmt.Errorf("can't parse result of `git cherry` in line: %s", l)
+		}
+		res = append(res, &gitCherryEntry{SHA: tokens[1], Equivalent: tokens[0] == "-"})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// returns the SHA of the commit referenced by the trailer added by
+// `git cherry-pick -x` in a commit message, or an empty string otherwise
+func searchCherryPickedFrom(msg string) string {
+	matches := rgxCherryPickedFrom.FindAllStringSubmatch(msg, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	// the most recent trailer is the last one
+	return matches[len(matches)-1][1]
+}
+
+// creates a GitHub-like commit representation from the local git history
+func getLocalCommit(git utils.GitHelper, sha string) (*github.RepositoryCommit, error) {
+	const sep = "\x00"
+	out, err := git.DoOutput("show", "-s", "--format=%H%x00%an%x00%ae%x00%aI%x00%B", sha)
+	if err != nil {
+		return nil, err
+	}
+	tokens := strings.SplitN(out, sep, 5)
+	if len(tokens) != 5 {
+		return nil, fmt.Errorf("can't parse local commit info: %s", sha)
+	}
+	date, err := time.Parse(time.RFC3339, tokens[3])
+	if err != nil {
+		return nil, err
+	}
+	return &github.RepositoryCommit{
+		SHA: github.String(tokens[0]),
+		Commit: &github.Commit{
+			SHA:     github.String(tokens[0]),
+			Message: github.String(tokens[4]),
+			Author: &github.CommitAuthor{
+				Name:  github.String(tokens[1]),
+				Email: github.String(tokens[2]),
+				Date:  &github.Timestamp{Time: date},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,136 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gitFixture is a temporary git repository, which is the current working
+// directory for the whole duration of a test
+type gitFixture struct {
+	t   *testing.T
+	git utils.GitHelper
+}
+
+func newGitFixture(t *testing.T) *gitFixture {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	// isolate the repository from the configuration of the machine
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(t.TempDir(), "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "John Doe")
+	t.Setenv("GIT_AUTHOR_EMAIL", "jdoe@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "John Doe")
+	t.Setenv("GIT_COMMITTER_EMAIL", "jdoe@example.com")
+
+	f := &gitFixture{t: t, git: utils.NewGitHelper()}
+	f.run("init", "-q", "-b", "main")
+	return f
+}
+
+func (f *gitFixture) run(args ...string) string {
+	out, err := f.git.DoOutput(args...)
+	require.NoError(f.t, err, out)
+	return out
+}
+
+// writes the given files and commits all changes with the given message,
+// and returns the SHA of the new commit
+func (f *gitFixture) commit(msg string, files map[string]string) string {
+	for name, content := range files {
+		require.NoError(f.t, os.WriteFile(name, []byte(content), 0644))
+	}
+	f.run("add", "-A")
+	f.run("commit", "-q", "--allow-empty", "-m", msg)
+	return f.run("rev-parse", "HEAD")
+}
+
+func TestLocalScanParsing(t *testing.T) {
+	t.Run("git-cherry", func(t *testing.T) {
+		const sample = `
++ 4e8e272de27122583922e3f7b0d023dfd5e00626
+- 28fd30eacbc977648e217479deeb61fefc042077
+`
+		expected := []*gitCherryEntry{
+			{SHA: "4e8e272de27122583922e3f7b0d023dfd5e00626", Equivalent: false},
+			{SHA: "28fd30eacbc977648e217479deeb61fefc042077", Equivalent: true},
+		}
+		entries, err := parseGitCherry(sample)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, entries)
+
+		_, err = parseGitCherry("? 4e8e272de27122583922e3f7b0d023dfd5e00626")
+		assert.Error(t, err)
+	})
+
+	t.Run("cherry-picked-from", func(t *testing.T) {
+		msg := "fix: something\n\n(cherry picked from commit 1234567)\n(cherry picked from commit abcdef0123)\n"
+		assert.Equal(t, "abcdef0123", searchCherryPickedFrom(msg))
+		assert.Equal(t, "", searchCherryPickedFrom("fix: something"))
+	})
+}
+
+func TestLocalScan(t *testing.T) {
+	f := newGitFixture(t)
+	f.commit("initial commit", map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+
+	// the fork diverges from upstream at the initial commit
+	f.run("branch", "fork")
+	f.commit("fix: change a", map[string]string{"a.txt": "a upstream\n"})
+	fixB := f.commit("fix: change b", map[string]string{"b.txt": "b upstream\n"})
+	f.commit("new: upstream feature", map[string]string{"up.txt": "up\n"})
+
+	f.run("checkout", "-q", "fork")
+	f.commit("new: fork feature", map[string]string{"fork.txt": "fork\n"})
+	// same change of an upstream commit, applied independently
+	f.commit("chore: port a fix", map[string]string{"a.txt": "a upstream\n"})
+	// cherry-picked from upstream, but adapted so that the patch differs
+	f.run("cherry-pick", "--no-commit", fixB)
+	f.commit("fix: change b\n\n(cherry picked from commit "+fixB+")", map[string]string{"b.txt": "b upstream\nb fork\n"})
+	f.commit("chore: fork only tweak\n\n"+CommitMarkerIgnore.String(), map[string]string{"fork.txt": "fork tweak\n"})
+	f.commit("fix: fork fix", map[string]string{"fork.txt": "fork fix\n"})
+	f.run("checkout", "-q", "main")
+
+	p := &fakeScanProvider{}
+	res, err := scanLocal(context.Background(), f.git, p, &Request{
+		UpstreamOrg:     "upstream",
+		UpstreamRepo:    "repo",
+		UpstreamHeadRef: "main",
+		UpstreamRemote:  "upstream",
+		ForkOrg:         "fork",
+		ForkRepo:        "repo",
+		ForkHeadRef:     "fork",
+	})
+	require.NoError(t, err)
+
+	var picked []string
+	for _, c := range res.Picked {
+		picked = append(picked, c.Title())
+	}
+	assert.Equal(t, []string{"new: fork feature", "fix: fork fix"}, picked)
+
+	skipped := make(map[string]SkipReason)
+	for _, c := range res.Skipped {
+		skipped[c.Title()] = c.Skip.Reason
+	}
+	assert.Equal(t, map[string]SkipReason{
+		"chore: port a fix":      SkipReasonEquivalentPatch,
+		"fix: change b":          SkipReasonCherryPicked,
+		"chore: fork only tweak": SkipReasonIgnoreMarker,
+	}, skipped)
+	for _, c := range res.Skipped {
+		if c.Skip.Reason == SkipReasonCherryPicked {
+			assert.Equal(t, "https://github.com/upstream/repo/commit/"+fixB, c.Skip.URL)
+		}
+	}
+}
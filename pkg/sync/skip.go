@@ -0,0 +1,84 @@
+package sync
+
+// SkipReason is the reason for which a fork commit is excluded from a sync
+type SkipReason string
+
+const (
+	// SkipReasonMergedUpstreamRef is used when a commit references an
+	// upstream pull request that has already been merged
+	SkipReasonMergedUpstreamRef SkipReason = "merged-upstream-ref"
+
+	// SkipReasonIgnoreMarker is used when a commit is annotated with
+	// the ignore marker
+	SkipReasonIgnoreMarker SkipReason = "ignore-marker"
+
+	// SkipReasonUpstreamPullRequest is used when a commit is only part of a
+	// merged upstream pull request. This is also the point at which the scan
+	// stops, as all the older commits are expected to be part of upstream.
+	SkipReasonUpstreamPullRequest SkipReason = "upstream-pull-request"
+
+	// SkipReasonEquivalentPatch is used when a change equivalent to the one of
+	// a commit (in terms of patch-id) is already present in upstream
+	SkipReasonEquivalentPatch SkipReason = "equivalent-patch"
+
+	// SkipReasonCherryPicked is used when a commit has been cherry-picked
+	// from a commit already present in upstream
+	SkipReasonCherryPicked SkipReason = "cherry-picked"
+
+	// SkipReasonPolicy is used when a commit, or its author, is listed
+	// among the ones to be ignored in the sync policy
+	SkipReasonPolicy SkipReason = "policy"
+
+	// SkipReasonVersionRange is used when a commit is annotated with markers
+	// restricting it to a range of upstream versions not including the
+	// upstream head ref
+	SkipReasonVersionRange SkipReason = "version-range"
+)
+
+// AllSkipReasons is a collection of all the skip reasons supported
+var AllSkipReasons = []SkipReason{
+	SkipReasonMergedUpstreamRef,
+	SkipReasonIgnoreMarker,
+	SkipReasonUpstreamPullRequest,
+	SkipReasonEquivalentPatch,
+	SkipReasonCherryPicked,
+	SkipReasonPolicy,
+	SkipReasonVersionRange,
+}
+
+func (s SkipReason) String() string {
+	return string(s)
+}
+
+// Description returns a human-readable description of the skip reason.
+// Plans can be read from files, so unknown reasons are described generically
+// instead of being rejected.
+func (s SkipReason) Description() string {
+	switch s {
+	case SkipReasonMergedUpstreamRef:
+		return "The commit references an upstream pull request that has been merged"
+	case SkipReasonIgnoreMarker:
+		return "The commit is annotated with the " + CommitMarkerIgnore.String() + " marker"
+	case SkipReasonUpstreamPullRequest:
+		return "The commit is only part of a merged upstream pull request, and the scan stops at it"
+	case SkipReasonEquivalentPatch:
+		return "An equivalent change is already present in upstream"
+	case SkipReasonCherryPicked:
+		return "The commit has been cherry-picked from a commit present in upstream"
+	case SkipReasonPolicy:
+		return "The commit, or its author, is ignored by the sync policy"
+	case SkipReasonVersionRange:
+		return "The commit is restricted with the " + CommitMarkerUntil.String() + " or " + CommitMarkerSince.String() + " markers to upstream versions not including the upstream head"
+	default:
+		return "The commit is skipped for a reason not supported by this version of the tool"
+	}
+}
+
+// commitSkip describes why a commit is excluded from a sync
+type commitSkip struct {
+	Reason SkipReason
+	// Evidence is a human-readable description of what caused the exclusion
+	Evidence string
+	// URL points to the resource that caused the exclusion, if any
+	URL string
+}
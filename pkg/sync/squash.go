@@ -0,0 +1,169 @@
+package sync
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+var rgxPullRequestNum = regexp.MustCompile(`^#?(\d+)$`)
+
+// returns the picked commit identified by the given value of a squash
+// marker, which is either a SHA prefix or a fork pull request number, or nil
+// if there is none. Returns a non-nil error if the SHA prefix is ambiguous.
+func findSquashTarget(req *Request, picked []*commitInfo, c *commitInfo, ref string) (*commitInfo, error) {
+	if m := rgxPullRequestNum.FindStringSubmatch(ref); m != nil {
+		num, _ := strconv.Atoi(m[1])
+		for _, t := range picked {
+			if t == c {
+				continue
+			}
+			for _, pr := range t.pullRequestsOfRepo(req.ForkOrg, req.ForkRepo) {
+				if pr.GetNumber() == num {
+					return t, nil
+				}
+			}
+		}
+	}
+	var candidates []*commitInfo
+	for _, t := range picked {
+		if t != c && strings.HasPrefix(t.SHA(), strings.ToLower(ref)) {
+			candidates = append(candidates, t)
+		}
+	}
+	if len(candidates) > 1 {
+		var lines []string
+		for _, t := range candidates {
+			lines = append(lines, fmt.Sprintf("%s %s", t.SHA(), t.Title()))
+		}
+		return nil, fmt.Errorf("commit %s has marker %s=%s, which matches multiple picked commits:\n%s",
+			c.ShortSHA(), CommitMarkerSquashInto, ref, strings.Join(lines, "\n"))
+	}
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	return nil, nil
+}
+
+// resolves the squash markers of the picked commits of a scan result, so
+// that the commits folded into another one are moved right after it (and
+// after the ones already folded into it) and refer to it. Commits whose
+// target can't be found are kept as standalone patches. Returns a non-nil
+// error if the target of a commit is ambiguous.
+func resolveSquashes(req *Request, res *scanResult) error {
+	roots := make(map[*commitInfo]*commitInfo)
+	var root func(c *commitInfo) *commitInfo
+	root = func(c *commitInfo) *commitInfo {
+		if r, ok := roots[c]; ok && r != c {
+			return root(r)
+		}
+		return c
+	}
+
+	squashed := false
+	for i, c := range res.Picked {
+		var target *commitInfo
+		if refs := c.Markers[CommitMarkerSquashInto.String()]; len(refs) > 0 {
+			var err error
+			target, err = findSquashTarget(req, res.Picked, c, refs[0])
+			if err != nil {
+				return err
+			}
+			if target == nil {
+				logrus.Warnf("commit %s has marker %s=%s, but no picked commit matches it, keeping it as is", c.ShortSHA(), CommitMarkerSquashInto, refs[0])
+			}
+		} else if c.HasMarker(CommitMarkerFixup) {
+			if i > 0 {
+				target = res.Picked[i-1]
+			} else {
+				logrus.Warnf("commit %s has marker %s, but no picked commit precedes it, keeping it as is", c.ShortSHA(), CommitMarkerFixup)
+			}
+		}
+		if target != nil && root(target) == c {
+			logrus.Warnf("commit %s has squash markers resulting in a cycle, keeping it as is", c.ShortSHA())
+			target = nil
+		}
+		if target != nil {
+			roots[c] = target
+			squashed = true
+		}
+	}
+	if !squashed {
+		return nil
+	}
+
+	// group each commit with the ones folded into it
+	groups := make(map[*commitInfo][]*commitInfo)
+	for _, c := range res.Picked {
+		r := root(c)
+		if r != c {
+			c.SquashInto = r.SHA()
+			logrus.Infof("commit %s will be squashed into %s", c.ShortSHA(), r.ShortSHA())
+		}
+		groups[r] = append(groups[r], c)
+	}
+	var picked []*commitInfo
+	for _, c := range res.Picked {
+		if root(c) == c {
+			// the root always comes first in its group, even when
+			// the commits folded into it precede it
+			picked = append(picked, c)
+			for _, f := range groups[c] {
+				if f != c {
+					picked = append(picked, f)
+				}
+			}
+		}
+	}
+	res.Picked = picked
+	return nil
+}
+
+// marks the latest commit with metadata about the automated sync, and
+// folds it into the previous one if the commit must be squashed
+func finalizePatch(git utils.GitHelper, req *Request, links *provider.Links, c *commitInfo, recovered bool) error {
+	if len(c.SquashInto) > 0 {
+		folded, err := squashPatch(git, req, links, c, recovered)
+		if err != nil || folded {
+			return err
+		}
+		logrus.Warnf("commit (%s) can't be squashed as its target (%s) is not the latest patch, keeping it as is", c.ShortSHA(), ShortSHA(c.SquashInto))
+	}
+	return appendSyncMetadata(git, req, links, c, recovered)
+}
+
+// folds the latest commit into the previous one, if the latter is the
+// porting of the commit's squash target, and lists the folded commit in the
+// sync metadata. Returns false if the commit could not be folded.
+func squashPatch(git utils.GitHelper, req *Request, links *provider.Links, c *commitInfo, recovered bool) (bool, error) {
+	prevMsg, err := git.DoOutput("log", "--format=%B", "-n1", "HEAD~1")
+	if err != nil {
+		logrus.Error("failed obtaining message of previous commit")
+		return false, err
+	}
+	if !strings.Contains(prevMsg, fmt.Sprintf("%s: porting of %s ", SyncCommitBodyHeader, ShortSHA(c.SquashInto))) {
+		return false, nil
+	}
+
+	var commitMsg strings.Builder
+	commitURL := links.Commit(req.ForkOrg, req.ForkRepo, c.SHA())
+	commitMsg.WriteString(strings.TrimRight(prevMsg, "\n") + "\n")
+	commitMsg.WriteString(fmt.Sprintf("%s: porting of %s (%s)\n", SyncCommitBodyHeader, c.ShortSHA(), commitURL))
+	if recovered {
+		commitMsg.WriteString(fmt.Sprintf("%s: solved merge conflicts automatically in %s\n", SyncCommitBodyHeader, c.ShortSHA()))
+	}
+	logrus.Infof("squashing (%s) into (%s)", c.ShortSHA(), ShortSHA(c.SquashInto))
+	if err := git.Do("reset", "--soft", "HEAD~1"); err != nil {
+		return false, err
+	}
+	if err := git.Do("commit", "--allow-empty", "--amend", "-m", commitMsg.String()); err != nil {
+		logrus.Error("failed squashing commit")
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,59 @@
+package sync
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSquashes(t *testing.T) {
+	var picked []*commitInfo
+	for i, msg := range []string{
+		"fix of commit 2\n\nSYNC_SQUASH_INTO=#2",
+		"commit 1",
+		"fixup of commit 1\n\nSYNC_FIXUP",
+		"commit 2",
+		"fix of commit 1\n\nSynchro-Marker: squash-into=0000000000000000000000000000000000000001",
+		"fix of nothing\n\nSYNC_SQUASH_INTO=#99",
+	} {
+		c := &commitInfo{Commit: &github.RepositoryCommit{
+			SHA:    github.String(fmt.Sprintf("%040d", i)),
+			Commit: &github.Commit{Message: github.String(msg)},
+		}}
+		c.Markers = parseCommitMarkers(msg)
+		picked = append(picked, c)
+	}
+	picked[3].PullRequests = []*github.PullRequest{{
+		Number: github.Int(2),
+		Base:   &github.PullRequestBranch{Repo: &github.Repository{FullName: github.String("fork/repo")}},
+	}}
+
+	res := &scanResult{Picked: picked}
+	require.NoError(t, resolveSquashes(&Request{ForkOrg: "fork", ForkRepo: "repo"}, res))
+	var titles []string
+	for _, c := range res.Picked {
+		titles = append(titles, c.Title())
+	}
+	assert.Equal(t, []string{"commit 1", "fixup of commit 1", "fix of commit 1", "commit 2", "fix of commit 2", "fix of nothing"}, titles)
+	assert.Equal(t, picked[1].SHA(), picked[2].SquashInto)
+	assert.Equal(t, picked[1].SHA(), picked[4].SquashInto)
+	assert.Equal(t, picked[3].SHA(), picked[0].SquashInto)
+	assert.Empty(t, picked[1].SquashInto)
+	assert.Empty(t, picked[5].SquashInto)
+
+	// SHA prefixes matching multiple commits are ambiguous
+	c := &commitInfo{Commit: &github.RepositoryCommit{
+		SHA:    github.String(fmt.Sprintf("%040d", 9)),
+		Commit: &github.Commit{Message: github.String("fix of something\n\nSYNC_SQUASH_INTO=0000")},
+	}}
+	c.Markers = parseCommitMarkers(c.Message())
+	res = &scanResult{Picked: append(picked, c)}
+	err := resolveSquashes(&Request{ForkOrg: "fork", ForkRepo: "repo"}, res)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "matches multiple picked commits")
+	assert.Contains(t, err.Error(), picked[1].SHA()+" commit 1\n")
+	assert.Contains(t, err.Error(), picked[3].SHA()+" commit 2\n")
+}
@@ -0,0 +1,107 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+)
+
+// syncStateFileName is the name of the file, relative to the repository's
+// git directory, in which the progress of an in-progress sync is persisted
+var syncStateFileName = fmt.Sprintf("%s-sync-state.json", utils.ProjectName)
+
+// syncState represents the progress of a fork sync. It is persisted on disk
+// after each applied commit so that a sync stopped due to a merge conflict
+// can be resumed or aborted after a manual intervention.
+type syncState struct {
+	// Request is the request of the sync in progress
+	Request *Request `json:"request"`
+	// Links are the web links of the provider hosting the repositories
+	Links *provider.Links `json:"links"`
+	// Commits are the ordered commits resulting from the fork scan
+	Commits []*commitInfo `json:"commits"`
+	// Applied is the number of commits that have been already processed,
+	// and is the index of the next commit that should be applied
+	Applied int `json:"applied"`
+	// Recovered contains the SHAs of all the commits that were applied by
+	// solving merge conflicts automatically
+	Recovered []string `json:"recovered,omitempty"`
+	// Failed contains the reports of all the commits that were not applied
+	// due to merge conflicts, when the sync is requested to keep going
+	Failed []*conflictReport `json:"failed,omitempty"`
+	// Skipped are the commits excluded from the sync by the fork scan
+	Skipped []*commitInfo `json:"skipped,omitempty"`
+	// Emptied contains the SHAs of all the commits that were not applied
+	// as they became empty after solving merge conflicts automatically
+	Emptied []string `json:"emptied,omitempty"`
+	// BaseBranch is the branch in which the sync was initiated
+	BaseBranch string `json:"baseBranch"`
+	// HeadSHA is the head of the output branch right before the commit
+	// that caused the sync to stop was attempted
+	HeadSHA string `json:"headSHA,omitempty"`
+	// Conflicted contains the files that had merge conflicts when picking
+	// the commit that caused the sync to stop, which are the only ones
+	// staged when continuing it
+	Conflicted []string `json:"conflicted,omitempty"`
+}
+
+func syncStateFilePath(git utils.GitHelper) (string, error) {
+	gitDir, err := git.DoOutput("rev-parse", "--git-dir")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gitDir, syncStateFileName), nil
+}
+
+// loads the sync state from disk, returns nil if no sync is in progress
+func loadSyncState(git utils.GitHelper) (*syncState, error) {
+	path, err := syncStateFilePath(git)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var res syncState
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("can't parse sync state file %s: %s", path, err.Error())
+	}
+	if res.Request == nil || res.Links == nil || res.Applied < 0 || res.Applied > len(res.Commits) {
+		return nil, fmt.Errorf("found corrupted sync state file: %s", path)
+	}
+	return &res, nil
+}
+
+func saveSyncState(git utils.GitHelper, s *syncState) error {
+	path, err := syncStateFilePath(git)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func removeSyncState(git utils.GitHelper) error {
+	path, err := syncStateFilePath(git)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
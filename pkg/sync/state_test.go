@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncState(t *testing.T) {
+	git := &fakeOutputGit{out: t.TempDir()}
+
+	t.Run("not-in-progress", func(t *testing.T) {
+		state, err := loadSyncState(git)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+		_, err = requireSyncInProgress(git)
+		assert.Error(t, err)
+		assert.NoError(t, removeSyncState(git))
+	})
+
+	t.Run("save-load", func(t *testing.T) {
+		saved := &syncState{
+			Request:    &Request{ForkOrg: "fork", ForkRepo: "repo", OutBranch: "sync"},
+			Links:      &provider.Links{BaseURL: "https://github.com"},
+			Commits:    []*commitInfo{{Commit: &github.RepositoryCommit{SHA: github.String("0123456789abcdef0123456789abcdef01234567")}}},
+			Applied:    1,
+			BaseBranch: "main",
+			HeadSHA:    "fedcba9876543210fedcba9876543210fedcba98",
+			Conflicted: []string{"a.txt", "dir/b.txt"},
+		}
+		require.NoError(t, saveSyncState(git, saved))
+		assert.FileExists(t, filepath.Join(git.out, syncStateFileName))
+
+		loaded, err := requireSyncInProgress(git)
+		require.NoError(t, err)
+		assert.Equal(t, "sync", loaded.Request.OutBranch)
+		assert.Equal(t, "https://github.com", loaded.Links.BaseURL)
+		require.Len(t, loaded.Commits, 1)
+		assert.Equal(t, "0123456789abcdef0123456789abcdef01234567", loaded.Commits[0].SHA())
+		assert.Equal(t, 1, loaded.Applied)
+		assert.Equal(t, "main", loaded.BaseBranch)
+		assert.Equal(t, saved.HeadSHA, loaded.HeadSHA)
+		assert.Equal(t, saved.Conflicted, loaded.Conflicted)
+		assert.Error(t, requireNoSyncInProgress(git))
+
+		require.NoError(t, removeSyncState(git))
+		state, err := loadSyncState(git)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		path := filepath.Join(git.out, syncStateFileName)
+		defer os.Remove(path)
+
+		require.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+		_, err := loadSyncState(git)
+		assert.ErrorContains(t, err, "can't parse sync state file")
+
+		require.NoError(t, os.WriteFile(path, []byte(`{"request":{},"links":{},"applied":2}`), 0644))
+		_, err = loadSyncState(git)
+		assert.ErrorContains(t, err, "corrupted sync state file")
+	})
+}
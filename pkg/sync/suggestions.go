@@ -5,17 +5,30 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/jasondellaluce/synchro/pkg/provider"
 	"github.com/jasondellaluce/synchro/pkg/utils"
 )
 
 type conflictSuggestionInfo struct {
-	UpstreamOrg       string
-	UpstreamRepo      string
-	UpstreamRef       string
-	ForkOrg           string
+	UpstreamRefURL    string
 	ForkRepo          string
+	ForkCloneURL      string
 	ConflictCommitSHA string
+	ConflictCommitURL string
 	BranchName        string
+	BranchURL         string
+}
+
+func newConflictSuggestionInfo(req *Request, links *provider.Links, c *commitInfo) *conflictSuggestionInfo {
+	return &conflictSuggestionInfo{
+		UpstreamRefURL:    links.Tree(req.UpstreamOrg, req.UpstreamRepo, req.UpstreamHeadRef),
+		ForkRepo:          req.ForkRepo,
+		ForkCloneURL:      links.SSHClone(req.ForkOrg, req.ForkRepo),
+		ConflictCommitSHA: c.SHA(),
+		ConflictCommitURL: links.Commit(req.ForkOrg, req.ForkRepo, c.SHA()),
+		BranchName:        req.OutBranch,
+		BranchURL:         links.Tree(req.ForkOrg, req.ForkRepo, req.OutBranch),
+	}
 }
 
 func (i *conflictSuggestionInfo) ProjectRepo() string {
@@ -39,9 +52,9 @@ var contentConflictSuggestion = template.Must(template.New("contentConflictSugge
 Context:
 
 * A merge conflict occurred and can't be resolved automatically
-* Upstream base ref: https://github.com/{{ .UpstreamOrg }}/{{ .UpstreamRepo }}/tree/{{ .UpstreamRef}}
-* Conflicting commit: https://github.com/{{ .ForkOrg }}/{{ .ForkRepo }}/commit/{{ .ConflictCommitSHA }}
-* In-progress sync branch: https://github.com/{{ .ForkOrg }}/{{ .ForkRepo }}/tree/{{ .BranchName }}
+* Upstream base ref: {{ .UpstreamRefURL }}
+* Conflicting commit: {{ .ConflictCommitURL }}
+* In-progress sync branch: {{ .BranchURL }}
 
 Action items:
 
@@ -49,7 +62,7 @@ Consider using a commit marker ({{ .ProjectRepo }}#commit-markers), or solve the
 
 1. Make sure to have installed both ` + "`" + `git` + "`" + ` and ` + "`" + `synchro` + "`" + ` ({{ .ProjectRepo }}#installing).
 2. Checkout fork repo and cd into it:
-   ` + "`" + `cd /tmp && git clone git@github.com:{{ .ForkOrg }}/{{ .ForkRepo }}.git && cd {{ .ForkRepo }}` + "`" + `
+   ` + "`" + `cd /tmp && git clone {{ .ForkCloneURL }} && cd {{ .ForkRepo }}` + "`" + `
 3. Make sure ` + "`" + `git rerere` + "`" + ` is enabled in the repo and pull latest cached resolutions:
    ` + "`" + `git config rerere.enabled true` + "`" + `
    ` + "`" + `synchro conflict pull` + "`" + `
@@ -62,4 +75,6 @@ Consider using a commit marker ({{ .ProjectRepo }}#commit-markers), or solve the
    ` + "`" + `git cherry-pick --continue` + "`" + `
 6. Update fork's conflict resolution cache so that this won't be asked again:
    ` + "`" + `synchro conflict push` + "`" + `
+
+If working in the same local repository in which the sync was initiated, the sync can instead be resumed right after step 5 with ` + "`" + `synchro sync --continue` + "`" + `, or cancelled with ` + "`" + `synchro sync --abort` + "`" + `.
 `)))
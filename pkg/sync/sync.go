@@ -2,12 +2,13 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
-	"github.com/google/go-github/v56/github"
 	"github.com/hashicorp/go-multierror"
+	"github.com/jasondellaluce/synchro/pkg/provider"
 	"github.com/jasondellaluce/synchro/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -17,13 +18,16 @@ import (
 // relative to that commit
 var SyncCommitBodyHeader = strings.ToUpper(utils.ProjectName)
 
-func Sync(ctx context.Context, git utils.GitHelper, client *github.Client, req *Request) error {
+func Sync(ctx context.Context, git utils.GitHelper, p provider.Provider, req *Request) error {
 	if err := requireNoLocalChanges(git); err != nil {
 		return err
 	}
+	if err := requireNoSyncInProgress(git); err != nil {
+		return err
+	}
 
 	// run a repo scan and collect all the private fork patches
-	scanRes, err := scan(ctx, client, req)
+	scanRes, err := runScan(ctx, git, p, req)
 	if err != nil {
 		return err
 	}
@@ -31,61 +35,289 @@ func Sync(ctx context.Context, git utils.GitHelper, client *github.Client, req *
 	// if we're in dry-run mode, just preview the changes and quit
 	if req.DryRun {
 		logrus.Info("skipping performing sync due to dry run request")
-		for _, c := range scanRes {
-			fmt.Fprintf(os.Stdout, "git cherry-pick %s # %s\n", c.SHA(), c.Title())
+		for _, c := range scanRes.Picked {
+			squash := ""
+			if len(c.SquashInto) > 0 {
+				squash = fmt.Sprintf(" (squashed into %s)", ShortSHA(c.SquashInto))
+			}
+			fmt.Fprintf(os.Stdout, "git cherry-pick %s # %s%s\n", c.SHA(), c.Title(), squash)
 		}
 		return nil
 	}
 
 	// check that the current repo is the actual fork and the tool
 	// is not erroneously run from the wrong repo
-	logrus.Infof("checking that the current repo is the fork one")
-	remotes, err := git.GetRemotes()
-	if err != nil {
+	if err := requireForkRepo(git, req); err != nil {
 		return err
 	}
-	if len(remotes) == 0 {
-		return fmt.Errorf("can't find any remotes in current repo")
+
+	curBranch, err := git.GetCurrentBranch()
+	if err != nil {
+		return err
 	}
-	if originRemote, ok := remotes["origin"]; !ok {
-		return fmt.Errorf("can't find `origin` remote in current repo")
-	} else if !strings.Contains(originRemote, fmt.Sprintf("%s/%s", req.ForkOrg, req.ForkRepo)) {
-		return fmt.Errorf("current repo `origin` remote does not match the fork's one: %s", originRemote)
+	state := &syncState{
+		Request:    req,
+		Links:      p.Links(),
+		Commits:    scanRes.Picked,
+		Skipped:    scanRes.Skipped,
+		BaseBranch: curBranch,
 	}
 
 	// apply all the patches one by one
-	remoteName := fmt.Sprintf("temp-%s-sync-upstream", utils.ProjectName)
-	remoteURL := fmt.Sprintf("https://github.com/%s/%s", req.UpstreamOrg, req.UpstreamRepo)
+	remoteName, remoteURL := upstreamRemote(p.Links(), req)
 	logrus.Infof("initiating fork sync for repository %s/%s with upstream %s/%s", req.ForkOrg, req.ForkRepo, req.UpstreamOrg, req.UpstreamRepo)
-	return utils.WithTempGitRemote(git, remoteName, remoteURL, func() error {
+	err = utils.WithTempGitRemote(git, remoteName, remoteURL, func() error {
 		return utils.WithTempLocalBranch(git, req.OutBranch, remoteName, req.UpstreamHeadRef, func() (bool, error) {
 			// we're now at the HEAD of the branch in the upstream repository, in
 			// our local copy. Let's proceed cherry-picking all the patches.
-			return false, applyAllPatches(ctx, git, req, scanRes)
+			return false, applyAllPatches(ctx, git, state)
 		})
 	})
+	if err != nil {
+		return err
+	}
+	return publishSyncBranch(ctx, git, p, state)
+}
+
+// runs the scan of the fork with the strategy required by the request
+func runScan(ctx context.Context, git utils.GitHelper, p provider.Provider, req *Request) (*scanResult, error) {
+	var res *scanResult
+	var err error
+	if req.LocalScan {
+		res, err = scanLocal(ctx, git, p, req)
+	} else {
+		res, err = scan(ctx, p, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIgnoredCommits(req, res); err != nil {
+		return nil, err
+	}
+	if err := filterVersionRanges(git, p.Links(), req, res); err != nil {
+		return nil, err
+	}
+	if err := resolveSquashes(req, res); err != nil {
+		return nil, err
+	}
+	defaultMarkers := requestDefaultMarkers(req)
+	for _, c := range res.Picked {
+		c.DefaultMarkers = defaultMarkers
+	}
+	return res, nil
+}
+
+// returns the name and the URL of the temporary git remote used for
+// fetching the upstream repository
+func upstreamRemote(links *provider.Links, req *Request) (string, string) {
+	remoteName := fmt.Sprintf("temp-%s-sync-upstream", utils.ProjectName)
+	return remoteName, links.Repo(req.UpstreamOrg, req.UpstreamRepo)
+}
+
+// Continue resumes a sync that was previously stopped due to a merge conflict
+// that could not be resolved automatically. The conflicting commit is expected
+// to be either already applied manually in the output branch, or to be
+// in the middle of a cherry-pick with all conflicts solved and staged. Any
+// further change to the files that had conflicts is staged as well, whereas
+// other local changes are left out of the commit.
+// The provider of the stopped sync is used for opening the sync pull request,
+// if requested. The kind and the URL of the given provider options must match
+// it, unless the kind is empty.
+func Continue(ctx context.Context, git utils.GitHelper, opts *provider.Options) error {
+	state, err := requireSyncInProgress(git)
+	if err != nil {
+		return err
+	}
+	req := state.Request
+	p, err := resumeProvider(req, opts)
+	if err != nil {
+		return err
+	}
+
+	curBranch, err := git.GetCurrentBranch()
+	if err != nil {
+		return err
+	}
+	if curBranch != req.OutBranch {
+		return fmt.Errorf("expected to be in sync branch '%s' for continuing, but currently in '%s'", req.OutBranch, curBranch)
+	}
+
+	// complete the cherry-pick of the conflicting commit, if still in progress
+	if cherryPickInProgress(git) {
+		unmerged, err := git.ListUnmergedFiles()
+		if err != nil {
+			return err
+		}
+		if len(unmerged) > 0 {
+			return fmt.Errorf("merge conflicts must be solved before continuing: %s", strings.Join(unmerged, ","))
+		}
+		if err := stageConflictedFiles(git, state.Conflicted); err != nil {
+			return err
+		}
+		if err := git.Do("-c", "core.editor=true", "cherry-pick", "--continue"); err != nil {
+			return err
+		}
+	} else if err := requireNoLocalChanges(git); err != nil {
+		return err
+	}
+
+	// if the head moved, the conflicting commit has been applied manually,
+	// otherwise the user intentionally dropped it
+	c := state.Commits[state.Applied]
+	head, err := git.DoOutput("rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	if head != state.HeadSHA {
+		logrus.Infof("commit (%s) applied manually, proceeding", c.ShortSHA())
+		if err := finalizePatch(git, req, state.Links, c, false); err != nil {
+			return err
+		}
+	} else {
+		logrus.Warnf("commit (%s) has not been applied manually, skipping it", c.ShortSHA())
+	}
+	state.Applied++
+	state.Conflicted = nil
+
+	logrus.Infof("resuming fork sync for repository %s/%s with upstream %s/%s", req.ForkOrg, req.ForkRepo, req.UpstreamOrg, req.UpstreamRepo)
+	err = applyAllPatches(ctx, git, state)
+	if err := multierror.Append(err, git.Do("checkout", state.BaseBranch)).ErrorOrNil(); err != nil {
+		return err
+	}
+	return publishSyncBranch(ctx, git, p, state)
+}
+
+// stages the changes left in the given files, which are the ones that had
+// merge conflicts, so that any other untracked or modified file is left out
+// of the conflicting commit. The files that have already been staged or
+// removed are skipped, as git would fail for them.
+func stageConflictedFiles(git utils.GitHelper, files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	out, err := git.DoOutput(append([]string{"diff", "--name-only", "--relative", "--"}, files...)...)
+	if err != nil {
+		return err
+	}
+	var changed []string
+	for _, f := range strings.Split(out, "\n") {
+		if len(f) > 0 {
+			changed = append(changed, f)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return git.Do(append([]string{"add", "-A", "--"}, changed...)...)
+}
+
+// returns the provider of a stopped sync, with the given options overriding
+// the ones not related to the hosting service
+func resumeProvider(req *Request, opts *provider.Options) (provider.Provider, error) {
+	res := *opts
+	saved := req.Provider
+	switch {
+	case saved == nil && len(res.Kind) == 0:
+		// note: the syncs started by previous versions don't record
+		// the provider, which could only be GitHub
+		res.Kind = provider.KindGitHub
+	case saved == nil:
+	case len(res.Kind) == 0:
+		res.Kind, res.BaseURL = saved.Kind, saved.BaseURL
+	case res.Kind != saved.Kind || res.BaseURL != saved.BaseURL:
+		return nil, fmt.Errorf("sync has been started with provider %s (%s), but %s (%s) is requested for continuing it",
+			saved.Kind, saved.BaseURL, res.Kind, res.BaseURL)
+	}
+	return provider.New(&res)
 }
 
-func applyAllPatches(ctx context.Context, git utils.GitHelper, req *Request, scanRes []*commitInfo) error {
-	// todo: track progress in tmp state file and eventually resume from there
-	for _, c := range scanRes {
+// Abort cancels a sync that was previously stopped due to a merge conflict
+// that could not be resolved automatically, restoring the branch in which
+// the sync was initiated and removing the output branch.
+func Abort(git utils.GitHelper) error {
+	state, err := requireSyncInProgress(git)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("aborting sync for branch '%s'", state.Request.OutBranch)
+	if cherryPickInProgress(git) {
+		if err := git.Do("cherry-pick", "--abort"); err != nil {
+			return err
+		}
+	}
+	if err := git.Do("reset", "--hard"); err != nil {
+		return err
+	}
+	if err := git.Do("checkout", state.BaseBranch); err != nil {
+		return err
+	}
+	if err := git.Do("branch", "-D", state.Request.OutBranch); err != nil {
+		logrus.Warnf("could not delete sync branch '%s': %s", state.Request.OutBranch, err.Error())
+	}
+	return removeSyncState(git)
+}
+
+// applies all the scanned commits starting from the first one that has not
+// been processed yet. The progress is tracked on disk so that the sync can be
+// resumed in case of a merge conflict that can't be recovered automatically.
+func applyAllPatches(ctx context.Context, git utils.GitHelper, state *syncState) error {
+	req := state.Request
+	for ; state.Applied < len(state.Commits); state.Applied++ {
+		c := state.Commits[state.Applied]
 		logrus.Infof("applying (%s) %s", c.ShortSHA(), c.Title())
 
+		head, err := git.DoOutput("rev-parse", "HEAD")
+		if err != nil {
+			return err
+		}
+		state.HeadSHA = head
+		if err := saveSyncState(git, state); err != nil {
+			logrus.Error("failed saving sync progress state")
+			return err
+		}
+
 		recovered := false
 		out, err := git.DoOutput("cherry-pick", "--allow-empty", c.SHA())
 		if err != nil {
 			err = fmt.Errorf("merge conflict on commit: %s", c.SHA())
-			recoveryErr := attemptMergeConflictRecovery(git, out, req, c)
+			conflicted, listErr := git.ListUnmergedFiles()
+			if listErr != nil {
+				return multierror.Append(err, listErr, git.Do("reset", "--hard"))
+			}
+			recoveryErr := attemptMergeConflictRecovery(git, out, req, state.Links, c)
+			var conflictErr *conflictError
+			if recoveryErr != nil && req.KeepGoing && errors.As(recoveryErr, &conflictErr) {
+				logrus.Errorf("unrecoverable merge conflict occurred, skipping commit (%s) and keeping going", c.ShortSHA())
+				report := newConflictReport(req, state.Links, c, conflictErr)
+				if req.ParkConflicts {
+					report.ParkedBranch, err = parkConflict(git, req, state.Links, c)
+					if err != nil {
+						return multierror.Append(err, git.Do("reset", "--hard"))
+					}
+				} else if err := git.Do("reset", "--hard"); err != nil {
+					return err
+				}
+				state.Failed = append(state.Failed, report)
+				continue
+			}
 			if recoveryErr != nil {
+				if errors.As(recoveryErr, &conflictErr) {
+					fmt.Fprintf(os.Stdout, "%s\n", conflictErr.Suggestion)
+				}
 				logrus.Error("unrecoverable merge conflict occurred, reverting patch")
-				return multierror.Append(err, recoveryErr, git.Do("reset", "--hard"))
+				logrus.Errorf("once solved, resume the sync with `%s sync --continue` or cancel it with `%s sync --abort`", utils.ProjectName, utils.ProjectName)
+				state.Conflicted = conflicted
+				return multierror.Append(err, recoveryErr, saveSyncState(git, state), git.Do("reset", "--hard"))
 			}
 			recovered = true
+			state.Recovered = append(state.Recovered, c.SHA())
 			if hasChanges, changesErr := git.HasLocalChanges(); changesErr != nil {
 				logrus.Error("failed checking for remaining changes, reverting patch")
 				return multierror.Append(err, changesErr, git.Do("reset", "--hard"))
 			} else if !hasChanges {
 				logrus.Warn("cherry-pick is now empty possibly due to conflict resolution, skipping commit")
+				state.Emptied = append(state.Emptied, c.SHA())
 				continue
 			}
 			continueErr := git.Do("cherry-pick", "--continue")
@@ -95,24 +327,40 @@ func applyAllPatches(ctx context.Context, git utils.GitHelper, req *Request, sca
 			}
 		}
 
-		// mark the commit with metadata about the automated sync
-		var commitMsg strings.Builder
-		prevMsg, err := git.DoOutput("log", "--format=%B", "-n1")
-		if err != nil {
-			logrus.Error("failed obtaining latest commit message")
+		if err := finalizePatch(git, req, state.Links, c, recovered); err != nil {
 			return err
 		}
-		commitURL := fmt.Sprintf("https://github.com/%s/%s/commit/%s", req.ForkOrg, req.ForkRepo, c.SHA())
-		commitMsg.WriteString(commitMessageWithNoSyncMarkers(prevMsg) + "\n\n")
-		commitMsg.WriteString(fmt.Sprintf("%s: porting of %s (%s)\n", SyncCommitBodyHeader, c.ShortSHA(), commitURL))
-		if recovered {
-			commitMsg.WriteString(fmt.Sprintf("%s: solved merge conflicts automatically\n", SyncCommitBodyHeader))
-		}
-		err = git.Do("commit", "--amend", "-m", commitMsg.String())
-		if err != nil {
-			logrus.Error("failed appending metadata to commit message")
+	}
+	if err := removeSyncState(git); err != nil {
+		return err
+	}
+	if len(state.Failed) > 0 {
+		if err := writeConflictReports(req, state.Failed); err != nil {
 			return err
 		}
+		return fmt.Errorf("%d commits could not be applied due to merge conflicts", len(state.Failed))
+	}
+	return nil
+}
+
+// marks the latest commit with metadata about the automated sync
+func appendSyncMetadata(git utils.GitHelper, req *Request, links *provider.Links, c *commitInfo, recovered bool) error {
+	var commitMsg strings.Builder
+	prevMsg, err := git.DoOutput("log", "--format=%B", "-n1")
+	if err != nil {
+		logrus.Error("failed obtaining latest commit message")
+		return err
+	}
+	commitURL := links.Commit(req.ForkOrg, req.ForkRepo, c.SHA())
+	commitMsg.WriteString(commitMessageWithNoSyncMarkers(prevMsg) + "\n\n")
+	commitMsg.WriteString(fmt.Sprintf("%s: porting of %s (%s)\n", SyncCommitBodyHeader, c.ShortSHA(), commitURL))
+	if recovered {
+		commitMsg.WriteString(fmt.Sprintf("%s: solved merge conflicts automatically\n", SyncCommitBodyHeader))
+	}
+	err = git.Do("commit", "--amend", "-m", commitMsg.String())
+	if err != nil {
+		logrus.Error("failed appending metadata to commit message")
+		return err
 	}
 	return nil
 }
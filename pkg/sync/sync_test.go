@@ -0,0 +1,185 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeResumeGit simulates a repository in which a sync has been stopped,
+// and records all the git commands that change it
+type fakeResumeGit struct {
+	fakeRecordingGit
+	gitDir        string
+	branch        string
+	head          string
+	cherryPicking bool
+	pickOut       string
+	unmerged      []string
+	changed       string
+}
+
+func (f *fakeResumeGit) Do(commands ...string) error {
+	if strings.Join(commands, " ") == "rev-parse --verify --quiet CHERRY_PICK_HEAD" {
+		if f.cherryPicking {
+			return nil
+		}
+		return errors.New("exit status 1")
+	}
+	return f.fakeRecordingGit.Do(commands...)
+}
+
+func (f *fakeResumeGit) DoOutput(commands ...string) (string, error) {
+	switch strings.Join(commands, " ") {
+	case "rev-parse --git-dir":
+		return f.gitDir, nil
+	case "rev-parse HEAD":
+		return f.head, nil
+	case "log --format=%B -n1":
+		return "fix: something\n", nil
+	}
+	f.commands = append(f.commands, strings.Join(commands, " "))
+	switch commands[0] {
+	case "diff":
+		return f.changed, nil
+	case "cherry-pick":
+		return f.pickOut, errors.New("exit status 1")
+	}
+	return "", nil
+}
+
+func (f *fakeResumeGit) GetCurrentBranch() (string, error) {
+	return f.branch, nil
+}
+
+func (f *fakeResumeGit) GetRepoRootDir() (string, error) {
+	return os.Getwd()
+}
+
+func (f *fakeResumeGit) ListUnmergedFiles() ([]string, error) {
+	return f.unmerged, nil
+}
+
+func (f *fakeResumeGit) HasLocalChanges(filters ...func(string) bool) (bool, error) {
+	return false, nil
+}
+
+func TestResumeSync(t *testing.T) {
+	const headSHA = "fedcba9876543210fedcba9876543210fedcba98"
+	gitlab := &provider.Options{Kind: provider.KindGitLab, NoCache: true}
+	newState := func() *syncState {
+		return &syncState{
+			Request: &Request{
+				ForkOrg:   "fork",
+				ForkRepo:  "repo",
+				OutBranch: "sync",
+				Provider:  gitlab,
+			},
+			Links: &provider.Links{BaseURL: "https://gitlab.com", CommitPath: "-/commit"},
+			Commits: []*commitInfo{{Commit: &github.RepositoryCommit{
+				SHA:    github.String("0123456789abcdef0123456789abcdef01234567"),
+				Commit: &github.Commit{Message: github.String("fix: something")},
+			}}},
+			BaseBranch: "main",
+			HeadSHA:    headSHA,
+		}
+	}
+
+	t.Run("stop", func(t *testing.T) {
+		git := &fakeResumeGit{
+			gitDir:   t.TempDir(),
+			head:     headSHA,
+			pickOut:  "CONFLICT (distinct types): b.txt had different types on each side\n",
+			unmerged: []string{"a.txt", "b.txt"},
+		}
+		err := applyAllPatches(context.Background(), git, newState())
+		require.Error(t, err)
+		assert.Contains(t, git.commands, "reset --hard")
+
+		state, err := requireSyncInProgress(git)
+		require.NoError(t, err)
+		assert.Equal(t, 0, state.Applied)
+		assert.Equal(t, []string{"a.txt", "b.txt"}, state.Conflicted)
+	})
+
+	t.Run("continue", func(t *testing.T) {
+		git := &fakeResumeGit{
+			gitDir:        t.TempDir(),
+			branch:        "sync",
+			head:          "1111111111111111111111111111111111111111",
+			cherryPicking: true,
+			changed:       "a.txt\n",
+		}
+		state := newState()
+		state.Conflicted = []string{"a.txt", "b.txt"}
+		require.NoError(t, saveSyncState(git, state))
+
+		require.NoError(t, Continue(context.Background(), git, &provider.Options{NoCache: true}))
+		assert.Equal(t, []string{
+			"diff --name-only --relative -- a.txt b.txt",
+			"add -A -- a.txt",
+			"-c core.editor=true cherry-pick --continue",
+			"commit --amend -m fix: something\n\n\n\n" + SyncCommitBodyHeader + ": porting of 01234567 (https://gitlab.com/fork/repo/-/commit/0123456789abcdef0123456789abcdef01234567)\n",
+			"checkout main",
+		}, git.commands)
+		state, err := loadSyncState(git)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+
+	t.Run("continue-dropped", func(t *testing.T) {
+		git := &fakeResumeGit{gitDir: t.TempDir(), branch: "sync", head: headSHA}
+		require.NoError(t, saveSyncState(git, newState()))
+		require.NoError(t, Continue(context.Background(), git, &provider.Options{NoCache: true}))
+		assert.Equal(t, []string{"checkout main"}, git.commands)
+	})
+
+	t.Run("continue-unmerged", func(t *testing.T) {
+		git := &fakeResumeGit{
+			gitDir:        t.TempDir(),
+			branch:        "sync",
+			head:          headSHA,
+			cherryPicking: true,
+			unmerged:      []string{"a.txt"},
+		}
+		require.NoError(t, saveSyncState(git, newState()))
+		err := Continue(context.Background(), git, &provider.Options{NoCache: true})
+		assert.ErrorContains(t, err, "merge conflicts must be solved before continuing: a.txt")
+		assert.Empty(t, git.commands)
+	})
+
+	t.Run("continue-wrong-branch", func(t *testing.T) {
+		git := &fakeResumeGit{gitDir: t.TempDir(), branch: "main", head: headSHA}
+		require.NoError(t, saveSyncState(git, newState()))
+		err := Continue(context.Background(), git, &provider.Options{NoCache: true})
+		assert.ErrorContains(t, err, "expected to be in sync branch 'sync'")
+		assert.Empty(t, git.commands)
+	})
+
+	t.Run("continue-not-in-progress", func(t *testing.T) {
+		git := &fakeResumeGit{gitDir: t.TempDir(), branch: "sync", head: headSHA}
+		assert.ErrorContains(t, Continue(context.Background(), git, &provider.Options{NoCache: true}), "no sync in progress")
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		git := &fakeResumeGit{gitDir: t.TempDir(), branch: "sync", cherryPicking: true}
+		require.NoError(t, saveSyncState(git, newState()))
+		require.NoError(t, Abort(git))
+		assert.Equal(t, []string{
+			"cherry-pick --abort",
+			"reset --hard",
+			"checkout main",
+			"branch -D sync",
+		}, git.commands)
+		state, err := loadSyncState(git)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/provider"
 	"github.com/jasondellaluce/synchro/pkg/utils"
 )
 
@@ -19,6 +20,54 @@ type Request struct {
 	ForkHeadRef     string
 	OutBranch       string
 	DryRun          bool
+	LocalScan       bool
+	LocalScanEnrich bool
+	UpstreamRemote  string
+	ScanConcurrency int
+	KeepGoing       bool
+	ParkConflicts   bool
+	ReportFile      string
+	// IgnoreCommits are the SHAs, or prefixes of them, of the fork
+	// commits that are never synced
+	IgnoreCommits []string
+	// IgnoreAuthors are the logins, names, or emails of the authors whose
+	// fork commits are never synced
+	IgnoreAuthors []string
+	// ConflictSkipGlobs and ConflictApplyGlobs are the globs of the files to
+	// which the conflict markers apply by default for all the fork commits
+	ConflictSkipGlobs  []string
+	ConflictApplyGlobs []string
+	// TrustedCommentPermission and TrustedCommentTeams restrict the commit
+	// comments whose markers are honored to the ones of the users having at
+	// least the given permission on the fork, or being members of one of the
+	// given teams of the fork's organization. Comments are all trusted if
+	// both are empty.
+	TrustedCommentPermission string
+	TrustedCommentTeams      []string
+	// Push requires pushing the sync branch into the fork once the sync
+	// succeeds, and OpenPullRequest also requires opening a pull request for
+	// it, or updating the one already open for the same branch
+	Push            bool
+	OpenPullRequest bool
+	// PullRequestBase is the base branch of the sync pull request, which
+	// is the fork's head ref if empty
+	PullRequestBase string
+	// Provider are the options of the provider hosting the repositories,
+	// which are persisted for resuming the sync with the same provider
+	Provider *provider.Options
+	// PicksUpstream is true if upstream commits are picked on top of the
+	// fork, as when downstreaming, instead of the other way around
+	PicksUpstream bool
+}
+
+// returns how the base of the cherry-picks and the picked commits are
+// referred to when recovering from merge conflicts, which are respectively
+// the upstream and the downstream fork unless PicksUpstream is set
+func (r *Request) conflictSides() (base, picked string) {
+	if r.PicksUpstream {
+		return "downstream", "upstream"
+	}
+	return "upstream", "downstream"
 }
 
 // commitInfo contains information about a single commit resulting from a fork
@@ -26,10 +75,24 @@ type Request struct {
 type commitInfo struct {
 	Commit       *github.RepositoryCommit
 	PullRequests []*github.PullRequest
-	Markers      map[string]bool
+	// Markers maps each marker found to the globs of the files
+	// to which it is restricted
+	Markers map[string][]string
+	// UpstreamRef is the upstream pull request referenced by the commit, if any
+	UpstreamRef *github.PullRequest
+	// Skip describes why the commit is excluded from the sync, if so
+	Skip *commitSkip
+	// DefaultMarkers maps each conflict marker to the globs of the files to
+	// which it applies when not overridden by the markers of the commit
+	DefaultMarkers map[string][]string
+	// SquashInto is the SHA of the picked commit into which the commit is
+	// folded in the sync branch, if any
+	SquashInto string
 	// internal use
-	comments     []*github.RepositoryComment
-	commentsRepo string
+	markerSources map[string]string
+	markerAuthors map[string]string
+	comments      []*github.RepositoryComment
+	commentsRepo  string
 }
 
 func (c *commitInfo) HasMarker(m CommitMarker) bool {
@@ -37,6 +100,50 @@ func (c *commitInfo) HasMarker(m CommitMarker) bool {
 	return ok
 }
 
+// returns the conflict marker that applies to the given file, or an empty
+// string otherwise. Markers restricted to specific files take precedence
+// over the commit-wide ones, and the most specific glob wins among them.
+// The default markers apply with the same rules only if the commit has no
+// marker for the file.
+func (c *commitInfo) conflictMarker(path string) CommitMarker {
+	for _, markers := range []map[string][]string{c.Markers, c.DefaultMarkers} {
+		if res := matchConflictMarker(markers, path); len(res) > 0 {
+			return res
+		}
+		for _, m := range []CommitMarker{CommitMarkerConflictSkip, CommitMarkerConflictApply} {
+			for _, g := range markers[m.String()] {
+				if g == commitWideMarkerGlob {
+					return m
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// returns the conflict marker with the most specific file-restricted
+// glob matching the given file, or an empty string otherwise
+func matchConflictMarker(markers map[string][]string, path string) CommitMarker {
+	var res CommitMarker
+	bestGlob := ""
+	for _, m := range []CommitMarker{CommitMarkerConflictSkip, CommitMarkerConflictApply} {
+		for _, g := range markers[m.String()] {
+			if g == commitWideMarkerGlob {
+				continue
+			}
+			if utils.MatchPathGlob(g, path) && len(g) > len(bestGlob) {
+				res, bestGlob = m, g
+			}
+		}
+	}
+	return res
+}
+
+// returns true if the given conflict marker applies to the given file
+func (c *commitInfo) hasConflictMarker(m CommitMarker, path string) bool {
+	return c.conflictMarker(path) == m
+}
+
 func (c *commitInfo) Message() string {
 	return c.Commit.GetCommit().GetMessage()
 }
@@ -46,7 +153,16 @@ func (c *commitInfo) SHA() string {
 }
 
 func (c *commitInfo) ShortSHA() string {
-	return c.SHA()[:8]
+	return ShortSHA(c.SHA())
+}
+
+// ShortSHA returns the abbreviated form of a commit SHA, which is the SHA
+// itself if already shorter than that
+func ShortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
 }
 
 func (c *commitInfo) AuthorLogin() string {
@@ -68,13 +184,10 @@ func (c *commitInfo) pullRequestsOfRepo(org, repo string) []*github.PullRequest
 	return res
 }
 
-func (c *commitInfo) getComments(ctx context.Context, client *github.Client, org, repo string) ([]*github.RepositoryComment, error) {
+func (c *commitInfo) getComments(ctx context.Context, p provider.Provider, org, repo string) ([]*github.RepositoryComment, error) {
 	repoName := fmt.Sprintf("%s/%s", org, repo)
 	if c.commentsRepo != repoName {
-		comments, err := utils.CollectSequence(utils.NewGithubSequence(
-			func(o *github.ListOptions) ([]*github.RepositoryComment, *github.Response, error) {
-				return client.Repositories.ListCommitComments(ctx, org, repo, c.SHA(), o)
-			}))
+		comments, err := utils.CollectSequence(p.ListCommitComments(ctx, org, repo, c.SHA()))
 		if err != nil {
 			return nil, err
 		}
@@ -2,9 +2,11 @@ package sync
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
 )
 
 func requireNoLocalChanges(git utils.GitHelper) error {
@@ -16,3 +18,46 @@ func requireNoLocalChanges(git utils.GitHelper) error {
 	}
 	return nil
 }
+
+func requireNoSyncInProgress(git utils.GitHelper) error {
+	state, err := loadSyncState(git)
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		return fmt.Errorf("a sync is already in progress for branch '%s', use either `%s sync --continue` or `%s sync --abort`", state.Request.OutBranch, utils.ProjectName, utils.ProjectName)
+	}
+	return nil
+}
+
+func requireSyncInProgress(git utils.GitHelper) (*syncState, error) {
+	state, err := loadSyncState(git)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, fmt.Errorf("no sync in progress")
+	}
+	return state, nil
+}
+
+func requireForkRepo(git utils.GitHelper, req *Request) error {
+	logrus.Infof("checking that the current repo is the fork one")
+	remotes, err := git.GetRemotes()
+	if err != nil {
+		return err
+	}
+	if len(remotes) == 0 {
+		return fmt.Errorf("can't find any remotes in current repo")
+	}
+	if originRemote, ok := remotes["origin"]; !ok {
+		return fmt.Errorf("can't find `origin` remote in current repo")
+	} else if !strings.Contains(originRemote, fmt.Sprintf("%s/%s", req.ForkOrg, req.ForkRepo)) {
+		return fmt.Errorf("current repo `origin` remote does not match the fork's one: %s", originRemote)
+	}
+	return nil
+}
+
+func cherryPickInProgress(git utils.GitHelper) bool {
+	return git.Do("rev-parse", "--verify", "--quiet", "CHERRY_PICK_HEAD") == nil
+}
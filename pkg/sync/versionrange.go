@@ -0,0 +1,184 @@
+package sync
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jasondellaluce/synchro/pkg/provider"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+var rgxVersion = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?$`)
+
+var rgxPreReleaseIdentifier = regexp.MustCompile(`^([A-Za-z-]*)(\d+)$`)
+
+// compares two pre-release identifiers of a version, in which numeric
+// identifiers have lower precedence than alphanumeric ones as in SemVer.
+// note: differently from SemVer, alphanumeric identifiers with a numeric
+// suffix such as "rc10" are compared by their numbers if their prefixes are
+// the same, as such tags are commonly used for numbering release candidates
+func comparePreReleaseIdentifiers(a, b string) int {
+	ma, mb := rgxPreReleaseIdentifier.FindStringSubmatch(a), rgxPreReleaseIdentifier.FindStringSubmatch(b)
+	if ma != nil && mb != nil && ma[1] == mb[1] {
+		na, _ := strconv.Atoi(ma[2])
+		nb, _ := strconv.Atoi(mb[2])
+		if na != nb {
+			return na - nb
+		}
+		return strings.Compare(a, b)
+	}
+	numericA, numericB := ma != nil && len(ma[1]) == 0, mb != nil && len(mb[1]) == 0
+	switch {
+	case numericA && !numericB:
+		return -1
+	case !numericA && numericB:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// compares two refs in the form of semantic version tags, and returns a
+// negative number if a < b, zero if a == b, and a positive number if a > b.
+// The boolean is false if any of the two refs is not a version.
+func compareVersions(a, b string) (int, bool) {
+	ma, mb := rgxVersion.FindStringSubmatch(a), rgxVersion.FindStringSubmatch(b)
+	if ma == nil || mb == nil {
+		return 0, false
+	}
+	for i := 1; i <= 3; i++ {
+		na, _ := strconv.Atoi(ma[i])
+		nb, _ := strconv.Atoi(mb[i])
+		if na != nb {
+			return na - nb, true
+		}
+	}
+	// a pre-release precedes its release
+	switch {
+	case ma[4] == mb[4]:
+		return 0, true
+	case len(ma[4]) == 0:
+		return 1, true
+	case len(mb[4]) == 0:
+		return -1, true
+	}
+
+	// pre-releases are compared identifier by identifier, and the one with
+	// less identifiers precedes the other if all the preceding are equal
+	ia, ib := strings.Split(ma[4], "."), strings.Split(mb[4], ".")
+	for i := 0; i < len(ia) && i < len(ib); i++ {
+		if cmp := comparePreReleaseIdentifiers(ia[i], ib[i]); cmp != 0 {
+			return cmp, true
+		}
+	}
+	return len(ia) - len(ib), true
+}
+
+// upstreamIncludesFunc returns true if the upstream head includes the given ref
+type upstreamIncludesFunc func(ref string) (bool, error)
+
+// returns the skip info of a commit whose version range markers exclude
+// the upstream head, or nil otherwise
+func versionRangeSkip(includes upstreamIncludesFunc, req *Request, c *commitInfo) (*commitSkip, error) {
+	for _, m := range []CommitMarker{CommitMarkerUntil, CommitMarkerSince} {
+		for _, ref := range c.Markers[m.String()] {
+			included, err := includes(ref)
+			if err != nil {
+				return nil, fmt.Errorf("can't evaluate marker %s=%s of commit %s: %s", m, ref, c.SHA(), err.Error())
+			}
+			if m == CommitMarkerUntil && included {
+				return &commitSkip{
+					Reason:   SkipReasonVersionRange,
+					Evidence: fmt.Sprintf("%s=%s is already included in upstream head %s", m, ref, req.UpstreamHeadRef),
+				}, nil
+			}
+			if m == CommitMarkerSince && !included {
+				return &commitSkip{
+					Reason:   SkipReasonVersionRange,
+					Evidence: fmt.Sprintf("%s=%s is not yet included in upstream head %s", m, ref, req.UpstreamHeadRef),
+				}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// excludes from the picked commits of a scan result the ones whose version
+// range markers exclude the upstream head. Version tags are compared
+// semantically, and the upstream repository is fetched for checking the
+// ancestry of the other refs only if required.
+func filterVersionRanges(git utils.GitHelper, links *provider.Links, req *Request, res *scanResult) error {
+	needsGit := false
+	hasRanges := false
+	for _, c := range res.Picked {
+		for _, m := range []CommitMarker{CommitMarkerUntil, CommitMarkerSince} {
+			for _, ref := range c.Markers[m.String()] {
+				hasRanges = true
+				if _, ok := compareVersions(ref, req.UpstreamHeadRef); !ok {
+					needsGit = true
+				}
+			}
+		}
+	}
+	if !hasRanges {
+		return nil
+	}
+
+	filter := func(includes upstreamIncludesFunc) error {
+		var picked []*commitInfo
+		for _, c := range res.Picked {
+			skip, err := versionRangeSkip(includes, req, c)
+			if err != nil {
+				return err
+			}
+			if skip != nil {
+				logrus.Infof("commit %s is out of its version range, skipping commit: %s", c.ShortSHA(), skip.Evidence)
+				c.Skip = skip
+				res.Skipped = append(res.Skipped, c)
+				continue
+			}
+			picked = append(picked, c)
+		}
+		res.Picked = picked
+		return nil
+	}
+
+	if !needsGit {
+		return filter(func(ref string) (bool, error) {
+			cmp, _ := compareVersions(ref, req.UpstreamHeadRef)
+			return cmp <= 0, nil
+		})
+	}
+	return withLocalScanRemote(git, links, req, func(remoteName string) error {
+		head, err := utils.ResolveLocalRef(git, remoteName, req.UpstreamHeadRef)
+		if err != nil {
+			return err
+		}
+		return filter(func(ref string) (bool, error) {
+			if cmp, ok := compareVersions(ref, req.UpstreamHeadRef); ok {
+				return cmp <= 0, nil
+			}
+			resolved, err := utils.ResolveLocalRef(git, remoteName, ref)
+			if err != nil {
+				return false, err
+			}
+			return isAncestor(git, resolved, head)
+		})
+	})
+}
+
+// returns true if the given ref is an ancestor of the given head
+func isAncestor(git utils.GitHelper, ref, head string) (bool, error) {
+	out, err := git.DoOutput("merge-base", "--is-ancestor", ref, head)
+	if err == nil {
+		return true, nil
+	}
+	// note: the command fails with exit code 1 only if it's not an ancestor
+	if utils.GitExitCode(err) == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("can't check if %s is included in %s: %s", ref, head, out)
+}
@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/jasondellaluce/synchro/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		cmp  int
+	}{
+		{"v0.36.0", "0.36.0", 0},
+		{"0.36.1", "0.36.0", 1},
+		{"0.9.0", "0.10.0", -1},
+		{"1.2", "1.2.0", 0},
+		{"0.37.0-rc1", "0.37.0", -1},
+		{"0.37.0-rc2", "0.37.0-rc1", 1},
+		{"0.37.0-rc2", "0.37.0-rc10", -1},
+		{"0.37.0-rc.2", "0.37.0-rc.10", -1},
+		{"0.37.0-beta.11", "0.37.0-beta.2", 1},
+		{"0.37.0-beta", "0.37.0-rc1", -1},
+		{"0.37.0-alpha", "0.37.0-alpha.1", -1},
+		{"0.37.0-1", "0.37.0-alpha", -1},
+		{"0.37.0-rc10", "0.37.0", -1},
+	} {
+		cmp, ok := compareVersions(tc.a, tc.b)
+		assert.True(t, ok)
+		switch {
+		case tc.cmp < 0:
+			assert.Negative(t, cmp, "%s < %s", tc.a, tc.b)
+		case tc.cmp > 0:
+			assert.Positive(t, cmp, "%s > %s", tc.a, tc.b)
+		default:
+			assert.Zero(t, cmp, "%s == %s", tc.a, tc.b)
+		}
+	}
+	_, ok := compareVersions("master", "0.36.0")
+	assert.False(t, ok)
+}
+
+func TestFilterVersionRanges(t *testing.T) {
+	newCommit := func(msg string) *commitInfo {
+		c := &commitInfo{Commit: &github.RepositoryCommit{SHA: github.String("0123456789abcdef"), Commit: &github.Commit{Message: github.String(msg)}}}
+		c.Markers = parseCommitMarkers(msg)
+		return c
+	}
+	res := &scanResult{Picked: []*commitInfo{
+		newCommit("backport\n\nSYNC_UNTIL=0.37.0"),
+		newCommit("backport\n\nSynchro-Marker: until=0.36.0"),
+		newCommit("feature\n\nSYNC_SINCE=0.36.1"),
+		newCommit("feature\n\nSYNC_SINCE=v0.37.0-rc1"),
+		newCommit("plain"),
+	}}
+
+	// note: no git operation is required when comparing versions
+	err := filterVersionRanges(nil, nil, &Request{UpstreamHeadRef: "0.36.2"}, res)
+	require.NoError(t, err)
+	var picked []string
+	for _, c := range res.Picked {
+		picked = append(picked, c.Message())
+	}
+	assert.Equal(t, []string{"backport\n\nSYNC_UNTIL=0.37.0", "feature\n\nSYNC_SINCE=0.36.1", "plain"}, picked)
+	require.Len(t, res.Skipped, 2)
+	assert.Equal(t, SkipReasonVersionRange, res.Skipped[0].Skip.Reason)
+	assert.Contains(t, res.Skipped[1].Skip.Evidence, "not yet included")
+
+	_, issues := lintCommitMarkers("SYNC_UNTIL\nSYNC_IGNORE=1.0.0")
+	assert.Len(t, issues, 2)
+}
+
+// fakeExitGit fails all the git commands with the given exit code, if not zero
+type fakeExitGit struct {
+	utils.GitHelper
+	code int
+}
+
+func (f *fakeExitGit) DoOutput(commands ...string) (string, error) {
+	if f.code == 0 {
+		return "", nil
+	}
+	err := exec.Command("sh", "-c", fmt.Sprintf("exit %d", f.code)).Run()
+	return "fatal: bad object", err
+}
+
+func TestIsAncestor(t *testing.T) {
+	included, err := isAncestor(&fakeExitGit{}, "a", "b")
+	require.NoError(t, err)
+	assert.True(t, included)
+
+	included, err = isAncestor(&fakeExitGit{code: 1}, "a", "b")
+	require.NoError(t, err)
+	assert.False(t, included)
+
+	_, err = isAncestor(&fakeExitGit{code: 128}, "a", "b")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad object")
+}
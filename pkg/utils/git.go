@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os/exec"
@@ -10,6 +11,10 @@ import (
 	"go.uber.org/multierr"
 )
 
+// RerereCacheDir is the directory of the conflict resolutions cache of
+// `git rerere`, relative to the root directory of the repository
+const RerereCacheDir = "./.git/rr-cache"
+
 type GitHelper interface {
 	// Essentials
 	// Pull(remote, branch string)
@@ -31,6 +36,9 @@ type GitHelper interface {
 	// DeleteBranch() string
 	Do(commands ...string) error
 	DoOutput(commands ...string) (string, error)
+	// DoRawOutput is like DoOutput, but returns the standard output exactly
+	// as printed by git and reports the standard error in the returned error
+	DoRawOutput(commands ...string) (string, error)
 	HasLocalChanges(filters ...func(string) bool) (bool, error)
 	ListUnmergedFiles() ([]string, error)
 	GetCurrentBranch() (string, error)
@@ -39,10 +47,14 @@ type GitHelper interface {
 	GetRepoRootDir() (string, error)
 	GetRemotes() (map[string]string, error)
 	TagExists(tag string) (bool, error)
+	PatchID(rev string) (string, error)
+	DiffPatchID(from, to string) (string, error)
 }
 
 type cmdExecutor interface {
 	exec(cmd string, args ...string) (string, error)
+	execInput(input, cmd string, args ...string) (string, error)
+	execRaw(cmd string, args ...string) (string, error)
 }
 
 type execCmdExecutor struct{}
@@ -52,6 +64,34 @@ func (g *execCmdExecutor) exec(cmd string, args ...string) (string, error) {
 	return strings.TrimSpace(string(outBytes)), err
 }
 
+func (g *execCmdExecutor) execInput(input, cmd string, args ...string) (string, error) {
+	c := exec.Command(cmd, args...)
+	c.Stdin = strings.NewReader(input)
+	outBytes, err := c.CombinedOutput()
+	return strings.TrimSpace(string(outBytes)), err
+}
+
+func (g *execCmdExecutor) execRaw(cmd string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	c := exec.Command(cmd, args...)
+	c.Stderr = &stderr
+	outBytes, err := c.Output()
+	if err != nil && stderr.Len() > 0 {
+		err = multierr.Append(err, errors.New(strings.TrimSpace(stderr.String())))
+	}
+	return string(outBytes), err
+}
+
+// GitExitCode returns the exit code of a git command that failed with the
+// given error, or -1 if the command could not run to completion
+func GitExitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
 func NewGitHelper() GitHelper {
 	return &gitHelper{e: &execCmdExecutor{}}
 }
@@ -70,6 +110,14 @@ func (g *gitHelper) DoOutput(commands ...string) (string, error) {
 	return out, err
 }
 
+func (g *gitHelper) DoRawOutput(commands ...string) (string, error) {
+	if len(commands) < 1 {
+		return "", fmt.Errorf("attempted executing empty git command")
+	}
+	logrus.Debug("git " + strings.Join(commands, " "))
+	return g.e.execRaw("git", commands...)
+}
+
 func (g *gitHelper) Do(commands ...string) error {
 	_, err := g.DoOutput(commands...)
 	return err
@@ -180,3 +228,36 @@ func (g *gitHelper) TagExists(tag string) (bool, error) {
 	}
 	return len(out) > 0, nil
 }
+
+// PatchID returns the stable patch-id of the changes of a commit, as computed
+// by `git patch-id`, which is the same for commits applying equivalent changes
+// regardless of their line numbers and whitespace. Returns an empty string
+// if the commit has no changes.
+func (g *gitHelper) PatchID(rev string) (string, error) {
+	diff, err := g.DoOutput("show", "--format=", "--no-color", "--no-ext-diff", rev)
+	if err != nil {
+		return "", fmt.Errorf("can't retrieve changes of commit %s: %s", rev, diff)
+	}
+	return g.patchID(diff)
+}
+
+// DiffPatchID is like PatchID, but for the combined changes between two revs
+func (g *gitHelper) DiffPatchID(from, to string) (string, error) {
+	diff, err := g.DoOutput("diff", "--no-color", "--no-ext-diff", from, to)
+	if err != nil {
+		return "", fmt.Errorf("can't retrieve changes between %s and %s: %s", from, to, diff)
+	}
+	return g.patchID(diff)
+}
+
+func (g *gitHelper) patchID(diff string) (string, error) {
+	out, err := g.e.execInput(diff+"\n", "git", "patch-id", "--stable")
+	if err != nil {
+		return "", err
+	}
+	tokens := strings.Fields(out)
+	if len(tokens) == 0 {
+		return "", nil
+	}
+	return tokens[0], nil
+}
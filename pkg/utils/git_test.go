@@ -8,10 +8,11 @@ import (
 )
 
 type testCmdExecutor struct {
-	cmd  string
-	args []string
-	out  string
-	err  error
+	cmd   string
+	args  []string
+	input string
+	out   string
+	err   error
 }
 
 func (t *testCmdExecutor) exec(cmd string, args ...string) (string, error) {
@@ -20,6 +21,15 @@ func (t *testCmdExecutor) exec(cmd string, args ...string) (string, error) {
 	return t.out, t.err
 }
 
+func (t *testCmdExecutor) execRaw(cmd string, args ...string) (string, error) {
+	return t.exec(cmd, args...)
+}
+
+func (t *testCmdExecutor) execInput(input, cmd string, args ...string) (string, error) {
+	t.input = input
+	return t.exec(cmd, args...)
+}
+
 func TestGetRemotes(t *testing.T) {
 	e := &testCmdExecutor{}
 	git := &gitHelper{e: e}
@@ -38,3 +48,29 @@ func TestGetRemotes(t *testing.T) {
 	require.Equal(t, "git@github.com:forkorg/forkrepo.git", remotes["origin"])
 
 }
+
+func TestPatchID(t *testing.T) {
+	e := &testCmdExecutor{}
+	git := &gitHelper{e: e}
+
+	// note: the executor serves the same output for both the diff and
+	// the patch-id commands
+	e.out = "0123abcd 4567ef01"
+	id, err := git.PatchID("HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "0123abcd", id)
+	assert.Equal(t, "git", e.cmd)
+	assert.Equal(t, []string{"patch-id", "--stable"}, e.args)
+	assert.Equal(t, "0123abcd 4567ef01\n", e.input)
+
+	e.out = ""
+	id, err = git.PatchID("HEAD")
+	require.NoError(t, err)
+	assert.Empty(t, id)
+
+	e.out = "0123abcd 4567ef01"
+	id, err = git.DiffPatchID("HEAD~2", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "0123abcd", id)
+	assert.Equal(t, []string{"patch-id", "--stable"}, e.args)
+}
@@ -1,14 +1,23 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/google/go-github/v56/github"
 	"github.com/sirupsen/logrus"
 )
 
-func GetGithubClient() *github.Client {
-	client := github.NewClient(nil)
+// GetGithubClient returns a new GitHub client authenticated with the token
+// set in the GITHUB_TOKEN env variable. Unless disabled, the responses of the
+// GitHub APIs are cached persistently on disk and validated through
+// conditional requests, which don't count against the rate limit.
+func GetGithubClient(noCache bool) *github.Client {
+	client := github.NewClient(NewHTTPClient(noCache))
 	token := os.Getenv("GITHUB_TOKEN")
 	if len(token) > 0 {
 		client = client.WithAuthToken(token)
@@ -22,15 +31,27 @@ func GetGithubClient() *github.Client {
 // invocations of a GitHub client for which the list options are provided.
 type GithubClientListFunc[T interface{}] func(*github.ListOptions) ([]*T, *github.Response, error)
 
-// NewGithubSequence creates a new sequence starting from a GithubClientListFunc
-func NewGithubSequence[T interface{}](f GithubClientListFunc[T]) Sequence[T] {
+// NewGithubSequence creates a new sequence starting from a GithubClientListFunc.
+// Pages are always requested with the same size so that the responses of
+// subsequent iterations can be served by the HTTP cache. Retries of failed
+// requests stop waiting as soon as the given context is done.
+func NewGithubSequence[T interface{}](ctx context.Context, f GithubClientListFunc[T]) Sequence[T] {
+	return NewGithubSequenceWithPageSize(ctx, 100, f)
+}
+
+// NewGithubSequenceWithPageSize is the same as NewGithubSequence, but pages
+// are requested with the given size, which must not exceed the maximum
+// supported by the API as a shorter page is considered the last one.
+func NewGithubSequenceWithPageSize[T interface{}](ctx context.Context, perPage int, f GithubClientListFunc[T]) Sequence[T] {
 	return &githubSequence[T]{
+		ctx:     ctx,
 		fetch:   f,
-		options: github.ListOptions{Page: 1, PerPage: 100},
+		options: github.ListOptions{Page: 1, PerPage: perPage},
 	}
 }
 
 type githubSequence[T interface{}] struct {
+	ctx     context.Context
 	fetch   GithubClientListFunc[T]
 	options github.ListOptions
 	err     error
@@ -47,7 +68,9 @@ func (g *githubSequence[T]) Next() *T {
 		return nil
 	}
 	if len(g.batch) == 0 && !g.stop {
-		g.batch, _, g.err = g.fetch(&g.options)
+		g.batch, _, g.err = RetryGithubCall(g.ctx, true, func() ([]*T, *github.Response, error) {
+			return g.fetch(&g.options)
+		})
 		if g.err != nil {
 			return nil
 		}
@@ -63,3 +86,98 @@ func (g *githubSequence[T]) Next() *T {
 	g.batch = g.batch[1:]
 	return res
 }
+
+// githubMaxRetries is the maximum number of times a GitHub API invocation
+// is retried before giving up
+const githubMaxRetries = 6
+
+// githubMaxBackoff is the maximum delay between two retries of a failed
+// GitHub API invocation, unless the API explicitly asks to wait longer
+const githubMaxBackoff = 2 * time.Minute
+
+// githubSleep waits for the given duration, or returns the error of the
+// given context if it's done before, and can be replaced in tests
+var githubSleep = func(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// RetryGithubCall invokes a GitHub API call and retries it when the rate
+// limit is exceeded, by waiting until the limit is reset or for the time
+// suggested by the API. If the call is idempotent, it's also retried with an
+// exponential backoff with jitter when failing due to transient server
+// errors. Non-idempotent calls are only retried when rejected for rate
+// limiting, as in that case the request is not processed at all. Waiting
+// stops as soon as the given context is done, in which case its error is
+// returned.
+func RetryGithubCall[T interface{}](ctx context.Context, idempotent bool, f func() (T, *github.Response, error)) (T, *github.Response, error) {
+	for attempt := 0; ; attempt++ {
+		res, resp, err := f()
+		logGithubRateLimit(resp)
+		if err == nil {
+			return res, resp, nil
+		}
+		delay, retry := githubRetryDelay(err, idempotent, attempt)
+		if !retry || attempt >= githubMaxRetries {
+			return res, resp, err
+		}
+		logrus.Warnf("GitHub API request failed (attempt %d/%d), retrying in %s: %s", attempt+1, githubMaxRetries+1, delay.Round(time.Second), err.Error())
+		if err := githubSleep(ctx, delay); err != nil {
+			return res, resp, err
+		}
+	}
+}
+
+func logGithubRateLimit(resp *github.Response) {
+	if resp != nil && resp.Rate.Limit > 0 {
+		logrus.Debugf("GitHub API rate limit: %d/%d remaining, reset at %s",
+			resp.Rate.Remaining, resp.Rate.Limit, resp.Rate.Reset.Time.Format(time.RFC3339))
+	}
+}
+
+// returns the time to wait before retrying a failed GitHub API invocation,
+// and false if the failure is not worth retrying
+func githubRetryDelay(err error, idempotent bool, attempt int) (time.Duration, bool) {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		// wait until the rate limit is reset, with some margin for clock skew
+		delay := time.Until(rateErr.Rate.Reset.Time) + time.Second
+		if delay < time.Second {
+			delay = time.Second
+		}
+		return delay, true
+	}
+
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil && *abuseErr.RetryAfter > 0 {
+			return *abuseErr.RetryAfter, true
+		}
+		// secondary rate limits require waiting at least one minute
+		// when not specified otherwise
+		return time.Minute + githubBackoff(attempt), true
+	}
+
+	var respErr *github.ErrorResponse
+	if idempotent && errors.As(err, &respErr) && respErr.Response != nil {
+		switch respErr.Response.StatusCode {
+		case http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return githubBackoff(attempt), true
+		}
+	}
+	return 0, false
+}
+
+// computes an exponential backoff delay, randomized by up to a half
+func githubBackoff(attempt int) time.Duration {
+	delay := time.Second << attempt
+	if delay <= 0 || delay > githubMaxBackoff {
+		delay = githubMaxBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
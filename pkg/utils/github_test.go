@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v56/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGithubSequenceRetry(t *testing.T) {
+	var sleeps []time.Duration
+	sleep := githubSleep
+	defer func(f func(context.Context, time.Duration) error) { githubSleep = f }(githubSleep)
+	githubSleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+
+	httpResp := func(status int) *http.Response {
+		return &http.Response{
+			StatusCode: status,
+			Request:    &http.Request{Method: http.MethodGet, URL: &url.URL{Scheme: "https", Host: "api.github.com"}},
+		}
+	}
+	retryAfter := 30 * time.Second
+	failures := []error{
+		&github.RateLimitError{
+			Response: httpResp(http.StatusForbidden),
+			Rate:     github.Rate{Reset: github.Timestamp{Time: time.Now().Add(time.Hour)}},
+		},
+		&github.AbuseRateLimitError{Response: httpResp(http.StatusForbidden), RetryAfter: &retryAfter},
+		&github.ErrorResponse{Response: httpResp(http.StatusBadGateway)},
+	}
+
+	calls := 0
+	seq := NewGithubSequence(context.Background(), func(o *github.ListOptions) ([]*int, *github.Response, error) {
+		calls++
+		if len(failures) > 0 {
+			err := failures[0]
+			failures = failures[1:]
+			return nil, nil, err
+		}
+		v := o.Page
+		return []*int{&v}, nil, nil
+	})
+	values, err := CollectSequence(seq)
+	require.NoError(t, err)
+	require.Len(t, values, 1)
+	assert.Equal(t, 1, *values[0])
+	assert.Equal(t, 4, calls)
+	require.Len(t, sleeps, 3)
+	assert.Greater(t, sleeps[0], 59*time.Minute)
+	assert.Equal(t, retryAfter, sleeps[1])
+	assert.LessOrEqual(t, sleeps[2], 4*time.Second)
+
+	t.Run("non-idempotent", func(t *testing.T) {
+		sleeps = nil
+		_, _, err := RetryGithubCall(context.Background(), false, func() (*int, *github.Response, error) {
+			return nil, nil, &github.ErrorResponse{Response: httpResp(http.StatusServiceUnavailable)}
+		})
+		assert.Error(t, err)
+		assert.Empty(t, sleeps)
+	})
+
+	t.Run("give up", func(t *testing.T) {
+		sleeps = nil
+		_, _, err := RetryGithubCall(context.Background(), true, func() (*int, *github.Response, error) {
+			return nil, nil, &github.ErrorResponse{Response: httpResp(http.StatusBadGateway)}
+		})
+		assert.Error(t, err)
+		assert.Len(t, sleeps, githubMaxRetries)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		sleeps = nil
+		_, _, err := RetryGithubCall(context.Background(), true, func() (*int, *github.Response, error) {
+			return nil, nil, &github.ErrorResponse{Response: httpResp(http.StatusNotFound)}
+		})
+		assert.Error(t, err)
+		assert.Empty(t, sleeps)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		githubSleep = sleep
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		calls := 0
+		_, _, err := RetryGithubCall(ctx, true, func() (*int, *github.Response, error) {
+			calls++
+			return nil, nil, &github.ErrorResponse{Response: httpResp(http.StatusBadGateway)}
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, calls)
+	})
+}
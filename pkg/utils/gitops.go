@@ -94,3 +94,18 @@ func WithTempLocalBranch(git GitHelper, localBranch, remote, remoteBranch string
 	deleteOnExit, err = f()
 	return err
 }
+
+// ResolveLocalRef returns the fully-qualified name of a ref that is available
+// in the local repository, without contacting the given remote. Remote-tracking
+// branches take precedence, after which the ref is resolved as is (e.g. tags
+// or commit SHAs). Returns a non-nil error if the ref can't be found.
+func ResolveLocalRef(git GitHelper, remote, ref string) (string, error) {
+	remoteRef := fmt.Sprintf("refs/remotes/%s/%s", remote, ref)
+	if git.Do("rev-parse", "--verify", "--quiet", remoteRef) == nil {
+		return remoteRef, nil
+	}
+	if git.Do("rev-parse", "--verify", "--quiet", ref+"^{commit}") == nil {
+		return ref, nil
+	}
+	return "", fmt.Errorf("can't find ref '%s' in local repository nor in remote '%s'", ref, remote)
+}
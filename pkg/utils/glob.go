@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MatchPathGlob returns true if the given path matches a glob, in which `*`
+// and `?` don't match path separators and `**` matches any sequence of
+// characters. A glob also matches all the paths contained in the directory
+// it matches.
+func MatchPathGlob(glob, path string) bool {
+	var rgx strings.Builder
+	rgx.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			rgx.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			rgx.WriteString("[^/]*")
+		case glob[i] == '?':
+			rgx.WriteString("[^/]")
+		default:
+			rgx.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	rgx.WriteString("(/.*)?$")
+	ok, err := regexp.MatchString(rgx.String(), strings.TrimSuffix(path, "/"))
+	return err == nil && ok
+}
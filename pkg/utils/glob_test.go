@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPathGlob(t *testing.T) {
+	assert.True(t, MatchPathGlob("vendor/**", "vendor/a/b.go"))
+	assert.True(t, MatchPathGlob("vendor", "vendor/a/b.go"))
+	assert.True(t, MatchPathGlob("*.pb.go", "api.pb.go"))
+	assert.False(t, MatchPathGlob("*.pb.go", "api/api.pb.go"))
+	assert.True(t, MatchPathGlob("**/*.pb.go", "api/api.pb.go"))
+	assert.False(t, MatchPathGlob("vendor/**", "src/vendor.go"))
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HTTPCacheDir returns the directory in which HTTP responses are cached
+func HTTPCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, ProjectName, "http"), nil
+}
+
+// NewHTTPCacheTransport returns an HTTP transport that persistently caches
+// on disk the responses of GET requests that are validated through an ETag
+// or a Last-Modified header. Subsequent requests for the same resource are
+// sent as conditional requests, and the cached response is returned in case
+// the server reports that the resource has not been modified.
+func NewHTTPCacheTransport(dir string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &httpCacheTransport{dir: dir, base: base}
+}
+
+// PruneHTTPCache removes all the entries of the HTTP cache that have not been
+// used since the given duration, or all of them if the duration is zero.
+// Returns the number of removed entries.
+func PruneHTTPCache(dir string, olderThan time.Duration) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	removed := 0
+	limit := time.Now().Add(-olderThan)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return removed, err
+		}
+		if olderThan <= 0 || info.ModTime().Before(limit) {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+type httpCacheTransport struct {
+	dir  string
+	base http.RoundTripper
+}
+
+func (t *httpCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	key := t.key(req)
+	cachedResp := t.load(key, req)
+	if cachedResp != nil {
+		// note: the request must not be modified by a round tripper
+		req = req.Clone(req.Context())
+		if etag := cachedResp.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastMod := cachedResp.Header.Get("Last-Modified"); lastMod != "" {
+			req.Header.Set("If-Modified-Since", lastMod)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cachedResp != nil {
+		logrus.Debugf("cache hit for %s", req.URL.String())
+		resp.Body.Close()
+		// keep the live headers about rate limiting, as they are up to date
+		for k, v := range resp.Header {
+			if strings.HasPrefix(strings.ToLower(k), "x-ratelimit") {
+				cachedResp.Header[k] = v
+			}
+		}
+		now := time.Now()
+		os.Chtimes(filepath.Join(t.dir, key), now, now)
+		return cachedResp, nil
+	}
+
+	if resp.StatusCode == http.StatusOK && (resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "") {
+		var buf bytes.Buffer
+		if err := resp.Write(&buf); err != nil {
+			return nil, err
+		}
+		if err := t.store(key, buf.Bytes()); err != nil {
+			logrus.Warnf("failed storing HTTP response in cache: %s", err.Error())
+		}
+		return http.ReadResponse(bufio.NewReader(bytes.NewReader(buf.Bytes())), req)
+	}
+
+	if cachedResp != nil && resp.StatusCode == http.StatusOK {
+		// the resource is not cacheable anymore
+		os.Remove(filepath.Join(t.dir, key))
+	}
+	return resp, nil
+}
+
+// computes a cache key for a given request, which is unique for each
+// URL and credentials used for accessing it
+func (t *httpCacheTransport) key(req *http.Request) string {
+	h := sha256.New()
+	h.Write([]byte(req.URL.String()))
+	for _, header := range []string{"Accept", "Authorization", "PRIVATE-TOKEN"} {
+		h.Write([]byte{0})
+		h.Write([]byte(req.Header.Get(header)))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (t *httpCacheTransport) load(key string, req *http.Request) *http.Response {
+	data, err := os.ReadFile(filepath.Join(t.dir, key))
+	if err != nil {
+		return nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		logrus.Debugf("ignoring corrupted HTTP cache entry %s: %s", key, err.Error())
+		return nil
+	}
+	return resp
+}
+
+func (t *httpCacheTransport) store(key string, data []byte) error {
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return err
+	}
+	// write atomically, as multiple requests may run concurrently
+	tmp, err := os.CreateTemp(t.dir, key+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, bytes.NewReader(data)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(t.dir, key))
+}
+
+// NewHTTPClient returns a new HTTP client, which persistently caches the
+// responses on disk unless disabled or unavailable
+func NewHTTPClient(noCache bool) *http.Client {
+	if noCache {
+		return http.DefaultClient
+	}
+	dir, err := HTTPCacheDir()
+	if err != nil {
+		logrus.Warnf("can't use HTTP cache: %s", err.Error())
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: NewHTTPCacheTransport(dir, nil)}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPCacheTransport(t *testing.T) {
+	requests := 0
+	notModified := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Remaining", "100")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.Header().Set("X-RateLimit-Remaining", "99")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := &http.Client{Transport: NewHTTPCacheTransport(dir, nil)}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL + "/resource")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "content", string(body))
+		if i > 0 {
+			assert.Equal(t, "99", resp.Header.Get("X-RateLimit-Remaining"))
+		}
+	}
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 2, notModified)
+
+	removed, err := PruneHTTPCache(dir, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	removed, err = PruneHTTPCache(dir, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+}
@@ -5,3 +5,12 @@ func ReverseSlice[S ~[]E, E any](s S) {
 		s[i], s[j] = s[j], s[i]
 	}
 }
+
+func Contains[S ~[]E, E comparable](s S, v E) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}